@@ -0,0 +1,754 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ * Small JSON API for operators, listening on admin_listen. Every request must
+ * carry "Authorization: Bearer <admin_token>"; the API refuses to start
+ * without a token so it is never exposed unauthenticated by accident.
+ */
+type RIVAClientAdmin struct {
+    RClient *RIVAClient
+    DB      *RIVAClientDB
+    Log     *RIVAClientLog
+    Mux     *http.ServeMux
+}
+
+func (*RIVAClientAdmin) New(rClient *RIVAClient, db *RIVAClientDB) *RIVAClientAdmin {
+    admin := &RIVAClientAdmin{
+        RClient: rClient,
+        DB:      db,
+        Log:     NewRIVAClientLog("RIVABotAdmin", "INFO"),
+        Mux:     http.NewServeMux(),
+    }
+
+    admin.Mux.HandleFunc("GET /api/scheduled", admin.listScheduled)
+    admin.Mux.HandleFunc("POST /api/scheduled", admin.createScheduled)
+    admin.Mux.HandleFunc("DELETE /api/scheduled/{id}", admin.cancelScheduled)
+    admin.Mux.HandleFunc("GET /api/campaigns", admin.listCampaigns)
+    admin.Mux.HandleFunc("POST /api/campaigns", admin.createCampaign)
+    admin.Mux.HandleFunc("GET /api/campaigns/{id}", admin.reportCampaign)
+    admin.Mux.HandleFunc("POST /api/campaigns/{id}/{action}", admin.actionCampaign)
+    admin.Mux.HandleFunc("GET /api/chats/{jid}/receipts", admin.chatReceipts)
+    admin.Mux.HandleFunc("GET /api/messages/{id}/receipts", admin.messageReceipts)
+    admin.Mux.HandleFunc("GET /api/chats/{jid}/processed/{id}", admin.processedMessage)
+    admin.Mux.HandleFunc("GET /api/forms/{id}/submissions.csv", admin.exportFormSubmissions)
+    admin.Mux.HandleFunc("GET /api/contacts", admin.listContacts)
+    admin.Mux.HandleFunc("GET /api/contacts/{jid}", admin.getContact)
+    admin.Mux.HandleFunc("POST /api/contacts/{jid}/tags", admin.tagContact)
+    admin.Mux.HandleFunc("DELETE /api/contacts/{jid}/tags/{tag}", admin.untagContact)
+    admin.Mux.HandleFunc("GET /api/labels", admin.listLabels)
+    admin.Mux.HandleFunc("GET /api/labels/{label}/chats", admin.labeledChats)
+    admin.Mux.HandleFunc("GET /api/labels/{label}/messages", admin.labeledMessages)
+    admin.Mux.HandleFunc("GET /api/chats/{jid}/labels", admin.chatLabels)
+    admin.Mux.HandleFunc("POST /api/chats/{jid}/labels", admin.labelChat)
+    admin.Mux.HandleFunc("DELETE /api/chats/{jid}/labels/{label}", admin.unlabelChat)
+    admin.Mux.HandleFunc("GET /api/sla", admin.slaReport)
+    admin.Mux.HandleFunc("GET /api/audit", admin.listAudit)
+    admin.Mux.HandleFunc("GET /api/handovers", admin.listHandovers)
+    admin.Mux.HandleFunc("DELETE /api/handovers/{jid}", admin.resolveHandover)
+    admin.Mux.HandleFunc("GET /api/away", admin.getAway)
+    admin.Mux.HandleFunc("PUT /api/away", admin.setAway)
+    admin.Mux.HandleFunc("DELETE /api/away", admin.clearAway)
+    admin.Mux.HandleFunc("GET /api/blocklist", admin.listBlocked)
+    admin.Mux.HandleFunc("DELETE /api/blocklist/{jid}", admin.unblockContact)
+    admin.Mux.HandleFunc("GET /api/flood", admin.listFloodEvents)
+
+    return admin
+}
+
+func (admin *RIVAClientAdmin) Run(ctx context.Context) error {
+    if rBotAdminListen == "" {
+        return nil
+    }
+
+    if rBotAdminToken == "" {
+        return errors.New("admin_token must be set when admin_listen is set")
+    }
+
+    server := &http.Server{
+        Addr:              rBotAdminListen,
+        Handler:           admin.authenticate(admin.Mux),
+        ReadHeaderTimeout: 10 * time.Second,
+    }
+
+    go func() {
+        <-ctx.Done()
+        server.Shutdown(context.Background())
+    }()
+
+    admin.Log.Infof("Admin API listening on %s", rBotAdminListen)
+    if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+        admin.Log.Errorf("Admin API stopped: %v", err)
+        return err
+    }
+
+    return nil
+}
+
+func (admin *RIVAClientAdmin) authenticate(next http.Handler) http.Handler {
+    expected := []byte("Bearer " + rBotAdminToken)
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+            admin.writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+            return
+        }
+
+        next.ServeHTTP(w, r)
+    })
+}
+
+func (admin *RIVAClientAdmin) writeJSON(w http.ResponseWriter, status int, body any) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    if err := json.NewEncoder(w).Encode(body); err != nil {
+        admin.Log.Warnf("Failed to write response: %v", err)
+    }
+}
+
+func (admin *RIVAClientAdmin) writeError(w http.ResponseWriter, status int, err error) {
+    admin.writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (admin *RIVAClientAdmin) listScheduled(w http.ResponseWriter, r *http.Request) {
+    scheduled, err := admin.DB.ListScheduledMessages(r.URL.Query().Get("all") == "true")
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, scheduled)
+}
+
+type rivaScheduleRequest struct {
+    To         string `json:"to"`         // Recipient JID or phone number
+    At         string `json:"at"`         // Any format accepted by ParseScheduleTime
+    Recurrence string `json:"recurrence"` // "", "daily", "weekly" or "cron:<expr>"
+    Text       string `json:"text"`       // Text, or caption if Media is set
+    Media      string `json:"media"`      // Path to a file on the bot's host
+}
+
+func (admin *RIVAClientAdmin) createScheduled(w http.ResponseWriter, r *http.Request) {
+    var req rivaScheduleRequest
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1 << 20)).Decode(&req); err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    recipient, err := ParseRecipientJID(req.To)
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    var sendAt time.Time
+    if strings.TrimSpace(req.At) != "" {
+        if sendAt, err = ParseScheduleTime(req.At, time.Now()); err != nil {
+            admin.writeError(w, http.StatusBadRequest, err)
+            return
+        }
+    }
+
+    sm, err := NewScheduledMessage(recipient, sendAt, req.Recurrence, req.Text, req.Media, "api")
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    if sm.ID, err = admin.DB.InsertScheduledMessage(sm); err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    admin.Log.Infof("Scheduled message %d to %s at %s via API", sm.ID, sm.RecipientJID, sm.SendAt.Format(time.RFC3339))
+    admin.writeJSON(w, http.StatusCreated, sm)
+}
+
+func (admin *RIVAClientAdmin) pathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+    id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, errors.New("invalid id"))
+        return 0, false
+    }
+
+    return id, true
+}
+
+func (admin *RIVAClientAdmin) cancelScheduled(w http.ResponseWriter, r *http.Request) {
+    id, ok := admin.pathID(w, r)
+    if !ok {
+        return
+    }
+
+    cancelled, err := admin.DB.CancelScheduledMessage(id)
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    if !cancelled {
+        admin.writeError(w, http.StatusNotFound, errors.New("no pending scheduled message with this id"))
+        return
+    }
+
+    admin.Log.Infof("Cancelled scheduled message %d via API", id)
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (admin *RIVAClientAdmin) listCampaigns(w http.ResponseWriter, r *http.Request) {
+    campaigns, err := admin.DB.ListCampaigns()
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, campaigns)
+}
+
+type rivaCampaignRequest struct {
+    Name     string `json:"name"`     // Name shown to operators
+    Template string `json:"template"` // Text with {column} placeholders
+    Media    string `json:"media"`    // Path to a file on the bot's host
+    CSV      string `json:"csv"`      // Audience CSV, including the header row
+}
+
+func (admin *RIVAClientAdmin) createCampaign(w http.ResponseWriter, r *http.Request) {
+    var req rivaCampaignRequest
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8 << 20)).Decode(&req); err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    id, count, err := CreateCampaign(admin.DB, req.Name, req.Template, req.Media, strings.NewReader(req.CSV))
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    admin.Log.Infof("Created campaign %d with %d recipients via API", id, count)
+    admin.writeJSON(w, http.StatusCreated, map[string]int64{"id": id, "recipients": int64(count)})
+}
+
+func (admin *RIVAClientAdmin) reportCampaign(w http.ResponseWriter, r *http.Request) {
+    id, ok := admin.pathID(w, r)
+    if !ok {
+        return
+    }
+
+    report, found, err := admin.DB.GetCampaignReport(id)
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    if !found {
+        admin.writeError(w, http.StatusNotFound, errors.New("no campaign with this id"))
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, report)
+}
+
+func (admin *RIVAClientAdmin) actionCampaign(w http.ResponseWriter, r *http.Request) {
+    id, ok := admin.pathID(w, r)
+    if !ok {
+        return
+    }
+
+    action := r.PathValue("action")
+    if _, known := rBotCampaignActions[action]; !known {
+        admin.writeError(w, http.StatusNotFound, errors.New("unknown campaign action"))
+        return
+    }
+
+    if err := ApplyCampaignAction(admin.DB, id, action); err != nil {
+        admin.writeError(w, http.StatusConflict, err)
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (admin *RIVAClientAdmin) chatReceipts(w http.ResponseWriter, r *http.Request) {
+    chat, err := ParseRecipientJID(r.PathValue("jid"))
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    limit := 20
+    if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+        limit = n
+    }
+
+    summary, err := admin.DB.GetChatReceiptSummary(chat)
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    sent, err := admin.DB.ListSentMessages(chat, limit)
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, map[string]any{
+        "summary":  summary,
+        "seen":     summary.HasSeenLastReply(),
+        "messages": sent,
+    })
+}
+
+func (admin *RIVAClientAdmin) messageReceipts(w http.ResponseWriter, r *http.Request) {
+    sm, found, err := admin.DB.GetSentMessage(r.PathValue("id"))
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    if !found {
+        admin.writeError(w, http.StatusNotFound, errors.New("no sent message with this id"))
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, sm)
+}
+
+func (admin *RIVAClientAdmin) processedMessage(w http.ResponseWriter, r *http.Request) {
+    chat, err := ParseRecipientJID(r.PathValue("jid"))
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    pm, found, err := admin.DB.GetProcessedMessage(chat, r.PathValue("id"))
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    if !found {
+        admin.writeError(w, http.StatusNotFound, errors.New("no processed state for this message, it was never seen or has expired"))
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, map[string]any{
+        "message":    pm,
+        "expires_at": pm.ExpiresAt(),
+    })
+}
+
+func (admin *RIVAClientAdmin) exportFormSubmissions(w http.ResponseWriter, r *http.Request) {
+    form, found := FindForm(r.PathValue("id"))
+    if !found {
+        admin.writeError(w, http.StatusNotFound, errors.New("no form with this id"))
+        return
+    }
+
+    submissions, err := admin.DB.ListFormSubmissions(form.ID)
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", form.ID + "-submissions.csv"))
+    if err := WriteFormSubmissionsCSV(w, form, submissions); err != nil {
+        admin.Log.Warnf("Failed to write submissions of form %s: %v", form.ID, err)
+    }
+}
+
+func (admin *RIVAClientAdmin) listContacts(w http.ResponseWriter, r *http.Request) {
+    tag := r.URL.Query().Get("tag")
+    if tag != "" {
+        normalized, err := NormalizeContactTag(tag)
+        if err != nil {
+            admin.writeError(w, http.StatusBadRequest, err)
+            return
+        }
+
+        tag = normalized
+    }
+
+    limit := 100
+    if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+        limit = n
+    }
+
+    contacts, err := admin.DB.ListContacts(tag, r.URL.Query().Get("q"), limit)
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, contacts)
+}
+
+func (admin *RIVAClientAdmin) getContact(w http.ResponseWriter, r *http.Request) {
+    jid, err := ParseRecipientJID(r.PathValue("jid"))
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    contact, found, err := admin.DB.GetContact(jid)
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    if !found {
+        admin.writeError(w, http.StatusNotFound, errors.New("no contact with this jid"))
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, contact)
+}
+
+type rivaContactTagsRequest struct {
+    Tags []string `json:"tags"` // Tags to add to the contact
+}
+
+func (admin *RIVAClientAdmin) tagContact(w http.ResponseWriter, r *http.Request) {
+    jid, err := ParseRecipientJID(r.PathValue("jid"))
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    var req rivaContactTagsRequest
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1 << 20)).Decode(&req); err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    tags, err := NormalizeContactTags(req.Tags)
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    if err := admin.DB.AddContactTags(jid, tags); err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (admin *RIVAClientAdmin) untagContact(w http.ResponseWriter, r *http.Request) {
+    jid, err := ParseRecipientJID(r.PathValue("jid"))
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    tag, err := NormalizeContactTag(r.PathValue("tag"))
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    if err := admin.DB.RemoveContactTags(jid, []string{tag}); err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (admin *RIVAClientAdmin) listLabels(w http.ResponseWriter, r *http.Request) {
+    labels, err := admin.DB.ListLabels(r.URL.Query().Get("all") == "true")
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, labels)
+}
+
+func (admin *RIVAClientAdmin) findLabel(w http.ResponseWriter, nameOrID string) (RIVALabel, bool) {
+    label, found, err := FindLabel(admin.DB, nameOrID)
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return RIVALabel{}, false
+    }
+
+    if !found {
+        admin.writeError(w, http.StatusNotFound, errors.New("no label with this name or id"))
+        return RIVALabel{}, false
+    }
+
+    return label, true
+}
+
+func (admin *RIVAClientAdmin) labeledChats(w http.ResponseWriter, r *http.Request) {
+    label, ok := admin.findLabel(w, r.PathValue("label"))
+    if !ok {
+        return
+    }
+
+    chats, err := admin.DB.ListLabeledChats(label.ID)
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, chats)
+}
+
+func (admin *RIVAClientAdmin) labeledMessages(w http.ResponseWriter, r *http.Request) {
+    label, ok := admin.findLabel(w, r.PathValue("label"))
+    if !ok {
+        return
+    }
+
+    messages, err := admin.DB.ListLabeledMessages(label.ID)
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, messages)
+}
+
+func (admin *RIVAClientAdmin) chatLabels(w http.ResponseWriter, r *http.Request) {
+    chat, err := ParseRecipientJID(r.PathValue("jid"))
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    labels, err := admin.DB.ListChatLabels(chat)
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, labels)
+}
+
+type rivaChatLabelRequest struct {
+    Label string `json:"label"` // Name or ID of an existing label
+}
+
+func (admin *RIVAClientAdmin) labelChat(w http.ResponseWriter, r *http.Request) {
+    chat, err := ParseRecipientJID(r.PathValue("jid"))
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    var req rivaChatLabelRequest
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1 << 20)).Decode(&req); err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    label, ok := admin.findLabel(w, req.Label)
+    if !ok {
+        return
+    }
+
+    if err := admin.RClient.LabelChat(chat, label.ID, true); err != nil {
+        admin.writeError(w, http.StatusBadGateway, err)
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (admin *RIVAClientAdmin) unlabelChat(w http.ResponseWriter, r *http.Request) {
+    chat, err := ParseRecipientJID(r.PathValue("jid"))
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    label, ok := admin.findLabel(w, r.PathValue("label"))
+    if !ok {
+        return
+    }
+
+    if err := admin.RClient.LabelChat(chat, label.ID, false); err != nil {
+        admin.writeError(w, http.StatusBadGateway, err)
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (admin *RIVAClientAdmin) slaReport(w http.ResponseWriter, r *http.Request) {
+    weeks := 4
+    if n, err := strconv.Atoi(r.URL.Query().Get("weeks")); err == nil && n > 0 {
+        weeks = n
+    }
+
+    stats, err := WeeklySLAStats(admin.DB, weeks, time.Now())
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, map[string]any{
+        "sla_minutes": rBotSLAMinutes,
+        "weeks":       stats,
+    })
+}
+
+func (admin *RIVAClientAdmin) listAudit(w http.ResponseWriter, r *http.Request) {
+    limit := 100
+    if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+        limit = n
+    }
+
+    entries, err := admin.DB.ListOperatorAudit(limit)
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, entries)
+}
+
+func (admin *RIVAClientAdmin) listHandovers(w http.ResponseWriter, r *http.Request) {
+    handovers, err := admin.DB.ListHandovers(time.Now())
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, handovers)
+}
+
+func (admin *RIVAClientAdmin) resolveHandover(w http.ResponseWriter, r *http.Request) {
+    jid, err := ParseRecipientJID(r.PathValue("jid"))
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    resolved, err := admin.DB.ResolveHandover(jid, time.Now())
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    if !resolved {
+        admin.writeError(w, http.StatusNotFound, errors.New("no active handover for this jid"))
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
+
+type rivaAwayRequest struct {
+    Message string `json:"message"` // Away reply, away_message if empty
+    Until   string `json:"until"`   // Any format accepted by ParseScheduleTime, or empty
+}
+
+func (admin *RIVAClientAdmin) getAway(w http.ResponseWriter, r *http.Request) {
+    away, found, err := admin.DB.GetAwayMode()
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    active := found && away.IsActive(time.Now())
+    response := map[string]any{"active": active}
+    if active {
+        response["away"] = away
+        response["reply"] = away.Text()
+    }
+
+    admin.writeJSON(w, http.StatusOK, response)
+}
+
+func (admin *RIVAClientAdmin) setAway(w http.ResponseWriter, r *http.Request) {
+    var req rivaAwayRequest
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1 << 20)).Decode(&req); err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    away, err := NewAwayMode(req.Until, req.Message, "api", time.Now())
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    if err := admin.DB.SetAwayMode(away); err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    admin.Log.Infof("Away mode switched on via API")
+    admin.writeJSON(w, http.StatusOK, away)
+}
+
+func (admin *RIVAClientAdmin) clearAway(w http.ResponseWriter, r *http.Request) {
+    cleared, err := admin.DB.ClearAwayMode()
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    if !cleared {
+        admin.writeError(w, http.StatusNotFound, errors.New("away mode is not on"))
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (admin *RIVAClientAdmin) listBlocked(w http.ResponseWriter, r *http.Request) {
+    blocked, err := admin.DB.ListBlockedContacts()
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, blocked)
+}
+
+func (admin *RIVAClientAdmin) unblockContact(w http.ResponseWriter, r *http.Request) {
+    jid, err := ParseRecipientJID(r.PathValue("jid"))
+    if err != nil {
+        admin.writeError(w, http.StatusBadRequest, err)
+        return
+    }
+
+    if err := admin.RClient.UnblockContact(jid); err != nil {
+        admin.writeError(w, http.StatusBadGateway, err)
+        return
+    }
+
+    admin.Log.Infof("Unblocked %s via API", jid)
+    w.WriteHeader(http.StatusNoContent)
+}
+
+func (admin *RIVAClientAdmin) listFloodEvents(w http.ResponseWriter, r *http.Request) {
+    limit := 100
+    if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+        limit = n
+    }
+
+    floodEvents, err := admin.DB.ListFloodEvents(limit)
+    if err != nil {
+        admin.writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+
+    admin.writeJSON(w, http.StatusOK, floodEvents)
+}
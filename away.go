@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// Setting that holds the away mode as JSON while it is on.
+const rBotSettingAwayMode = "away_mode"
+
+/*
+ * While away mode is on, contacts who message us get the away reply instead
+ * of the greeting, at most once per away_cooldown hours. It is stored in the
+ * database so it survives restarts and can be switched from the control
+ * group, the CLI or the admin API alike.
+ */
+type RIVAAwayMode struct {
+    Message string    `json:"message"`         // Sent to contacts, away_message if empty
+    Until   time.Time `json:"until,omitzero"`  // When away mode ends by itself, zero if it does not
+    SetBy   string    `json:"set_by"`          // Who switched it on
+    SetAt   time.Time `json:"set_at"`          // When it was switched on
+}
+
+func (a RIVAAwayMode) IsActive(now time.Time) bool {
+    return a.Until.IsZero() || now.Before(a.Until)
+}
+
+func (a RIVAAwayMode) Text() string {
+    if a.Message != "" {
+        return a.Message
+    }
+
+    return rBotAwayMessage
+}
+
+// Builds an away mode ending at until, which takes the same forms as
+// scheduled messages, or never if until is empty.
+func NewAwayMode(until string, message string, setBy string, now time.Time) (RIVAAwayMode, error) {
+    away := RIVAAwayMode{Message: strings.TrimSpace(message), SetBy: setBy, SetAt: now}
+    if strings.TrimSpace(until) == "" {
+        return away, nil
+    }
+
+    end, err := ParseScheduleTime(until, now)
+    if err != nil {
+        return RIVAAwayMode{}, err
+    }
+
+    if !end.After(now) {
+        return RIVAAwayMode{}, fmt.Errorf("end time %s is in the past", formatCLITime(end))
+    }
+
+    away.Until = end
+    return away, nil
+}
+
+/*
+ * Parses the arguments of "/away on", an optional end time followed by the
+ * away message:
+ *
+ *   until 18:00 Back at 6pm!
+ *   until 2025-06-02 09:00
+ *   Out for the day, we will reply tomorrow.
+ *
+ * Times take the same forms as /later.
+ */
+func ParseAwayCommand(args string, setBy string, now time.Time) (RIVAAwayMode, error) {
+    keyword, rest := cutToken(args)
+    if !strings.EqualFold(keyword, "until") {
+        return NewAwayMode("", args, setBy, now)
+    }
+
+    when, rest := cutToken(rest)
+    if _, err := time.Parse("2006-01-02", when); err == nil {
+        clock, remainder := cutToken(rest)
+        when, rest = when + " " + clock, remainder
+    }
+
+    return NewAwayMode(when, rest, setBy, now)
+}
+
+func DescribeAwayMode(away RIVAAwayMode, found bool, now time.Time) string {
+    if !found || !away.IsActive(now) {
+        return "Away mode is off."
+    }
+
+    status := "Away mode is on"
+    if !away.Until.IsZero() {
+        status += " until " + formatCLITime(away.Until)
+    }
+
+    return status + ", contacts get this reply:\n\n" + away.Text()
+}
+
+func (rc *RIVAClient) ActiveAwayMode(now time.Time) (RIVAAwayMode, bool) {
+    away, found, err := rc.DB.GetAwayMode()
+    if err != nil || !found || !away.IsActive(now) {
+        return RIVAAwayMode{}, false
+    }
+
+    return away, true
+}
+
+// Sends the away reply unless the contact already got one within the cooldown.
+func (rc *RIVAClient) SendAwayReply(recipientJID types.JID, away RIVAAwayMode, at time.Time) error {
+    lastReply, found, err := rc.DB.GetAwayReplyTime(recipientJID)
+    if err != nil {
+        return err
+    }
+
+    cooldown := time.Duration(rBotAwayCooldownHours * float64(time.Hour))
+    if found && at.Sub(lastReply) < cooldown {
+        rc.Log.Infof("Away reply to %s was sent at %s, within the cooldown", recipientJID, lastReply.Format(time.RFC3339))
+        return nil
+    }
+
+    payload := &waE2E.Message{Conversation: proto.String(away.Text())}
+    if _, err := rc.SendAutomatedMessage(recipientJID, payload, SentAway); err != nil {
+        rc.Log.Errorf("Failed to send away reply to %s: %v", recipientJID, err)
+        return err
+    }
+
+    rc.Log.Infof("Away reply sent to %s", recipientJID)
+    return rc.DB.SetAwayReplyTime(recipientJID, at)
+}
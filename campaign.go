@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+type RIVACampaignStatus string
+const (
+    CampaignDraft     RIVACampaignStatus = "DRAFT"
+    CampaignRunning   RIVACampaignStatus = "RUNNING"
+    CampaignPaused    RIVACampaignStatus = "PAUSED"
+    CampaignCompleted RIVACampaignStatus = "COMPLETED"
+    CampaignCancelled RIVACampaignStatus = "CANCELLED"
+)
+
+type RIVACampaignRecipientStatus string
+const (
+    RecipientQueued    RIVACampaignRecipientStatus = "QUEUED"
+    RecipientSent      RIVACampaignRecipientStatus = "SENT"
+    RecipientDelivered RIVACampaignRecipientStatus = "DELIVERED"
+    RecipientRead      RIVACampaignRecipientStatus = "READ"
+    RecipientFailed    RIVACampaignRecipientStatus = "FAILED"
+)
+
+type RIVACampaign struct {
+    ID        int64              `json:"id"`                   // Unique ID of the campaign
+    Name      string             `json:"name"`                 // Name shown to operators
+    Template  string             `json:"template"`             // Text with {column} placeholders
+    MediaPath string             `json:"media_path,omitempty"` // Media sent with the template as caption
+    Status    RIVACampaignStatus `json:"status"`               // Current status
+    CreatedAt time.Time          `json:"created_at"`           // When it was created
+    UpdatedAt time.Time          `json:"updated_at"`           // When the status last changed
+}
+
+type RIVACampaignRecipient struct {
+    CampaignID int64                       // Campaign the recipient belongs to
+    JID        types.JID                   // WhatsApp JID derived from the phone number
+    Phone      string                      // Phone number in +<country><number> form
+    Variables  map[string]string           // CSV columns of the row, by lowercase header
+    Status     RIVACampaignRecipientStatus // Delivery status
+    MessageID  string                      // ID of the sent message, if any
+    Error      string                      // Reason for failure, if any
+    UpdatedAt  time.Time                   // When the status last changed
+}
+
+type RIVACampaignReport struct {
+    Campaign RIVACampaign                        `json:"campaign"`
+    Total    int                                 `json:"total"`
+    Counts   map[RIVACampaignRecipientStatus]int `json:"counts"`
+    ReadRate float64                             `json:"read_rate"` // Share of sent messages that were read
+}
+
+var rBotTemplatePlaceholder = regexp.MustCompile(`\{([a-z0-9_]+)\}`)
+
+// Columns that may hold the recipient's number, in order of preference.
+var rBotCampaignPhoneColumns = []string{"phone", "number", "mobile", "whatsapp", "jid"}
+
+func RenderCampaignTemplate(template string, variables map[string]string) string {
+    return rBotTemplatePlaceholder.ReplaceAllStringFunc(template, func(match string) string {
+        return variables[match[1:len(match)-1]]
+    })
+}
+
+/*
+ * The first row must be a header. One of the phone columns identifies the
+ * recipient and every column, including the phone, can be used in the
+ * template as {column}. Placeholders without a matching column are rejected
+ * here rather than sending "Hi {nmae}" to a few hundred people.
+ */
+func ParseCampaignCSV(r io.Reader, template string) ([]RIVACampaignRecipient, error) {
+    reader := csv.NewReader(r)
+    reader.TrimLeadingSpace = true
+
+    header, err := reader.Read()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read CSV header: %w", err)
+    }
+
+    columns := make(map[string]int)
+    for i, name := range header {
+        columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+    }
+
+    phoneColumn := ""
+    for _, name := range rBotCampaignPhoneColumns {
+        if _, found := columns[name]; found {
+            phoneColumn = name
+            break
+        }
+    }
+
+    if phoneColumn == "" {
+        return nil, fmt.Errorf("CSV needs one of the columns %s", strings.Join(rBotCampaignPhoneColumns, ", "))
+    }
+
+    for _, match := range rBotTemplatePlaceholder.FindAllStringSubmatch(template, -1) {
+        if _, found := columns[match[1]]; !found {
+            return nil, fmt.Errorf("template placeholder {%s} has no matching CSV column", match[1])
+        }
+    }
+
+    recipients := make([]RIVACampaignRecipient, 0)
+    seen := make(map[types.JID]bool)
+    for line := 2; ; line++ {
+        record, err := reader.Read()
+        if err == io.EOF {
+            break
+        }
+
+        if err != nil {
+            return nil, fmt.Errorf("failed to read CSV line %d: %w", line, err)
+        }
+
+        variables := make(map[string]string)
+        for name, i := range columns {
+            if i < len(record) {
+                variables[name] = strings.TrimSpace(record[i])
+            }
+        }
+
+        jid, err := ParseRecipientJID(variables[phoneColumn])
+        if err != nil {
+            return nil, fmt.Errorf("CSV line %d: %w", line, err)
+        }
+
+        if jid.Server != types.DefaultUserServer {
+            return nil, fmt.Errorf("CSV line %d: %s is not a phone number", line, jid)
+        }
+
+        if seen[jid] {
+            continue
+        }
+        seen[jid] = true
+
+        recipients = append(recipients, RIVACampaignRecipient{
+            JID:       jid,
+            Phone:     "+" + jid.User,
+            Variables: variables,
+            Status:    RecipientQueued,
+        })
+    }
+
+    return recipients, nil
+}
+
+// Returns whether t falls within the quiet hours, which may wrap past
+// midnight (e.g. 21:00 to 09:00).
+func InCampaignQuietHours(t time.Time) bool {
+    start, errStart := time.Parse("15:04", rBotCampaignQuietHoursStart)
+    end, errEnd := time.Parse("15:04", rBotCampaignQuietHoursEnd)
+    if errStart != nil || errEnd != nil {
+        return false
+    }
+
+    t = t.In(ScheduleLocation())
+    now := t.Hour() * 60 + t.Minute()
+    from := start.Hour() * 60 + start.Minute()
+    to := end.Hour() * 60 + end.Minute()
+
+    if from <= to {
+        return now >= from && now < to
+    }
+
+    return now >= from || now < to
+}
+
+type RIVAClientCampaigner struct {
+    RClient   *RIVAClient
+    DB        *RIVAClientDB
+    Log       *RIVAClientLog
+    BatchSize int
+    media     map[int64]*waE2E.Message
+}
+
+func (*RIVAClientCampaigner) New(rClient *RIVAClient, db *RIVAClientDB) *RIVAClientCampaigner {
+    return &RIVAClientCampaigner{
+        RClient:   rClient,
+        DB:        db,
+        Log:       NewRIVAClientLog("RIVABotCampaign", "INFO"),
+        BatchSize: 20,
+        media:     make(map[int64]*waE2E.Message),
+    }
+}
+
+// Sleeps for d, returning false if the context was cancelled first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+    timer := time.NewTimer(d)
+    defer timer.Stop()
+
+    select {
+    case <-ctx.Done():
+        return false
+    case <-timer.C:
+        return true
+    }
+}
+
+/*
+ * Sends queued recipients of running campaigns one at a time, oldest campaign
+ * first. Each batch is checked with IsOnWhatsApp before sending, and every
+ * send is followed by the configured interval plus up to 50% random jitter so
+ * a campaign does not look like a burst to WhatsApp. Pausing or cancelling a
+ * campaign takes effect before the next recipient.
+ */
+func (c *RIVAClientCampaigner) Run(ctx context.Context) {
+    interval := time.Duration(rBotCampaignSendIntervalSecs * float64(time.Second))
+    idle := time.Minute
+
+    c.Log.Infof("Campaign sender started, sending every %s.", interval)
+    for {
+        wait := idle
+        if c.ready() {
+            if sent, err := c.sendNextBatch(ctx, interval); err == nil && sent {
+                wait = interval
+            }
+        }
+
+        if !sleepContext(ctx, wait) {
+            c.Log.Infof("Campaign sender stopped.")
+            return
+        }
+    }
+}
+
+func (c *RIVAClientCampaigner) ready() bool {
+    if !c.RClient.WMClient.IsConnected() || !c.RClient.WMClient.IsLoggedIn() || c.RClient.IsAutomationPaused() {
+        return false
+    }
+
+    return !InCampaignQuietHours(time.Now())
+}
+
+func (c *RIVAClientCampaigner) sendNextBatch(ctx context.Context, interval time.Duration) (bool, error) {
+    campaigns, err := c.DB.ListRunningCampaigns()
+    if err != nil || len(campaigns) == 0 {
+        return false, err
+    }
+
+    campaign := campaigns[0]
+    batch, err := c.DB.ListQueuedCampaignRecipients(campaign.ID, c.BatchSize)
+    if err != nil {
+        return false, err
+    }
+
+    if len(batch) == 0 {
+        c.Log.Infof("Campaign %d (%s) has no queued recipients left, marking as completed.", campaign.ID, campaign.Name)
+        delete(c.media, campaign.ID)
+        _, err := c.DB.SetCampaignStatus(campaign.ID, CampaignCompleted, CampaignRunning)
+        return false, err
+    }
+
+    batch, resolved := c.precheck(batch)
+    for i, recipient := range batch {
+        if i > 0 {
+            jitter := time.Duration(rand.Int64N(int64(interval / 2) + 1))
+            if !sleepContext(ctx, interval + jitter) {
+                return true, nil
+            }
+        }
+
+        current, found, err := c.DB.GetCampaign(campaign.ID)
+        if err != nil || !found || current.Status != CampaignRunning || !c.ready() {
+            return true, err
+        }
+
+        to := recipient.JID
+        if jid, found := resolved[recipient.JID]; found {
+            to = jid
+        }
+
+        c.send(campaign, recipient, to)
+    }
+
+    return true, nil
+}
+
+/*
+ * Marks recipients that are not on WhatsApp as failed and returns the rest,
+ * along with the JID WhatsApp resolved each number to. That JID can differ
+ * from the one we derived from the CSV, e.g. where a country's numbering
+ * plan changed, so results are matched by the query we sent.
+ */
+func (c *RIVAClientCampaigner) precheck(batch []RIVACampaignRecipient) ([]RIVACampaignRecipient, map[types.JID]types.JID) {
+    phones := make([]string, 0, len(batch))
+    for _, recipient := range batch {
+        phones = append(phones, "+" + recipient.JID.User)
+    }
+
+    results, err := c.RClient.WMClient.IsOnWhatsApp(phones)
+    if err != nil {
+        c.Log.Warnf("Failed to check numbers on WhatsApp, sending without pre-check: %v", err)
+        return batch, nil
+    }
+
+    registered := make(map[string]types.JID)
+    for _, result := range results {
+        if result.IsIn {
+            registered[result.Query] = result.JID
+        }
+    }
+
+    remaining := make([]RIVACampaignRecipient, 0, len(batch))
+    resolved := make(map[types.JID]types.JID)
+    for _, recipient := range batch {
+        if jid, found := registered["+" + recipient.JID.User]; found {
+            remaining = append(remaining, recipient)
+            resolved[recipient.JID] = jid
+            continue
+        }
+
+        c.Log.Infof("Campaign %d: %s is not on WhatsApp", recipient.CampaignID, recipient.Phone)
+        c.DB.UpdateCampaignRecipient(recipient.CampaignID, recipient.JID, RecipientFailed, "", "not on WhatsApp")
+    }
+
+    return remaining, resolved
+}
+
+// Sends to the JID to, keeping the recipient's own JID for its status.
+func (c *RIVAClientCampaigner) send(campaign RIVACampaign, recipient RIVACampaignRecipient, to types.JID) {
+    payload, err := c.buildPayload(campaign, RenderCampaignTemplate(campaign.Template, recipient.Variables))
+    if err != nil {
+        c.Log.Errorf("Failed to build campaign %d message: %v", campaign.ID, err)
+        c.DB.UpdateCampaignRecipient(campaign.ID, recipient.JID, RecipientFailed, "", err.Error())
+        return
+    }
+
+    resp, err := c.RClient.SendAutomatedMessage(to, payload, SentCampaign)
+    if err != nil {
+        reason := err.Error()
+        if errors.Is(err, ErrRecipientSuppressed) {
+            reason = "opted out"
+        } else {
+            c.Log.Errorf("Failed to send campaign %d message to %s: %v", campaign.ID, to, err)
+        }
+
+        c.DB.UpdateCampaignRecipient(campaign.ID, recipient.JID, RecipientFailed, "", reason)
+        return
+    }
+
+    c.Log.Infof("Campaign %d: sent message %s to %s", campaign.ID, resp.ID, to)
+    c.DB.UpdateCampaignRecipient(campaign.ID, recipient.JID, RecipientSent, resp.ID, "")
+}
+
+// Media is uploaded once per campaign and reused with a per-recipient caption.
+func (c *RIVAClientCampaigner) buildPayload(campaign RIVACampaign, text string) (*waE2E.Message, error) {
+    if campaign.MediaPath == "" {
+        return &waE2E.Message{Conversation: proto.String(text)}, nil
+    }
+
+    uploaded, found := c.media[campaign.ID]
+    if !found {
+        var err error
+        if uploaded, err = c.RClient.BuildMediaMessage(campaign.MediaPath, ""); err != nil {
+            return nil, err
+        }
+
+        c.media[campaign.ID] = uploaded
+    }
+
+    payload := proto.Clone(uploaded).(*waE2E.Message)
+    switch {
+    case payload.ImageMessage != nil:
+        payload.ImageMessage.Caption = proto.String(text)
+    case payload.VideoMessage != nil:
+        payload.VideoMessage.Caption = proto.String(text)
+    case payload.DocumentMessage != nil:
+        payload.DocumentMessage.Caption = proto.String(text)
+    }
+
+    return payload, nil
+}
+
+var rBotCampaignActions = map[string]struct {
+    to   RIVACampaignStatus
+    from []RIVACampaignStatus
+}{
+    "start":  {CampaignRunning, []RIVACampaignStatus{CampaignDraft, CampaignPaused}},
+    "pause":  {CampaignPaused, []RIVACampaignStatus{CampaignRunning}},
+    "cancel": {CampaignCancelled, []RIVACampaignStatus{CampaignDraft, CampaignRunning, CampaignPaused}},
+}
+
+// Applies start, pause or cancel to a campaign. Shared by the CLI and the
+// admin API.
+func ApplyCampaignAction(db *RIVAClientDB, id int64, action string) error {
+    transition, found := rBotCampaignActions[action]
+    if !found {
+        return fmt.Errorf("unknown campaign action %q", action)
+    }
+
+    changed, err := db.SetCampaignStatus(id, transition.to, transition.from...)
+    if err != nil {
+        return err
+    }
+
+    if !changed {
+        return fmt.Errorf("campaign %d cannot be moved to %s from its current status", id, transition.to)
+    }
+
+    db.Log.Infof("Campaign %d is now %s", id, transition.to)
+    return nil
+}
+
+func CreateCampaign(db *RIVAClientDB, name string, template string, mediaPath string, audience io.Reader) (int64, int, error) {
+    if strings.TrimSpace(name) == "" || strings.TrimSpace(template) == "" {
+        return 0, 0, fmt.Errorf("campaign name and template are required")
+    }
+
+    recipients, err := ParseCampaignCSV(audience, template)
+    if err != nil {
+        return 0, 0, err
+    }
+
+    if len(recipients) == 0 {
+        return 0, 0, fmt.Errorf("audience is empty")
+    }
+
+    id, err := db.InsertCampaign(RIVACampaign{Name: name, Template: template, MediaPath: mediaPath}, recipients)
+    return id, len(recipients), err
+}
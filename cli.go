@@ -0,0 +1,848 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const rBotCLIUsage = `Usage:
+  rivabot                                  run the bot
+  rivabot schedule add -to <jid|number> -at <time> [-every daily|weekly] [-cron <expr>] [-text <text>] [-media <path>]
+  rivabot schedule list [-all]
+  rivabot schedule cancel <id>
+  rivabot campaign create -name <name> -csv <file> (-template <text> | -template-file <file>) [-media <path>]
+  rivabot campaign list
+  rivabot campaign report <id>
+  rivabot campaign start|pause|cancel <id>
+  rivabot receipts chat <jid|number> [-n <count>]
+  rivabot receipts message <id>
+  rivabot processed show <jid|number> <message id>
+  rivabot forms list
+  rivabot forms export <form id> [-o <file>]
+  rivabot contacts list [-tag <tag>] [-q <search>] [-n <count>]
+  rivabot contacts show <jid|number>
+  rivabot contacts tag|untag <jid|number> <tag>...
+  rivabot labels list [-all]
+  rivabot labels chats|messages <label>
+  rivabot labels of <jid|number>
+  rivabot sla report [-weeks <count>]
+  rivabot audit list [-n <count>]
+  rivabot handover list
+  rivabot handover resolve <jid|number>
+  rivabot away status
+  rivabot away on [-until <time>] [-message <text>]
+  rivabot away off
+  rivabot blocklist list
+  rivabot flood list [-n <count>]
+
+Times: +30m, +2h, +1d, 18:30, "2025-06-01 18:30" or RFC 3339.
+`
+
+/*
+ * Operator commands that only touch the database. They run against the same
+ * database file as the bot, so a running bot picks up changes on its next
+ * scheduler tick.
+ */
+func RunCLI(dbConn *sql.DB, args []string) error {
+    if len(args) < 2 {
+        fmt.Fprint(os.Stderr, rBotCLIUsage)
+        return fmt.Errorf("unknown command %q", strings.Join(args, " "))
+    }
+
+    db := (*RIVAClientDB).New(nil, nil, dbConn)
+
+    switch args[0] + " " + args[1] {
+    case "schedule add":
+        return cliScheduleAdd(db, args[2:])
+    case "schedule list":
+        return cliScheduleList(db, args[2:])
+    case "schedule cancel":
+        return cliScheduleCancel(db, args[2:])
+    case "campaign create":
+        return cliCampaignCreate(db, args[2:])
+    case "campaign list":
+        return cliCampaignList(db)
+    case "campaign report":
+        return cliCampaignReport(db, args[2:])
+    case "campaign start", "campaign pause", "campaign cancel":
+        return cliCampaignAction(db, args[1], args[2:])
+    case "receipts chat":
+        return cliReceiptsChat(db, args[2:])
+    case "receipts message":
+        return cliReceiptsMessage(db, args[2:])
+    case "processed show":
+        return cliProcessedShow(db, args[2:])
+    case "forms list":
+        return cliFormsList()
+    case "forms export":
+        return cliFormsExport(db, args[2:])
+    case "contacts list":
+        return cliContactsList(db, args[2:])
+    case "contacts show":
+        return cliContactsShow(db, args[2:])
+    case "contacts tag", "contacts untag":
+        return cliContactsTag(db, args[1], args[2:])
+    case "labels list":
+        return cliLabelsList(db, args[2:])
+    case "labels chats":
+        return cliLabelsChats(db, args[2:])
+    case "labels messages":
+        return cliLabelsMessages(db, args[2:])
+    case "labels of":
+        return cliLabelsOf(db, args[2:])
+    case "sla report":
+        return cliSLAReport(db, args[2:])
+    case "audit list":
+        return cliAuditList(db, args[2:])
+    case "handover list":
+        return cliHandoverList(db)
+    case "handover resolve":
+        return cliHandoverResolve(db, args[2:])
+    case "away status":
+        return cliAwayStatus(db)
+    case "away on":
+        return cliAwayOn(db, args[2:])
+    case "away off":
+        return cliAwayOff(db)
+    case "blocklist list":
+        return cliBlocklistList(db)
+    case "flood list":
+        return cliFloodList(db, args[2:])
+    }
+
+    fmt.Fprint(os.Stderr, rBotCLIUsage)
+    return fmt.Errorf("unknown command %q", strings.Join(args[:2], " "))
+}
+
+func parseIDArg(args []string, usage string) (int64, error) {
+    if len(args) != 1 {
+        return 0, fmt.Errorf("usage: %s <id>", usage)
+    }
+
+    id, err := strconv.ParseInt(args[0], 10, 64)
+    if err != nil {
+        return 0, fmt.Errorf("invalid id %q", args[0])
+    }
+
+    return id, nil
+}
+
+func cliScheduleAdd(db *RIVAClientDB, args []string) error {
+    fs := flag.NewFlagSet("schedule add", flag.ContinueOnError)
+    to := fs.String("to", "", "recipient JID or phone number")
+    at := fs.String("at", "", "when to send")
+    every := fs.String("every", "", "repeat daily or weekly")
+    cron := fs.String("cron", "", "repeat on a 5-field cron expression")
+    text := fs.String("text", "", "message text, or caption for media")
+    media := fs.String("media", "", "path to an image, video or document")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    recipient, err := ParseRecipientJID(*to)
+    if err != nil {
+        return err
+    }
+
+    recurrence := *every
+    if *cron != "" {
+        if recurrence != "" {
+            return fmt.Errorf("-every and -cron cannot be combined")
+        }
+
+        recurrence = RecurrenceCron + *cron
+    }
+
+    var sendAt time.Time
+    if *at != "" {
+        if sendAt, err = ParseScheduleTime(*at, time.Now()); err != nil {
+            return err
+        }
+    }
+
+    sm, err := NewScheduledMessage(recipient, sendAt, recurrence, *text, *media, "cli")
+    if err != nil {
+        return err
+    }
+
+    id, err := db.InsertScheduledMessage(sm)
+    if err != nil {
+        return err
+    }
+
+    fmt.Printf("Scheduled message %d to %s at %s\n", id, sm.RecipientJID, sm.SendAt.In(ScheduleLocation()).Format(time.RFC3339))
+    return nil
+}
+
+func cliScheduleList(db *RIVAClientDB, args []string) error {
+    fs := flag.NewFlagSet("schedule list", flag.ContinueOnError)
+    all := fs.Bool("all", false, "include sent, cancelled, failed and missed messages")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    scheduled, err := db.ListScheduledMessages(*all)
+    if err != nil {
+        return err
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "ID\tSTATUS\tSEND AT\tREPEAT\tTO\tCONTENT")
+    for _, sm := range scheduled {
+        content := sm.Content
+        if sm.MediaPath != "" {
+            content = fmt.Sprintf("[%s] %s", sm.MediaPath, content)
+        }
+
+        if runes := []rune(content); len(runes) > 40 {
+            content = string(runes[:37]) + "..."
+        }
+
+        fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+                    sm.ID,
+                    sm.Status,
+                    sm.SendAt.In(ScheduleLocation()).Format("2006-01-02 15:04"),
+                    sm.Recurrence,
+                    sm.RecipientJID,
+                    strings.ReplaceAll(content, "\n", " "))
+    }
+
+    return w.Flush()
+}
+
+func cliScheduleCancel(db *RIVAClientDB, args []string) error {
+    id, err := parseIDArg(args, "schedule cancel")
+    if err != nil {
+        return err
+    }
+
+    cancelled, err := db.CancelScheduledMessage(id)
+    if err != nil {
+        return err
+    }
+
+    if !cancelled {
+        return fmt.Errorf("no pending scheduled message with id %d", id)
+    }
+
+    fmt.Printf("Cancelled scheduled message %d\n", id)
+    return nil
+}
+
+func cliCampaignCreate(db *RIVAClientDB, args []string) error {
+    fs := flag.NewFlagSet("campaign create", flag.ContinueOnError)
+    name := fs.String("name", "", "campaign name")
+    csvPath := fs.String("csv", "", "audience CSV with a phone column")
+    template := fs.String("template", "", "message template with {column} placeholders")
+    templateFile := fs.String("template-file", "", "file containing the message template")
+    media := fs.String("media", "", "path to an image, video or document")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    if *templateFile != "" {
+        data, err := os.ReadFile(*templateFile)
+        if err != nil {
+            return err
+        }
+
+        *template = strings.TrimRight(string(data), "\n")
+    }
+
+    if *media != "" {
+        if _, err := os.Stat(*media); err != nil {
+            return fmt.Errorf("media file: %w", err)
+        }
+    }
+
+    audience, err := os.Open(*csvPath)
+    if err != nil {
+        return err
+    }
+    defer audience.Close()
+
+    id, count, err := CreateCampaign(db, *name, *template, *media, audience)
+    if err != nil {
+        return err
+    }
+
+    fmt.Printf("Created campaign %d with %d recipients. Start it with: campaign start %d\n", id, count, id)
+    return nil
+}
+
+func cliCampaignList(db *RIVAClientDB) error {
+    campaigns, err := db.ListCampaigns()
+    if err != nil {
+        return err
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "ID\tSTATUS\tCREATED\tNAME")
+    for _, c := range campaigns {
+        fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", c.ID, c.Status, c.CreatedAt.In(ScheduleLocation()).Format("2006-01-02 15:04"), c.Name)
+    }
+
+    return w.Flush()
+}
+
+func cliCampaignReport(db *RIVAClientDB, args []string) error {
+    id, err := parseIDArg(args, "campaign report")
+    if err != nil {
+        return err
+    }
+
+    report, found, err := db.GetCampaignReport(id)
+    if err != nil {
+        return err
+    }
+
+    if !found {
+        return fmt.Errorf("no campaign with id %d", id)
+    }
+
+    fmt.Printf("Campaign %d: %s (%s)\n", report.Campaign.ID, report.Campaign.Name, report.Campaign.Status)
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    for _, status := range []RIVACampaignRecipientStatus{RecipientQueued, RecipientSent, RecipientDelivered, RecipientRead, RecipientFailed} {
+        percent := 0.0
+        if report.Total > 0 {
+            percent = 100 * float64(report.Counts[status]) / float64(report.Total)
+        }
+
+        fmt.Fprintf(w, "%s\t%d\t%.1f%%\n", status, report.Counts[status], percent)
+    }
+    fmt.Fprintf(w, "TOTAL\t%d\t\n", report.Total)
+    fmt.Fprintf(w, "READ RATE\t\t%.1f%%\n", 100 * report.ReadRate)
+
+    return w.Flush()
+}
+
+func cliCampaignAction(db *RIVAClientDB, action string, args []string) error {
+    id, err := parseIDArg(args, "campaign " + action)
+    if err != nil {
+        return err
+    }
+
+    return ApplyCampaignAction(db, id, action)
+}
+
+func formatCLITime(t time.Time) string {
+    if t.IsZero() {
+        return "-"
+    }
+
+    return t.In(ScheduleLocation()).Format("2006-01-02 15:04")
+}
+
+func printSentMessages(sent []RIVASentMessage) error {
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "ID\tKIND\tSTATUS\tSENT\tDELIVERED\tREAD")
+    for _, sm := range sent {
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", sm.MessageID, sm.Kind, sm.Status, formatCLITime(sm.SentAt), formatCLITime(sm.DeliveredAt), formatCLITime(sm.ReadAt))
+    }
+
+    return w.Flush()
+}
+
+func cliReceiptsChat(db *RIVAClientDB, args []string) error {
+    fs := flag.NewFlagSet("receipts chat", flag.ContinueOnError)
+    count := fs.Int("n", 10, "number of recent messages to show")
+    if len(args) == 0 {
+        return fmt.Errorf("usage: receipts chat <jid|number> [-n <count>]")
+    }
+
+    if err := fs.Parse(args[1:]); err != nil {
+        return err
+    }
+
+    chat, err := ParseRecipientJID(args[0])
+    if err != nil {
+        return err
+    }
+
+    summary, err := db.GetChatReceiptSummary(chat)
+    if err != nil {
+        return err
+    }
+
+    sent, err := db.ListSentMessages(chat, *count)
+    if err != nil {
+        return err
+    }
+
+    fmt.Printf("%s: %d sent, %d delivered, %d read, %d played. Last reply seen: %t\n",
+               chat,
+               summary.Counts[ReceiptSent],
+               summary.Counts[ReceiptDelivered],
+               summary.Counts[ReceiptRead],
+               summary.Counts[ReceiptPlayed],
+               summary.HasSeenLastReply())
+
+    return printSentMessages(sent)
+}
+
+func cliReceiptsMessage(db *RIVAClientDB, args []string) error {
+    if len(args) != 1 {
+        return fmt.Errorf("usage: receipts message <id>")
+    }
+
+    sm, found, err := db.GetSentMessage(args[0])
+    if err != nil {
+        return err
+    }
+
+    if !found {
+        return fmt.Errorf("no sent message with id %s", args[0])
+    }
+
+    fmt.Printf("Chat: %s\n", sm.ChatJID)
+    return printSentMessages([]RIVASentMessage{sm})
+}
+
+func cliProcessedShow(db *RIVAClientDB, args []string) error {
+    if len(args) != 2 {
+        return fmt.Errorf("usage: processed show <jid|number> <message id>")
+    }
+
+    chat, err := ParseRecipientJID(args[0])
+    if err != nil {
+        return err
+    }
+
+    pm, found, err := db.GetProcessedMessage(chat, args[1])
+    if err != nil {
+        return err
+    }
+
+    if !found {
+        return fmt.Errorf("no processed state for message %s in %s, it was never seen or has expired", args[1], chat)
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintf(w, "Chat\t%s\n", pm.ChatJID)
+    fmt.Fprintf(w, "Message\t%s\n", pm.MessageID)
+    fmt.Fprintf(w, "Status\t%s\n", pm.Status)
+    fmt.Fprintf(w, "First seen\t%s\n", formatCLITime(pm.FirstSeen))
+    fmt.Fprintf(w, "Processed at\t%s\n", formatCLITime(pm.ProcessedAt))
+    fmt.Fprintf(w, "Expires\t%s\n", formatCLITime(pm.ExpiresAt()))
+    return w.Flush()
+}
+
+func cliFormsList() error {
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "ID\tFIELDS\tTRIGGERS\tTITLE")
+    for _, form := range rBotForms {
+        fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", form.ID, len(form.Fields), strings.Join(form.Triggers, ", "), form.Title)
+    }
+
+    return w.Flush()
+}
+
+func cliFormsExport(db *RIVAClientDB, args []string) error {
+    if len(args) == 0 {
+        return fmt.Errorf("usage: forms export <form id> [-o <file>]")
+    }
+
+    fs := flag.NewFlagSet("forms export", flag.ContinueOnError)
+    output := fs.String("o", "", "write to this file instead of stdout")
+    if err := fs.Parse(args[1:]); err != nil {
+        return err
+    }
+
+    form, found := FindForm(args[0])
+    if !found {
+        return fmt.Errorf("no form with id %q in config.yaml", args[0])
+    }
+
+    submissions, err := db.ListFormSubmissions(form.ID)
+    if err != nil {
+        return err
+    }
+
+    out := os.Stdout
+    if *output != "" {
+        if out, err = os.Create(*output); err != nil {
+            return err
+        }
+        defer out.Close()
+    }
+
+    if err := WriteFormSubmissionsCSV(out, form, submissions); err != nil {
+        return err
+    }
+
+    if *output != "" {
+        fmt.Printf("Exported %d submissions of form %s to %s\n", len(submissions), form.ID, *output)
+    }
+
+    return nil
+}
+
+func cliContactsList(db *RIVAClientDB, args []string) error {
+    fs := flag.NewFlagSet("contacts list", flag.ContinueOnError)
+    tag := fs.String("tag", "", "only contacts with this tag")
+    search := fs.String("q", "", "only contacts whose number or name contains this")
+    count := fs.Int("n", 50, "number of contacts to show")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    if *tag != "" {
+        normalized, err := NormalizeContactTag(*tag)
+        if err != nil {
+            return err
+        }
+
+        *tag = normalized
+    }
+
+    contacts, err := db.ListContacts(*tag, *search, *count)
+    if err != nil {
+        return err
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "JID\tNAME\tIN\tOUT\tLAST SEEN\tTAGS")
+    for _, c := range contacts {
+        fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", c.JID, c.DisplayName(), c.MessagesReceived, c.MessagesSent, formatCLITime(c.LastSeen), strings.Join(c.Tags, ","))
+    }
+
+    return w.Flush()
+}
+
+func cliContactsShow(db *RIVAClientDB, args []string) error {
+    if len(args) != 1 {
+        return fmt.Errorf("usage: contacts show <jid|number>")
+    }
+
+    jid, err := ParseRecipientJID(args[0])
+    if err != nil {
+        return err
+    }
+
+    contact, found, err := db.GetContact(jid)
+    if err != nil {
+        return err
+    }
+
+    if !found {
+        return fmt.Errorf("no contact %s", jid)
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintf(w, "JID\t%s\n", contact.JID)
+    fmt.Fprintf(w, "Push name\t%s\n", contact.PushName)
+    fmt.Fprintf(w, "Saved name\t%s\n", contact.FullName)
+    fmt.Fprintf(w, "Business name\t%s\n", contact.BusinessName)
+    fmt.Fprintf(w, "First seen\t%s\n", formatCLITime(contact.FirstSeen))
+    fmt.Fprintf(w, "Last seen\t%s\n", formatCLITime(contact.LastSeen))
+    fmt.Fprintf(w, "Messages\t%d received, %d sent\n", contact.MessagesReceived, contact.MessagesSent)
+    fmt.Fprintf(w, "Tags\t%s\n", strings.Join(contact.Tags, ", "))
+    for _, name := range contact.PushNames {
+        fmt.Fprintf(w, "Known as\t%s (since %s)\n", name.Name, formatCLITime(name.FirstSeen))
+    }
+
+    return w.Flush()
+}
+
+func cliContactsTag(db *RIVAClientDB, action string, args []string) error {
+    if len(args) < 2 {
+        return fmt.Errorf("usage: contacts %s <jid|number> <tag>...", action)
+    }
+
+    jid, err := ParseRecipientJID(args[0])
+    if err != nil {
+        return err
+    }
+
+    tags, err := NormalizeContactTags(args[1:])
+    if err != nil {
+        return err
+    }
+
+    if action == "untag" {
+        return db.RemoveContactTags(jid, tags)
+    }
+
+    return db.AddContactTags(jid, tags)
+}
+
+func printLabels(labels []RIVALabel, counts bool) error {
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    if counts {
+        fmt.Fprintln(w, "ID\tNAME\tCHATS\tMESSAGES\tDELETED")
+    } else {
+        fmt.Fprintln(w, "ID\tNAME")
+    }
+
+    for _, label := range labels {
+        if counts {
+            fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%t\n", label.ID, label.Name, label.Chats, label.Messages, label.Deleted)
+        } else {
+            fmt.Fprintf(w, "%s\t%s\n", label.ID, label.Name)
+        }
+    }
+
+    return w.Flush()
+}
+
+func cliLabelsList(db *RIVAClientDB, args []string) error {
+    fs := flag.NewFlagSet("labels list", flag.ContinueOnError)
+    all := fs.Bool("all", false, "include deleted labels")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    labels, err := db.ListLabels(*all)
+    if err != nil {
+        return err
+    }
+
+    return printLabels(labels, true)
+}
+
+func findLabelArg(db *RIVAClientDB, args []string, usage string) (RIVALabel, error) {
+    if len(args) != 1 {
+        return RIVALabel{}, fmt.Errorf("usage: %s <label>", usage)
+    }
+
+    label, found, err := FindLabel(db, args[0])
+    if err != nil {
+        return RIVALabel{}, err
+    }
+
+    if !found {
+        return RIVALabel{}, fmt.Errorf("no label named %q, see labels list", args[0])
+    }
+
+    return label, nil
+}
+
+func cliLabelsChats(db *RIVAClientDB, args []string) error {
+    label, err := findLabelArg(db, args, "labels chats")
+    if err != nil {
+        return err
+    }
+
+    chats, err := db.ListLabeledChats(label.ID)
+    if err != nil {
+        return err
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "CHAT\tLABELED")
+    for _, chat := range chats {
+        fmt.Fprintf(w, "%s\t%s\n", chat.ChatJID, formatCLITime(chat.LabeledAt))
+    }
+
+    return w.Flush()
+}
+
+func cliLabelsMessages(db *RIVAClientDB, args []string) error {
+    label, err := findLabelArg(db, args, "labels messages")
+    if err != nil {
+        return err
+    }
+
+    messages, err := db.ListLabeledMessages(label.ID)
+    if err != nil {
+        return err
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "CHAT\tMESSAGE\tLABELED")
+    for _, message := range messages {
+        fmt.Fprintf(w, "%s\t%s\t%s\n", message.ChatJID, message.MessageID, formatCLITime(message.LabeledAt))
+    }
+
+    return w.Flush()
+}
+
+func cliLabelsOf(db *RIVAClientDB, args []string) error {
+    if len(args) != 1 {
+        return fmt.Errorf("usage: labels of <jid|number>")
+    }
+
+    chat, err := ParseRecipientJID(args[0])
+    if err != nil {
+        return err
+    }
+
+    labels, err := db.ListChatLabels(chat)
+    if err != nil {
+        return err
+    }
+
+    return printLabels(labels, false)
+}
+
+func cliSLAReport(db *RIVAClientDB, args []string) error {
+    fs := flag.NewFlagSet("sla report", flag.ContinueOnError)
+    weeks := fs.Int("weeks", 4, "number of weeks to show, including the current one")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    stats, err := WeeklySLAStats(db, *weeks, time.Now())
+    if err != nil {
+        return err
+    }
+
+    fmt.Printf("First response target: %.0f minutes\n", rBotSLAMinutes)
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "WEEK OF\tCONVERSATIONS\tANSWERED\tWITHIN SLA\tBREACHED\tMEDIAN\tMEAN")
+    for _, s := range stats {
+        fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.0fm\t%.0fm\n",
+                    s.From.Format("2006-01-02"), s.Conversations, s.Answered, s.WithinSLA, s.Breached, s.MedianResponseMinutes, s.MeanResponseMinutes)
+    }
+
+    return w.Flush()
+}
+
+func cliAuditList(db *RIVAClientDB, args []string) error {
+    fs := flag.NewFlagSet("audit list", flag.ContinueOnError)
+    limit := fs.Int("n", 50, "number of commands to show")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    entries, err := db.ListOperatorAudit(*limit)
+    if err != nil {
+        return err
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "ID	AT	OPERATOR	AUTHORISED	COMMAND	RESULT")
+    for _, e := range entries {
+        fmt.Fprintf(w, "%d\t%s\t%s\t%t\t%s\t%s\n", e.ID, formatCLITime(e.CreatedAt), FormatNumber(e.OperatorJID), e.Authorised, e.Command, e.Result)
+    }
+
+    return w.Flush()
+}
+
+func cliHandoverList(db *RIVAClientDB) error {
+    handovers, err := db.ListHandovers(time.Now())
+    if err != nil {
+        return err
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "CHAT	REASON	STARTED	EXPIRES")
+    for _, h := range handovers {
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", h.ChatJID, h.Reason, formatCLITime(h.StartedAt), formatCLITime(h.ExpiresAt))
+    }
+
+    return w.Flush()
+}
+
+func cliHandoverResolve(db *RIVAClientDB, args []string) error {
+    if len(args) != 1 {
+        return fmt.Errorf("usage: handover resolve <jid|number>")
+    }
+
+    jid, err := ParseRecipientJID(args[0])
+    if err != nil {
+        return err
+    }
+
+    resolved, err := db.ResolveHandover(jid, time.Now())
+    if err != nil {
+        return err
+    }
+
+    if !resolved {
+        return fmt.Errorf("no active handover for %s", jid)
+    }
+
+    fmt.Printf("Handover of %s resolved, the bot will answer the chat again.\n", jid)
+    return nil
+}
+
+func cliAwayStatus(db *RIVAClientDB) error {
+    away, found, err := db.GetAwayMode()
+    if err != nil {
+        return err
+    }
+
+    fmt.Println(DescribeAwayMode(away, found, time.Now()))
+    return nil
+}
+
+func cliAwayOn(db *RIVAClientDB, args []string) error {
+    fs := flag.NewFlagSet("away on", flag.ContinueOnError)
+    until := fs.String("until", "", "when away mode ends by itself")
+    message := fs.String("message", "", "away reply, away_message if empty")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    away, err := NewAwayMode(*until, *message, "cli", time.Now())
+    if err != nil {
+        return err
+    }
+
+    if err := db.SetAwayMode(away); err != nil {
+        return err
+    }
+
+    fmt.Println(DescribeAwayMode(away, true, time.Now()))
+    return nil
+}
+
+func cliAwayOff(db *RIVAClientDB) error {
+    cleared, err := db.ClearAwayMode()
+    if err != nil {
+        return err
+    }
+
+    if !cleared {
+        return fmt.Errorf("away mode is not on")
+    }
+
+    fmt.Println("Away mode is off.")
+    return nil
+}
+
+// Unblocking needs the WhatsApp connection, so it is only offered in the
+// control group and the admin API.
+func cliBlocklistList(db *RIVAClientDB) error {
+    blocked, err := db.ListBlockedContacts()
+    if err != nil {
+        return err
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "JID\tSOURCE\tREASON\tBLOCKED")
+    for _, b := range blocked {
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", b.JID, b.Source, b.Reason, formatCLITime(b.BlockedAt))
+    }
+
+    return w.Flush()
+}
+
+func cliFloodList(db *RIVAClientDB, args []string) error {
+    fs := flag.NewFlagSet("flood list", flag.ContinueOnError)
+    limit := fs.Int("n", 50, "number of events to show")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    floodEvents, err := db.ListFloodEvents(*limit)
+    if err != nil {
+        return err
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "ID\tAT\tJID\tREASON\tSTRIKE\tACTION\tSAMPLE")
+    for _, e := range floodEvents {
+        sample := strings.ReplaceAll(e.Sample, "\n", " ")
+        fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%s\n", e.ID, formatCLITime(e.CreatedAt), e.JID, e.Reason, e.Strike, e.Action, sample)
+    }
+
+    return w.Flush()
+}
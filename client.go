@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+    "errors"
     "fmt"
 	"time"
     "context"
@@ -15,10 +16,21 @@ import (
 	waProto "go.mau.fi/whatsmeow/binary/proto"
 )
 
+var ErrRecipientSuppressed = errors.New("recipient has opted out of automated messages")
+var ErrAutomationPaused = errors.New("automation is paused from the control group")
+
 type RIVAClient struct {
     WMClient                     *whatsmeow.Client
     Handlers                     *RIVAClientEvent
     DB                           *RIVAClientDB
+    Media                        *RIVAClientMediaStore
+    Scheduler                    *RIVAClientScheduler
+    Campaigner                   *RIVAClientCampaigner
+    Admin                        *RIVAClientAdmin
+    SLA                          *RIVAClientSLA
+    Flood                        *RIVAClientFlood
+    Transcriber                  Transcriber
+    Resolver                     *RIVAClientResolver
     Log                          *RIVAClientLog
     LastSuccessfulConnectionTime time.Time
 }
@@ -27,11 +39,19 @@ func (*RIVAClient) New(wmClient *whatsmeow.Client, db *sql.DB) *RIVAClient {
     rc := &RIVAClient{
         WMClient:                     wmClient,
         Log:                          NewRIVAClientLog("RIVABotClient", "INFO"),
+        Transcriber:                  NewTranscriber(),
         LastSuccessfulConnectionTime: time.Time{},
     }
 
-    rc.DB       = (*RIVAClientDB).New(nil, rc, db)
-    rc.Handlers = (*RIVAClientEvent).New(nil, rc, rc.DB)
+    rc.Resolver   = (*RIVAClientResolver).New(nil, rc)
+    rc.DB         = (*RIVAClientDB).New(nil, rc, db)
+    rc.Media      = (*RIVAClientMediaStore).New(nil, rc, rc.DB)
+    rc.Scheduler  = (*RIVAClientScheduler).New(nil, rc, rc.DB)
+    rc.Campaigner = (*RIVAClientCampaigner).New(nil, rc, rc.DB)
+    rc.Admin      = (*RIVAClientAdmin).New(nil, rc, rc.DB)
+    rc.SLA        = (*RIVAClientSLA).New(nil, rc, rc.DB)
+    rc.Flood      = (*RIVAClientFlood).New(nil, rc, rc.DB)
+    rc.Handlers   = (*RIVAClientEvent).New(nil, rc, rc.DB)
     return rc
 }
 
@@ -40,31 +60,141 @@ func (rc *RIVAClient) EditIncludeHeaderFooterMessage(msg RIVAClientMessage) erro
         return nil
     }
 
-    newContent := fmt.Sprintf(rBotOrgHeaderFooter, msg.Content)
+    editWindow := time.Duration(rBotEditWindowMinutes * float64(time.Minute))
+    if time.Since(msg.Timestamp) >= editWindow {
+        rc.Log.Warnf("Message id %s in chat %s is past the edit window, sending disclosure instead", msg.ID, msg.To)
+        return rc.SendDisclosureMessage(msg)
+    }
+
+    newPayload := rc.buildHeaderFooterPayload(msg)
+    if newPayload == nil {
+        rc.Log.Warnf("Cannot edit message id %s of type %s, sending disclosure instead", msg.ID, msg.Type)
+        return rc.SendDisclosureMessage(msg)
+    }
+
+    resp, err := rc.SendTrackedMessage(msg.To,
+                                       rc.WMClient.BuildEdit(msg.To,
+                                                             msg.ID,
+                                                             newPayload),
+                                       SentEdit)
+    if err != nil {
+        rc.Log.Errorf("Failed to edit message id %s in chat %s, sending disclosure instead: %v", msg.ID, msg.To, err)
+        return rc.SendDisclosureMessage(msg)
+    }
+
+    rc.Log.Infof("Successfully edited message ID %s in chat %s. New ID: %s, Timestamp: %s", msg.ID, msg.To, resp.ID, resp.Timestamp)
+    return nil
+}
+
+/*
+ * Media captions are edited by resending the full media message with the new
+ * caption, so the original attachment fields have to be carried over as-is.
+ */
+func (rc *RIVAClient) buildHeaderFooterPayload(msg RIVAClientMessage) *waE2E.Message {
+    original := unwrap(msg.RawMessage.Message)
     newPayload := &waE2E.Message{}
-    if msg.Type == TypeTextConv {
-        newPayload.Conversation = proto.String(newContent)
-    } else if msg.Type == TypeTextExt {
+
+    switch msg.Type {
+    case TypeTextConv:
+        newPayload.Conversation = proto.String(rc.formatHeaderFooter(msg, msg.Content))
+    case TypeTextExt:
         newPayload.ExtendedTextMessage = &waProto.ExtendedTextMessage{
-            Text:        proto.String(newContent),
-            ContextInfo: msg.RawMessage.Message.GetExtendedTextMessage().GetContextInfo(),
+            Text:        proto.String(rc.formatHeaderFooter(msg, msg.Content)),
+            ContextInfo: original.GetExtendedTextMessage().GetContextInfo(),
+        }
+    case TypeImage:
+        imgMsg := proto.Clone(original.GetImageMessage()).(*waE2E.ImageMessage)
+        imgMsg.Caption = proto.String(rc.formatHeaderFooter(msg, msg.Media.Caption))
+        newPayload.ImageMessage = imgMsg
+    case TypeVideo:
+        if original.GetVideoMessage() == nil {
+            return nil
         }
+
+        vidMsg := proto.Clone(original.GetVideoMessage()).(*waE2E.VideoMessage)
+        vidMsg.Caption = proto.String(rc.formatHeaderFooter(msg, msg.Media.Caption))
+        newPayload.VideoMessage = vidMsg
+    case TypeDocument:
+        docMsg := proto.Clone(original.GetDocumentMessage()).(*waE2E.DocumentMessage)
+        docMsg.Caption = proto.String(rc.formatHeaderFooter(msg, msg.Media.Caption))
+        newPayload.DocumentMessage = docMsg
+    default:
+        return nil
     }
 
-    resp, err := rc.WMClient.SendMessage(context.Background(),
-                                         msg.To,
-                                         rc.WMClient.BuildEdit(msg.To,
-                                                               msg.ID,
-                                                               newPayload))
+    return newPayload
+}
+
+/*
+ * Messages sent from a linked device we know the representative of are signed
+ * with their name. The signed template receives the content as %[1]s and the
+ * name as %[2]s; everything else uses the generic header and footer.
+ */
+func (rc *RIVAClient) formatHeaderFooter(msg RIVAClientMessage, content string) string {
+    if rBotOrgHeaderFooterSigned == "" {
+        return fmt.Sprintf(rBotOrgHeaderFooter, content)
+    }
+
+    name, found, err := rc.DB.GetRepresentative(msg.From.Device)
+    if err != nil || !found {
+        return fmt.Sprintf(rBotOrgHeaderFooter, content)
+    }
+
+    return fmt.Sprintf(rBotOrgHeaderFooterSigned, content, name)
+}
+
+// Sent as a reply to the original message when it can no longer be edited, so
+// the contact can still tell it came from a RIVA Representative.
+func (rc *RIVAClient) SendDisclosureMessage(msg RIVAClientMessage) error {
+    buildMsg := &waE2E.Message{
+        ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+            Text: proto.String(rBotOrgDisclosureMessage),
+            ContextInfo: &waE2E.ContextInfo{
+                StanzaID:      proto.String(msg.ID),
+                Participant:   proto.String(msg.From.ToNonAD().String()),
+                QuotedMessage: msg.RawMessage.Message,
+            },
+        },
+    }
+
+    resp, err := rc.SendTrackedMessage(msg.To, buildMsg, SentDisclosure)
     if err != nil {
-        rc.Log.Errorf("Failed to edit message id %s in chat %s: %v", msg.ID, msg.To, err)
+        rc.Log.Errorf("Failed to send disclosure for message id %s in chat %s: %v", msg.ID, msg.To, err)
         return err
     }
 
-    rc.Log.Infof("Successfully edited message ID %s in chat %s. New ID: %s, Timestamp: %s", msg.ID, msg.To, resp.ID, resp.Timestamp)
+    rc.Log.Infof("Disclosure for message ID %s sent to chat %s. New ID: %s", msg.ID, msg.To, resp.ID)
     return nil
 }
 
+/*
+ * Every message the bot sends on its own initiative (greetings, broadcasts,
+ * scheduled messages, ...) must go through here so that contacts who opted
+ * out never receive one, and nothing goes out while automation is paused.
+ * Replies to a representative's own message, such as edits and disclosures,
+ * are not automated and bypass both checks.
+ */
+func (rc *RIVAClient) SendAutomatedMessage(recipientJID types.JID, message *waE2E.Message, kind RIVASentKind) (whatsmeow.SendResponse, error) {
+    if rc.IsAutomationPaused() {
+        rc.Log.Infof("Not sending automated message to %s: %v", recipientJID, ErrAutomationPaused)
+        return whatsmeow.SendResponse{}, ErrAutomationPaused
+    }
+
+    if !recipientJID.IsEmpty() && recipientJID.Server != types.GroupServer {
+        suppressed, err := rc.DB.IsSuppressed(rc.Resolver.Canonical(recipientJID))
+        if err != nil {
+            return whatsmeow.SendResponse{}, err
+        }
+
+        if suppressed {
+            rc.Log.Infof("Not sending automated message to %s: %v", recipientJID, ErrRecipientSuppressed)
+            return whatsmeow.SendResponse{}, ErrRecipientSuppressed
+        }
+    }
+
+    return rc.SendTrackedMessage(recipientJID, message, kind)
+}
+
 func (rc *RIVAClient) SendGreetingMessage(recipientJID types.JID) error {
     buildMsg := &waProto.Message{
         Conversation: proto.String(rBotGreetingMessage),
@@ -72,13 +202,58 @@ func (rc *RIVAClient) SendGreetingMessage(recipientJID types.JID) error {
 
     sanitisedJID := recipientJID.ToNonAD()
 
-    _, err := rc.WMClient.SendMessage(context.Background(), sanitisedJID, buildMsg)
+    _, err := rc.SendAutomatedMessage(sanitisedJID, buildMsg, SentGreeting)
     if err != nil {
         rc.Log.Errorf("Failed to send greeting message to %s: %v", recipientJID, err)
         return err
     }
 
     rc.Log.Infof("Greeting message sent to %s", recipientJID)
+    if rBotGreetingLabel != "" {
+        if err := rc.LabelChat(sanitisedJID, rBotGreetingLabel, true); err != nil {
+            rc.Log.Warnf("Failed to label %s as %q: %v", recipientJID, rBotGreetingLabel, err)
+        }
+    }
+
+    if rBotMenu.IsEnabled() {
+        return rc.SendMenu(sanitisedJID, rBotMenuRootID)
+    }
+
+    return nil
+}
+
+func (rc *RIVAClient) SendConsentConfirmation(recipientJID types.JID, confirmation string) error {
+    buildMsg := &waE2E.Message{
+        Conversation: proto.String(confirmation),
+    }
+
+    _, err := rc.SendTrackedMessage(recipientJID.ToNonAD(), buildMsg, SentConsent)
+    if err != nil {
+        rc.Log.Errorf("Failed to send consent confirmation to %s: %v", recipientJID, err)
+        return err
+    }
+
+    rc.Log.Infof("Consent confirmation sent to %s", recipientJID)
+    return nil
+}
+
+func (rc *RIVAClient) TranscribeVoiceNote(msg RIVAClientMessage, audioPath string) error {
+    if rc.Transcriber == nil {
+        return nil
+    }
+
+    transcript, err := rc.Transcriber.Transcribe(context.Background(), audioPath)
+    if err != nil {
+        rc.Log.Errorf("Failed to transcribe voice note %s: %v", msg.ID, err)
+        return err
+    }
+
+    msg.Content = transcript
+    if err := rc.DB.UpdateArchivedContent(msg.Chat, msg.ID, msg.Content); err != nil {
+        return err
+    }
+
+    rc.Log.Infof("Transcribed voice note %s: %s", msg.ID, msg.Content)
     return nil
 }
 
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Hands out the same bytes for every attachment and counts the calls.
+type fakeDownloader struct {
+    mu    sync.Mutex
+    data  []byte
+    calls int
+}
+
+func (d *fakeDownloader) Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    d.calls++
+    return d.data, nil
+}
+
+func (d *fakeDownloader) Calls() int {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    return d.calls
+}
+
+/*
+ * Wires up a client like RIVAClient.New does, against an in-memory database
+ * and a WhatsMeow client that never connects, so nothing it sends leaves the
+ * process. Media is stored in a temporary directory and downloaded from d.
+ */
+func newTestClient(t *testing.T, d MediaDownloader) *RIVAClient {
+    t.Helper()
+
+    conn, err := sql.Open("sqlite3", "file::memory:?_foreign_keys=on")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    conn.SetMaxOpenConns(1)
+    t.Cleanup(func() { conn.Close() })
+
+    container := sqlstore.NewWithDB(conn, "sqlite3", nil)
+    if err := container.Upgrade(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+
+    rc := &RIVAClient{
+        WMClient: whatsmeow.NewClient(container.NewDevice(), nil),
+        Log:      NewRIVAClientLog("RIVABotTest", "INFO"),
+    }
+
+    rc.Resolver = (*RIVAClientResolver).New(nil, rc)
+    rc.DB       = (*RIVAClientDB).New(nil, rc, conn)
+    rc.Media    = &RIVAClientMediaStore{
+        RClient:        rc,
+        DB:             rc.DB,
+        Log:            NewRIVAClientLog("RIVABotTestMedia", "INFO"),
+        Dir:            t.TempDir(),
+        Downloader:     d,
+        pendingRetries: make(map[types.MessageID]RIVAClientMessage),
+    }
+    rc.Flood    = (*RIVAClientFlood).New(nil, rc, rc.DB)
+    rc.Handlers = (*RIVAClientEvent).New(nil, rc, rc.DB)
+    return rc
+}
+
+// Polls until the media of a message reaches status, as downloads run in the
+// background.
+func waitForStoredMedia(t *testing.T, rc *RIVAClient, chat types.JID, id string, status RIVAStoredMediaStatus) RIVAStoredMedia {
+    t.Helper()
+
+    deadline := time.Now().Add(5 * time.Second)
+    for time.Now().Before(deadline) {
+        sm, found, err := rc.DB.GetStoredMedia(chat, id)
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        if found && sm.Status == status {
+            return sm
+        }
+
+        time.Sleep(10 * time.Millisecond)
+    }
+
+    t.Fatalf("media of message %s never reached %s", id, status)
+    return RIVAStoredMedia{}
+}
@@ -6,10 +6,60 @@ import (
 )
 
 type RIVAClientConfig struct {
-    OrgPrefix        string  `yaml:"org_prefix"`
-    OrgHeaderFooter  string  `yaml:"org_header_footer"`
-    GreetingCooldown float64 `yaml:"greeting_cooldown"`
-    GreetingMessage  string  `yaml:"greeting_message"`
+    OrgPrefix           string            `yaml:"org_prefix"`
+    OrgHeaderFooter     string            `yaml:"org_header_footer"`
+    OrgHeaderFooterSign string            `yaml:"org_header_footer_signed"`
+    OrgDisclosure       string            `yaml:"org_disclosure_message"`
+    Representatives     map[uint16]string `yaml:"representatives"`
+    EditWindow          float64           `yaml:"edit_window_minutes"`
+    GreetingCooldown    float64           `yaml:"greeting_cooldown"`
+    GreetingMessage     string            `yaml:"greeting_message"`
+    ProcessedMessageTTL float64           `yaml:"processed_message_ttl"`
+    MediaDir            string            `yaml:"media_dir"`
+    MediaMaxSizeMB      float64           `yaml:"media_max_size_mb"`
+    MediaRetentionDays  float64           `yaml:"media_retention_days"`
+    Transcriber         string            `yaml:"transcriber"`
+    TranscriberCommand  string            `yaml:"transcriber_command"`
+    TranscriberConvert  string            `yaml:"transcriber_convert_command"`
+    TranscriberTimeout  float64           `yaml:"transcriber_timeout"`
+    TranscriberWorkers  int               `yaml:"transcriber_concurrency"`
+    OptOutKeywords      []string          `yaml:"opt_out_keywords"`
+    OptOutConfirmation  string            `yaml:"opt_out_confirmation"`
+    OptInKeywords       []string          `yaml:"opt_in_keywords"`
+    OptInConfirmation   string            `yaml:"opt_in_confirmation"`
+    Timezone            string            `yaml:"timezone"`
+    ScheduleCatchUp     float64           `yaml:"schedule_catch_up_hours"`
+    AdminListen         string            `yaml:"admin_listen"`
+    AdminToken          string            `yaml:"admin_token"`
+    CampaignInterval    float64           `yaml:"campaign_send_interval"`
+    CampaignQuietStart  string            `yaml:"campaign_quiet_hours_start"`
+    CampaignQuietEnd    string            `yaml:"campaign_quiet_hours_end"`
+    Menu                RIVAMenu          `yaml:"menu"`
+    Forms               []RIVAForm        `yaml:"forms"`
+    FormTimeout         float64           `yaml:"form_timeout_hours"`
+    FormCancelKeywords  []string          `yaml:"form_cancel_keywords"`
+    FormRestartKeywords []string          `yaml:"form_restart_keywords"`
+    GreetingLabel       string            `yaml:"greeting_label"`
+    StaffGroup          string            `yaml:"staff_group"`
+    SLAMinutes          float64           `yaml:"sla_minutes"`
+    SLAReportCron       string            `yaml:"sla_report_cron"`
+    ForwardInquiries    bool              `yaml:"forward_inquiries"`
+    RelayStaffReplies   bool              `yaml:"relay_staff_replies"`
+    ControlGroup        string            `yaml:"control_group"`
+    ControlOperators    []string          `yaml:"control_operators"`
+    HandoverKeywords    []string          `yaml:"handover_keywords"`
+    HandoverConfirm     string            `yaml:"handover_confirmation"`
+    HandoverTimeout     float64           `yaml:"handover_timeout_hours"`
+    HandoverOnReply     bool              `yaml:"handover_on_reply"`
+    AwayMessage         string            `yaml:"away_message"`
+    AwayCooldown        float64           `yaml:"away_cooldown"`
+    FloodWindow         float64           `yaml:"flood_window_seconds"`
+    FloodMaxMessages    int               `yaml:"flood_max_messages"`
+    FloodMaxRepeats     int               `yaml:"flood_max_repeats"`
+    FloodMaxLinks       int               `yaml:"flood_max_links"`
+    FloodActions        []string          `yaml:"flood_actions"`
+    FloodStrikeReset    float64           `yaml:"flood_strike_reset_hours"`
+    FloodWarning        string            `yaml:"flood_warning"`
 }
 
 func GetConf() *RIVAClientConfig {
@@ -24,9 +74,62 @@ func GetConf() *RIVAClientConfig {
         panic(err)
     }
 
+    /*
+     * Without a positive TTL every processed message record is expired as
+     * soon as it is written and redelivered messages are handled twice.
+     */
+    if config.ProcessedMessageTTL <= 0 {
+        config.ProcessedMessageTTL = rBotDefaultProcessedMessageTTLHours
+    }
+
+    // A zero edit window would turn every automatic edit into a disclosure reply.
+    if config.EditWindow <= 0 {
+        config.EditWindow = rBotDefaultEditWindowMinutes
+    }
+
+    // Scheduled messages due even a moment ago would be missed, not sent.
+    if config.ScheduleCatchUp <= 0 {
+        config.ScheduleCatchUp = rBotDefaultScheduleCatchUpHours
+    }
+
+    /*
+     * Campaigns sent without a pause between recipients look like spam to
+     * WhatsApp and get the number banned, so the interval has a floor.
+     */
+    if config.CampaignInterval <= 0 {
+        config.CampaignInterval = rBotDefaultCampaignSendIntervalSecs
+    }
+
+    config.CampaignInterval = max(config.CampaignInterval, rBotMinCampaignSendIntervalSecs)
+
+    // Transcriptions given no time at all are killed before they start.
+    if config.TranscriberTimeout <= 0 {
+        config.TranscriberTimeout = rBotDefaultTranscriberTimeoutSecs
+    }
+
     return config
 }
 
+// Used when processed_message_ttl is missing or not positive.
+const rBotDefaultProcessedMessageTTLHours = 72
+
+// Used when edit_window_minutes is missing or not positive. WhatsApp allows
+// edits for 15 minutes, this leaves a minute for the edit to arrive.
+const rBotDefaultEditWindowMinutes = 14
+
+// Used when schedule_catch_up_hours is missing or not positive.
+const rBotDefaultScheduleCatchUpHours = 6
+
+// Used when campaign_send_interval is missing or not positive; shorter
+// intervals are raised to the minimum.
+const (
+    rBotDefaultCampaignSendIntervalSecs = 8
+    rBotMinCampaignSendIntervalSecs     = 3
+)
+
+// Used when transcriber_timeout is missing or not positive.
+const rBotDefaultTranscriberTimeoutSecs = 120
+
 const (
     rBotSqlFilePath = "./data/rivabot.db"
     rBotSqlLastInteractionTableName   = "chat_activity"
@@ -47,13 +150,1071 @@ const (
         last_message
     ) VALUES (?, ?)
     `
+
+    rBotSqlLastInteractionDeleteQuery = `
+    DELETE FROM %s WHERE chat_jid = ?
+    `
+
+    rBotSqlLidListQuery   = `
+    SELECT DISTINCT %s FROM %s WHERE %s LIKE '%%@lid'
+    `
+
+    rBotSqlLidUpdateQuery = `
+    UPDATE OR IGNORE %s SET %s = ? WHERE %s = ?
+    `
+
+    rBotSqlLidKeepNewerQuery = `
+    DELETE FROM %[1]s WHERE %[2]s = ? AND %[3]s < (SELECT %[3]s FROM %[1]s WHERE %[2]s = ?)
+    `
+
+    rBotSqlLidDeleteQuery = `
+    DELETE FROM %s WHERE %s = ?
+    `
+
+    rBotSqlProcessedMessageTableName   = "processed_messages"
+    rBotSqlProcessedMessageCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        chat_jid     TEXT NOT NULL,
+        message_id   TEXT NOT NULL,
+        status       TEXT NOT NULL,
+        first_seen   DATETIME NOT NULL,
+        processed_at DATETIME NOT NULL,
+        PRIMARY KEY (chat_jid, message_id)
+    );
+    `
+
+    rBotSqlProcessedMessageGetQuery    = `
+    SELECT status, first_seen, processed_at FROM %s
+    WHERE chat_jid = ? AND message_id = ? AND processed_at >= ?
+    `
+
+    rBotSqlProcessedMessageInsertQuery = `
+    INSERT INTO %s (
+        chat_jid,
+        message_id,
+        status,
+        first_seen,
+        processed_at
+    ) VALUES (?, ?, ?, ?, ?)
+    ON CONFLICT (chat_jid, message_id) DO UPDATE SET
+        status       = excluded.status,
+        processed_at = excluded.processed_at
+    `
+
+    rBotSqlProcessedMessagePurgeQuery  = `
+    DELETE FROM %s WHERE processed_at < ?
+    `
+
+    rBotSqlProcessedMessageCountQuery  = `
+    SELECT status, COUNT(*) FROM %s GROUP BY status
+    `
+
+    rBotSqlArchiveTableName   = "messages"
+    rBotSqlArchiveCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        chat_jid   TEXT NOT NULL,
+        message_id TEXT NOT NULL,
+        sender_jid TEXT NOT NULL,
+        direction  TEXT NOT NULL,
+        type       TEXT NOT NULL,
+        content    TEXT NOT NULL,
+        timestamp  DATETIME NOT NULL,
+        PRIMARY KEY (chat_jid, message_id)
+    );
+    `
+
+    rBotSqlArchiveInsertQuery = `
+    INSERT OR IGNORE INTO %s (
+        chat_jid,
+        message_id,
+        sender_jid,
+        direction,
+        type,
+        content,
+        timestamp
+    ) VALUES (?, ?, ?, ?, ?, ?, ?)
+    `
+
+    rBotSqlArchiveUpdateContentQuery = `
+    UPDATE %s SET content = ? WHERE chat_jid = ? AND message_id = ?
+    `
+
+    rBotSqlArchiveGetContentQuery = `
+    SELECT content FROM %s WHERE chat_jid = ? AND message_id = ?
+    `
+
+    rBotSqlArchiveCountQuery = `
+    SELECT direction, COUNT(*) FROM %s WHERE timestamp >= ? GROUP BY direction
+    `
+
+    rBotSqlEditHistoryTableName   = "message_edits"
+    rBotSqlEditHistoryCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        id               INTEGER PRIMARY KEY AUTOINCREMENT,
+        chat_jid         TEXT NOT NULL,
+        message_id       TEXT NOT NULL,
+        kind             TEXT NOT NULL,
+        previous_content TEXT NOT NULL,
+        new_content      TEXT NOT NULL,
+        edited_at        DATETIME NOT NULL
+    );
+    `
+
+    rBotSqlEditHistoryInsertQuery = `
+    INSERT INTO %s (
+        chat_jid,
+        message_id,
+        kind,
+        previous_content,
+        new_content,
+        edited_at
+    ) VALUES (?, ?, ?, ?, ?, ?)
+    `
+
+    rBotSqlEditHistoryListQuery   = `
+    SELECT kind, previous_content, new_content, edited_at FROM %s
+    WHERE chat_jid = ? AND message_id = ? ORDER BY id
+    `
+
+    rBotSqlRepresentativeTableName   = "representatives"
+    rBotSqlRepresentativeCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        device_id  INTEGER PRIMARY KEY,
+        name       TEXT NOT NULL,
+        updated_at DATETIME NOT NULL
+    );
+    `
+
+    rBotSqlRepresentativeGetQuery    = `
+    SELECT name FROM %s WHERE device_id = ?
+    `
+
+    rBotSqlRepresentativeInsertQuery = `
+    INSERT OR REPLACE INTO %s (
+        device_id,
+        name,
+        updated_at
+    ) VALUES (?, ?, ?)
+    `
+
+    rBotSqlRepresentativeSeedQuery   = `
+    INSERT OR IGNORE INTO %s (
+        device_id,
+        name,
+        updated_at
+    ) VALUES (?, ?, ?)
+    `
+
+    rBotSqlRepresentativeDeleteQuery = `
+    DELETE FROM %s WHERE device_id = ?
+    `
+
+    rBotSqlSuppressionTableName   = "suppression_list"
+    rBotSqlSuppressionCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        jid        TEXT PRIMARY KEY,
+        keyword    TEXT NOT NULL,
+        created_at DATETIME NOT NULL
+    );
+    `
+
+    rBotSqlSuppressionGetQuery    = `
+    SELECT COUNT(*) FROM %s WHERE jid = ?
+    `
+
+    rBotSqlSuppressionInsertQuery = `
+    INSERT OR IGNORE INTO %s (
+        jid,
+        keyword,
+        created_at
+    ) VALUES (?, ?, ?)
+    `
+
+    rBotSqlSuppressionDeleteQuery = `
+    DELETE FROM %s WHERE jid = ?
+    `
+
+    rBotSqlMediaTableName   = "media_files"
+    rBotSqlMediaCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        chat_jid   TEXT NOT NULL,
+        message_id TEXT NOT NULL,
+        type       TEXT NOT NULL,
+        sha256     TEXT NOT NULL,
+        mime_type  TEXT NOT NULL,
+        file_name  TEXT NOT NULL,
+        size       INTEGER NOT NULL,
+        path       TEXT NOT NULL,
+        status     TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        PRIMARY KEY (chat_jid, message_id)
+    );
+    `
+
+    rBotSqlMediaGetQuery    = `
+    SELECT type, sha256, mime_type, file_name, size, path, status, created_at FROM %s
+    WHERE chat_jid = ? AND message_id = ?
+    `
+
+    rBotSqlMediaInsertQuery = `
+    INSERT OR REPLACE INTO %s (
+        chat_jid,
+        message_id,
+        type,
+        sha256,
+        mime_type,
+        file_name,
+        size,
+        path,
+        status,
+        created_at
+    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+
+    rBotSqlMediaExpiredQuery = `
+    SELECT DISTINCT path FROM %s WHERE created_at < ? AND path != ''
+    `
+
+    rBotSqlMediaPurgeQuery   = `
+    DELETE FROM %s WHERE created_at < ?
+    `
+
+    rBotSqlMediaPathInUseQuery = `
+    SELECT COUNT(*) FROM %s WHERE path = ?
+    `
+
+    rBotSqlScheduledTableName   = "scheduled_messages"
+    rBotSqlScheduledCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        id            INTEGER PRIMARY KEY AUTOINCREMENT,
+        recipient_jid TEXT NOT NULL,
+        content       TEXT NOT NULL,
+        media_path    TEXT NOT NULL,
+        send_at       DATETIME NOT NULL,
+        recurrence    TEXT NOT NULL,
+        status        TEXT NOT NULL,
+        created_by    TEXT NOT NULL,
+        created_at    DATETIME NOT NULL,
+        last_sent_at  DATETIME,
+        last_error    TEXT NOT NULL DEFAULT ''
+    );
+    CREATE INDEX IF NOT EXISTS idx_%[1]s_due ON %[1]s (status, send_at);
+    `
+
+    rBotSqlScheduledColumns     = `
+    id, recipient_jid, content, media_path, send_at, recurrence, status, created_by, created_at, last_sent_at, last_error
+    `
+
+    rBotSqlScheduledInsertQuery = `
+    INSERT INTO %s (
+        recipient_jid,
+        content,
+        media_path,
+        send_at,
+        recurrence,
+        status,
+        created_by,
+        created_at
+    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `
+
+    rBotSqlScheduledGetQuery    = `
+    SELECT %s FROM %s WHERE id = ?
+    `
+
+    rBotSqlScheduledDueQuery    = `
+    SELECT %s FROM %s WHERE status = 'PENDING' AND send_at <= ? ORDER BY send_at
+    `
+
+    rBotSqlScheduledListQuery   = `
+    SELECT %s FROM %s WHERE status = 'PENDING' ORDER BY send_at
+    `
+
+    rBotSqlScheduledListAllQuery = `
+    SELECT %s FROM %s ORDER BY send_at
+    `
+
+    rBotSqlScheduledCancelQuery = `
+    UPDATE %s SET status = 'CANCELLED' WHERE id = ? AND status = 'PENDING'
+    `
+
+    rBotSqlScheduledUpdateQuery = `
+    UPDATE %s SET status = ?, send_at = ?, last_sent_at = ?, last_error = ? WHERE id = ?
+    `
+
+    rBotSqlCampaignTableName   = "campaigns"
+    rBotSqlCampaignCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        id         INTEGER PRIMARY KEY AUTOINCREMENT,
+        name       TEXT NOT NULL,
+        template   TEXT NOT NULL,
+        media_path TEXT NOT NULL,
+        status     TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        updated_at DATETIME NOT NULL
+    );
+    `
+
+    rBotSqlCampaignInsertQuery = `
+    INSERT INTO %s (
+        name,
+        template,
+        media_path,
+        status,
+        created_at,
+        updated_at
+    ) VALUES (?, ?, ?, ?, ?, ?)
+    `
+
+    rBotSqlCampaignGetQuery    = `
+    SELECT id, name, template, media_path, status, created_at, updated_at FROM %s WHERE id = ?
+    `
+
+    rBotSqlCampaignListQuery   = `
+    SELECT id, name, template, media_path, status, created_at, updated_at FROM %s ORDER BY id
+    `
+
+    rBotSqlCampaignRunningQuery = `
+    SELECT id, name, template, media_path, status, created_at, updated_at FROM %s WHERE status = 'RUNNING' ORDER BY id
+    `
+
+    rBotSqlCampaignStatusQuery = `
+    UPDATE %s SET status = ?, updated_at = ? WHERE id = ? AND status IN (%s)
+    `
+
+    rBotSqlCampaignRecipientTableName   = "campaign_recipients"
+    rBotSqlCampaignRecipientCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        campaign_id INTEGER NOT NULL,
+        jid         TEXT NOT NULL,
+        phone       TEXT NOT NULL,
+        variables   TEXT NOT NULL,
+        status      TEXT NOT NULL,
+        message_id  TEXT NOT NULL DEFAULT '',
+        error       TEXT NOT NULL DEFAULT '',
+        updated_at  DATETIME NOT NULL,
+        PRIMARY KEY (campaign_id, jid)
+    );
+    CREATE INDEX IF NOT EXISTS idx_%[1]s_message ON %[1]s (message_id);
+    `
+
+    rBotSqlCampaignRecipientInsertQuery = `
+    INSERT OR IGNORE INTO %s (
+        campaign_id,
+        jid,
+        phone,
+        variables,
+        status,
+        updated_at
+    ) VALUES (?, ?, ?, ?, ?, ?)
+    `
+
+    rBotSqlCampaignRecipientQueuedQuery = `
+    SELECT campaign_id, jid, phone, variables, status, message_id, error, updated_at FROM %s
+    WHERE campaign_id = ? AND status = 'QUEUED' ORDER BY rowid LIMIT ?
+    `
+
+    rBotSqlCampaignRecipientUpdateQuery = `
+    UPDATE %s SET status = ?, message_id = ?, error = ?, updated_at = ? WHERE campaign_id = ? AND jid = ?
+    `
+
+    rBotSqlCampaignRecipientCountQuery  = `
+    SELECT status, COUNT(*) FROM %s WHERE campaign_id = ? GROUP BY status
+    `
+
+    rBotSqlCampaignRecipientReceiptQuery = `
+    UPDATE %s SET status = ?, updated_at = ? WHERE message_id = ? AND status IN (%s)
+    `
+
+    rBotSqlSentMessageTableName   = "sent_messages"
+    rBotSqlSentMessageCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        chat_jid     TEXT NOT NULL,
+        message_id   TEXT NOT NULL,
+        kind         TEXT NOT NULL,
+        status       TEXT NOT NULL,
+        sent_at      DATETIME NOT NULL,
+        delivered_at DATETIME,
+        read_at      DATETIME,
+        played_at    DATETIME,
+        PRIMARY KEY (chat_jid, message_id)
+    );
+    CREATE INDEX IF NOT EXISTS idx_%[1]s_message ON %[1]s (message_id);
+    `
+
+    rBotSqlSentMessageColumns     = `
+    chat_jid, message_id, kind, status, sent_at, delivered_at, read_at, played_at
+    `
+
+    rBotSqlSentMessageInsertQuery = `
+    INSERT OR IGNORE INTO %s (
+        chat_jid,
+        message_id,
+        kind,
+        status,
+        sent_at
+    ) VALUES (?, ?, ?, ?, ?)
+    `
+
+    rBotSqlSentMessageGetQuery    = `
+    SELECT %s FROM %s WHERE message_id = ?
+    `
+
+    rBotSqlSentMessageListQuery   = `
+    SELECT %s FROM %s WHERE chat_jid = ? ORDER BY sent_at DESC LIMIT ?
+    `
+
+    rBotSqlSentMessageCountQuery  = `
+    SELECT status, COUNT(*) FROM %s WHERE chat_jid = ? GROUP BY status
+    `
+
+    rBotSqlSentMessageKindCountQuery = `
+    SELECT kind, COUNT(*) FROM %s WHERE sent_at >= ? GROUP BY kind
+    `
+
+    rBotSqlSentMessageReceiptQuery = `
+    UPDATE %s SET
+        status       = CASE WHEN status IN (%s) THEN ? ELSE status END,
+        delivered_at = COALESCE(delivered_at, ?),
+        read_at      = COALESCE(read_at, ?),
+        played_at    = COALESCE(played_at, ?)
+    WHERE message_id = ?
+    `
+
+    rBotSqlMenuSessionTableName   = "menu_sessions"
+    rBotSqlMenuSessionCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        chat_jid   TEXT PRIMARY KEY,
+        menu_id    TEXT NOT NULL,
+        updated_at DATETIME NOT NULL
+    );
+    `
+
+    rBotSqlMenuSessionGetQuery    = `
+    SELECT menu_id, updated_at FROM %s WHERE chat_jid = ?
+    `
+
+    rBotSqlMenuSessionInsertQuery = `
+    INSERT OR REPLACE INTO %s (
+        chat_jid,
+        menu_id,
+        updated_at
+    ) VALUES (?, ?, ?)
+    `
+
+    rBotSqlFormSessionTableName   = "form_sessions"
+    rBotSqlFormSessionCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        chat_jid   TEXT PRIMARY KEY,
+        form_id    TEXT NOT NULL,
+        step       INTEGER NOT NULL,
+        answers    TEXT NOT NULL,
+        started_at DATETIME NOT NULL,
+        updated_at DATETIME NOT NULL
+    );
+    `
+
+    rBotSqlFormSessionGetQuery    = `
+    SELECT form_id, step, answers, started_at, updated_at FROM %s WHERE chat_jid = ?
+    `
+
+    rBotSqlFormSessionInsertQuery = `
+    INSERT OR REPLACE INTO %s (
+        chat_jid,
+        form_id,
+        step,
+        answers,
+        started_at,
+        updated_at
+    ) VALUES (?, ?, ?, ?, ?, ?)
+    `
+
+    rBotSqlFormSessionDeleteQuery = `
+    DELETE FROM %s WHERE chat_jid = ?
+    `
+
+    rBotSqlFormSubmissionTableName   = "form_submissions"
+    rBotSqlFormSubmissionCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        id           INTEGER PRIMARY KEY AUTOINCREMENT,
+        form_id      TEXT NOT NULL,
+        chat_jid     TEXT NOT NULL,
+        answers      TEXT NOT NULL,
+        submitted_at DATETIME NOT NULL
+    );
+    `
+
+    rBotSqlFormSubmissionInsertQuery = `
+    INSERT INTO %s (
+        form_id,
+        chat_jid,
+        answers,
+        submitted_at
+    ) VALUES (?, ?, ?, ?)
+    `
+
+    rBotSqlFormSubmissionListQuery   = `
+    SELECT id, form_id, chat_jid, answers, submitted_at FROM %s WHERE form_id = ? ORDER BY id
+    `
+
+    rBotSqlContactTableName   = "contacts"
+    rBotSqlContactCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        jid               TEXT PRIMARY KEY,
+        push_name         TEXT NOT NULL DEFAULT '',
+        full_name         TEXT NOT NULL DEFAULT '',
+        first_name        TEXT NOT NULL DEFAULT '',
+        business_name     TEXT NOT NULL DEFAULT '',
+        first_seen        DATETIME,
+        last_seen         DATETIME,
+        messages_received INTEGER NOT NULL DEFAULT 0,
+        messages_sent     INTEGER NOT NULL DEFAULT 0
+    );
+    `
+
+    rBotSqlContactSeenQuery   = `
+    INSERT INTO %s (
+        jid,
+        push_name,
+        first_seen,
+        last_seen,
+        messages_received,
+        messages_sent
+    ) VALUES (?, ?, ?, ?, ?, ?)
+    ON CONFLICT (jid) DO UPDATE SET
+        push_name         = CASE WHEN excluded.push_name != '' THEN excluded.push_name ELSE push_name END,
+        first_seen        = MIN(COALESCE(first_seen, excluded.first_seen), excluded.first_seen),
+        last_seen         = MAX(COALESCE(last_seen, excluded.last_seen), excluded.last_seen),
+        messages_received = messages_received + excluded.messages_received,
+        messages_sent     = messages_sent + excluded.messages_sent
+    `
+
+    rBotSqlContactEnsureQuery = `
+    INSERT OR IGNORE INTO %s (jid) VALUES (?)
+    `
+
+    rBotSqlContactPushNameQuery     = `
+    INSERT INTO %s (jid, push_name) VALUES (?, ?)
+    ON CONFLICT (jid) DO UPDATE SET push_name = excluded.push_name
+    `
+
+    rBotSqlContactBusinessNameQuery = `
+    INSERT INTO %s (jid, business_name) VALUES (?, ?)
+    ON CONFLICT (jid) DO UPDATE SET business_name = excluded.business_name
+    `
+
+    rBotSqlContactSavedNameQuery    = `
+    INSERT INTO %s (jid, full_name, first_name) VALUES (?, ?, ?)
+    ON CONFLICT (jid) DO UPDATE SET full_name = excluded.full_name, first_name = excluded.first_name
+    `
+
+    rBotSqlContactGetQuery    = `
+    SELECT c.jid, c.push_name, c.full_name, c.first_name, c.business_name, c.first_seen, c.last_seen,
+           c.messages_received, c.messages_sent, COALESCE((SELECT GROUP_CONCAT(t.tag) FROM %[2]s t WHERE t.jid = c.jid), '')
+    FROM %[1]s c WHERE c.jid = ?
+    `
+
+    rBotSqlContactListQuery   = `
+    SELECT c.jid, c.push_name, c.full_name, c.first_name, c.business_name, c.first_seen, c.last_seen,
+           c.messages_received, c.messages_sent, COALESCE((SELECT GROUP_CONCAT(t.tag) FROM %[2]s t WHERE t.jid = c.jid), '')
+    FROM %[1]s c
+    WHERE (? = '' OR c.jid IN (SELECT jid FROM %[2]s WHERE tag = ?))
+      AND (? = '' OR c.jid LIKE ? OR c.push_name LIKE ? OR c.full_name LIKE ? OR c.business_name LIKE ?)
+    ORDER BY c.last_seen DESC, c.jid
+    LIMIT ?
+    `
+
+    rBotSqlContactMergeQuery  = `
+    INSERT INTO %s (
+        jid,
+        push_name,
+        full_name,
+        first_name,
+        business_name,
+        first_seen,
+        last_seen,
+        messages_received,
+        messages_sent
+    ) SELECT ?, push_name, full_name, first_name, business_name, first_seen, last_seen, messages_received, messages_sent
+      FROM %s WHERE jid = ?
+    ON CONFLICT (jid) DO UPDATE SET
+        push_name         = CASE WHEN excluded.push_name <> '' AND (push_name = '' OR excluded.last_seen > last_seen) THEN excluded.push_name ELSE push_name END,
+        full_name         = CASE WHEN excluded.full_name <> '' AND (full_name = '' OR excluded.last_seen > last_seen) THEN excluded.full_name ELSE full_name END,
+        first_name        = CASE WHEN excluded.first_name <> '' AND (first_name = '' OR excluded.last_seen > last_seen) THEN excluded.first_name ELSE first_name END,
+        business_name     = CASE WHEN excluded.business_name <> '' AND (business_name = '' OR excluded.last_seen > last_seen) THEN excluded.business_name ELSE business_name END,
+        first_seen        = MIN(COALESCE(first_seen, excluded.first_seen), COALESCE(excluded.first_seen, first_seen)),
+        last_seen         = MAX(COALESCE(last_seen, excluded.last_seen), COALESCE(excluded.last_seen, last_seen)),
+        messages_received = messages_received + excluded.messages_received,
+        messages_sent     = messages_sent + excluded.messages_sent
+    `
+
+    rBotSqlContactNameTableName   = "contact_push_names"
+    rBotSqlContactNameCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        jid        TEXT NOT NULL,
+        push_name  TEXT NOT NULL,
+        first_seen DATETIME NOT NULL,
+        PRIMARY KEY (jid, push_name)
+    );
+    `
+
+    rBotSqlContactNameInsertQuery = `
+    INSERT OR IGNORE INTO %s (
+        jid,
+        push_name,
+        first_seen
+    ) VALUES (?, ?, ?)
+    `
+
+    rBotSqlContactNameListQuery   = `
+    SELECT push_name, first_seen FROM %s WHERE jid = ? ORDER BY first_seen
+    `
+
+    rBotSqlContactTagTableName   = "contact_tags"
+    rBotSqlContactTagCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %[1]s (
+        jid        TEXT NOT NULL,
+        tag        TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        PRIMARY KEY (jid, tag)
+    );
+    CREATE INDEX IF NOT EXISTS idx_%[1]s_tag ON %[1]s (tag);
+    `
+
+    rBotSqlContactTagInsertQuery = `
+    INSERT OR IGNORE INTO %s (
+        jid,
+        tag,
+        created_at
+    ) VALUES (?, ?, ?)
+    `
+
+    rBotSqlContactTagDeleteQuery = `
+    DELETE FROM %s WHERE jid = ? AND tag = ?
+    `
+
+    rBotSqlLabelTableName   = "labels"
+    rBotSqlLabelCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        label_id   TEXT PRIMARY KEY,
+        name       TEXT NOT NULL,
+        color      INTEGER NOT NULL,
+        deleted    BOOLEAN NOT NULL DEFAULT 0,
+        updated_at DATETIME NOT NULL
+    );
+    `
+
+    rBotSqlLabelInsertQuery = `
+    INSERT OR REPLACE INTO %s (
+        label_id,
+        name,
+        color,
+        deleted,
+        updated_at
+    ) VALUES (?, ?, ?, ?, ?)
+    `
+
+    rBotSqlLabelListQuery   = `
+    SELECT l.label_id, l.name, l.color, l.deleted, l.updated_at,
+           (SELECT COUNT(*) FROM %[2]s c WHERE c.label_id = l.label_id),
+           (SELECT COUNT(*) FROM %[3]s m WHERE m.label_id = l.label_id)
+    FROM %[1]s l
+    WHERE ? OR NOT l.deleted
+    ORDER BY l.name COLLATE NOCASE
+    `
+
+    rBotSqlChatLabelTableName   = "chat_labels"
+    rBotSqlChatLabelCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %[1]s (
+        label_id   TEXT NOT NULL,
+        chat_jid   TEXT NOT NULL,
+        labeled_at DATETIME NOT NULL,
+        PRIMARY KEY (label_id, chat_jid)
+    );
+    CREATE INDEX IF NOT EXISTS idx_%[1]s_chat ON %[1]s (chat_jid);
+    `
+
+    rBotSqlChatLabelInsertQuery = `
+    INSERT OR IGNORE INTO %s (
+        label_id,
+        chat_jid,
+        labeled_at
+    ) VALUES (?, ?, ?)
+    `
+
+    rBotSqlChatLabelDeleteQuery = `
+    DELETE FROM %s WHERE label_id = ? AND chat_jid = ?
+    `
+
+    rBotSqlChatLabelListQuery   = `
+    SELECT chat_jid, labeled_at FROM %s WHERE label_id = ? ORDER BY labeled_at DESC
+    `
+
+    rBotSqlChatLabelsOfQuery    = `
+    SELECT l.label_id, l.name, l.color, l.deleted, l.updated_at, 0, 0
+    FROM %[1]s l JOIN %[2]s c ON c.label_id = l.label_id
+    WHERE c.chat_jid = ? AND NOT l.deleted
+    ORDER BY l.name COLLATE NOCASE
+    `
+
+    rBotSqlMessageLabelTableName   = "message_labels"
+    rBotSqlMessageLabelCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        label_id   TEXT NOT NULL,
+        chat_jid   TEXT NOT NULL,
+        message_id TEXT NOT NULL,
+        labeled_at DATETIME NOT NULL,
+        PRIMARY KEY (label_id, chat_jid, message_id)
+    );
+    `
+
+    rBotSqlMessageLabelInsertQuery = `
+    INSERT OR IGNORE INTO %s (
+        label_id,
+        chat_jid,
+        message_id,
+        labeled_at
+    ) VALUES (?, ?, ?, ?)
+    `
+
+    rBotSqlMessageLabelDeleteQuery = `
+    DELETE FROM %s WHERE label_id = ? AND chat_jid = ? AND message_id = ?
+    `
+
+    rBotSqlMessageLabelListQuery   = `
+    SELECT chat_jid, message_id, labeled_at FROM %s WHERE label_id = ? ORDER BY labeled_at DESC
+    `
+
+    rBotSqlLabelAssociationDeleteQuery = `
+    DELETE FROM %s WHERE label_id = ?
+    `
+
+    rBotSqlConversationTableName   = "conversations"
+    rBotSqlConversationCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %[1]s (
+        id                INTEGER PRIMARY KEY AUTOINCREMENT,
+        chat_jid          TEXT NOT NULL,
+        started_at        DATETIME NOT NULL,
+        last_inbound_at   DATETIME NOT NULL,
+        inbound_count     INTEGER NOT NULL DEFAULT 1,
+        first_response_at DATETIME,
+        reminded_at       DATETIME
+    );
+    CREATE INDEX IF NOT EXISTS idx_%[1]s_chat ON %[1]s (chat_jid, id);
+    CREATE INDEX IF NOT EXISTS idx_%[1]s_started ON %[1]s (started_at);
+    `
+
+    rBotSqlConversationLatestQuery = `
+    SELECT id, last_inbound_at, first_response_at FROM %s WHERE chat_jid = ? ORDER BY id DESC LIMIT 1
+    `
+
+    rBotSqlConversationInsertQuery = `
+    INSERT INTO %s (
+        chat_jid,
+        started_at,
+        last_inbound_at
+    ) VALUES (?, ?, ?)
+    `
+
+    rBotSqlConversationInboundQuery = `
+    UPDATE %s SET last_inbound_at = MAX(last_inbound_at, ?), inbound_count = inbound_count + 1 WHERE id = ?
+    `
+
+    rBotSqlConversationResponseQuery = `
+    UPDATE %[1]s SET first_response_at = ?
+    WHERE id = (SELECT MAX(id) FROM %[1]s WHERE chat_jid = ?) AND first_response_at IS NULL AND started_at <= ?
+    `
+
+    rBotSqlConversationOverdueQuery = `
+    SELECT id, chat_jid, started_at, last_inbound_at, inbound_count, first_response_at, reminded_at
+    FROM %s WHERE first_response_at IS NULL AND reminded_at IS NULL AND started_at <= ?
+    ORDER BY started_at
+    `
+
+    rBotSqlConversationRemindedQuery = `
+    UPDATE %s SET reminded_at = ? WHERE id = ?
+    `
+
+    rBotSqlConversationChatQuery = `
+    SELECT id, chat_jid, started_at, last_inbound_at, inbound_count, first_response_at, reminded_at
+    FROM %s WHERE chat_jid = ?
+    ORDER BY id DESC LIMIT 1
+    `
+
+    rBotSqlConversationListQuery = `
+    SELECT id, chat_jid, started_at, last_inbound_at, inbound_count, first_response_at, reminded_at
+    FROM %s WHERE started_at >= ? AND started_at < ?
+    ORDER BY started_at
+    `
+
+    rBotSqlStaffForwardTableName   = "staff_forwards"
+    rBotSqlStaffForwardCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        message_id   TEXT PRIMARY KEY,
+        chat_jid     TEXT NOT NULL,
+        forwarded_at DATETIME NOT NULL
+    );
+    `
+
+    rBotSqlStaffForwardInsertQuery = `
+    INSERT OR REPLACE INTO %s (
+        message_id,
+        chat_jid,
+        forwarded_at
+    ) VALUES (?, ?, ?)
+    `
+
+    rBotSqlStaffForwardGetQuery    = `
+    SELECT chat_jid FROM %s WHERE message_id = ?
+    `
+
+    rBotSqlHandoverTableName   = "handovers"
+    rBotSqlHandoverCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        chat_jid   TEXT PRIMARY KEY,
+        reason     TEXT NOT NULL,
+        started_at DATETIME NOT NULL,
+        expires_at DATETIME NOT NULL
+    );
+    `
+
+    rBotSqlHandoverSaveQuery   = `
+    INSERT OR REPLACE INTO %s (
+        chat_jid,
+        reason,
+        started_at,
+        expires_at
+    ) VALUES (?, ?, ?, ?)
+    `
+
+    rBotSqlHandoverGetQuery    = `
+    SELECT chat_jid, reason, started_at, expires_at FROM %s WHERE chat_jid = ? AND expires_at > ?
+    `
+
+    rBotSqlHandoverListQuery   = `
+    SELECT chat_jid, reason, started_at, expires_at FROM %s WHERE expires_at > ?
+    ORDER BY started_at
+    `
+
+    rBotSqlHandoverDeleteQuery = `
+    DELETE FROM %s WHERE chat_jid = ? AND expires_at > ?
+    `
+
+    rBotSqlFloodEventTableName   = "flood_events"
+    rBotSqlFloodEventCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        id         INTEGER PRIMARY KEY AUTOINCREMENT,
+        jid        TEXT NOT NULL,
+        reason     TEXT NOT NULL,
+        action     TEXT NOT NULL,
+        strike     INTEGER NOT NULL,
+        sample     TEXT NOT NULL,
+        created_at DATETIME NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_%[1]s_jid ON %[1]s (jid);
+    `
+
+    rBotSqlFloodEventInsertQuery = `
+    INSERT INTO %s (
+        jid,
+        reason,
+        action,
+        strike,
+        sample,
+        created_at
+    ) VALUES (?, ?, ?, ?, ?, ?)
+    `
+
+    rBotSqlFloodEventListQuery   = `
+    SELECT id, jid, reason, action, strike, sample, created_at
+    FROM %s ORDER BY id DESC LIMIT ?
+    `
+
+    rBotSqlBlockedTableName   = "blocked_contacts"
+    rBotSqlBlockedCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        jid        TEXT PRIMARY KEY,
+        source     TEXT NOT NULL,
+        reason     TEXT NOT NULL,
+        blocked_at DATETIME NOT NULL
+    );
+    `
+
+    rBotSqlBlockedSaveQuery   = `
+    INSERT OR REPLACE INTO %s (
+        jid,
+        source,
+        reason,
+        blocked_at
+    ) VALUES (?, ?, ?, ?)
+    `
+
+    rBotSqlBlockedAddQuery    = `
+    INSERT OR IGNORE INTO %s (
+        jid,
+        source,
+        reason,
+        blocked_at
+    ) VALUES (?, ?, ?, ?)
+    `
+
+    rBotSqlBlockedGetQuery    = `
+    SELECT jid, source, reason, blocked_at FROM %s WHERE jid = ?
+    `
+
+    rBotSqlBlockedListQuery   = `
+    SELECT jid, source, reason, blocked_at FROM %s ORDER BY blocked_at DESC
+    `
+
+    rBotSqlBlockedDeleteQuery = `
+    DELETE FROM %s WHERE jid = ?
+    `
+
+    rBotSqlSettingTableName   = "settings"
+    rBotSqlSettingCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        key        TEXT PRIMARY KEY,
+        value      TEXT NOT NULL,
+        updated_by TEXT NOT NULL,
+        updated_at DATETIME NOT NULL
+    );
+    `
+
+    rBotSqlSettingGetQuery    = `
+    SELECT value FROM %s WHERE key = ?
+    `
+
+    rBotSqlSettingSetQuery    = `
+    INSERT OR REPLACE INTO %s (
+        key,
+        value,
+        updated_by,
+        updated_at
+    ) VALUES (?, ?, ?, ?)
+    `
+
+    rBotSqlSettingDeleteQuery = `
+    DELETE FROM %s WHERE key = ?
+    `
+
+    rBotSqlAwayReplyTableName   = "away_replies"
+    rBotSqlAwayReplyCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        chat_jid   TEXT PRIMARY KEY,
+        replied_at DATETIME NOT NULL
+    );
+    `
+
+    rBotSqlAwayReplyGetQuery    = `
+    SELECT replied_at FROM %s WHERE chat_jid = ?
+    `
+
+    rBotSqlAwayReplySetQuery    = `
+    INSERT OR REPLACE INTO %s (
+        chat_jid,
+        replied_at
+    ) VALUES (?, ?)
+    `
+
+    rBotSqlOperatorAuditTableName   = "operator_audit"
+    rBotSqlOperatorAuditCreateQuery = `
+    CREATE TABLE IF NOT EXISTS %s (
+        id           INTEGER PRIMARY KEY AUTOINCREMENT,
+        operator_jid TEXT NOT NULL,
+        command      TEXT NOT NULL,
+        authorised   BOOLEAN NOT NULL,
+        result       TEXT NOT NULL,
+        created_at   DATETIME NOT NULL
+    );
+    `
+
+    rBotSqlOperatorAuditInsertQuery = `
+    INSERT INTO %s (
+        operator_jid,
+        command,
+        authorised,
+        result,
+        created_at
+    ) VALUES (?, ?, ?, ?, ?)
+    `
+
+    rBotSqlOperatorAuditListQuery   = `
+    SELECT id, operator_jid, command, authorised, result, created_at
+    FROM %s ORDER BY id DESC LIMIT ?
+    `
 )
 
 var (
-    rBotOrgPrefix       = GetConf().OrgPrefix
-    rBotOrgHeaderFooter = GetConf().OrgHeaderFooter
+    rBotOrgPrefix             = GetConf().OrgPrefix
+    rBotOrgHeaderFooter       = GetConf().OrgHeaderFooter
+    rBotOrgHeaderFooterSigned = GetConf().OrgHeaderFooterSign
+    rBotOrgDisclosureMessage  = GetConf().OrgDisclosure
+    rBotRepresentatives       = GetConf().Representatives
+
+    rBotEditWindowMinutes = GetConf().EditWindow
 
     rBotGreetingCooldownHours = GetConf().GreetingCooldown
     rBotGreetingMessage       = GetConf().GreetingMessage
+    rBotGreetingLabel         = GetConf().GreetingLabel
+
+    rBotMenu = GetConf().Menu
+
+    rBotForms               = GetConf().Forms
+    rBotFormTimeoutHours    = GetConf().FormTimeout
+    rBotFormCancelKeywords  = GetConf().FormCancelKeywords
+    rBotFormRestartKeywords = GetConf().FormRestartKeywords
+
+    rBotProcessedMessageTTLHours = GetConf().ProcessedMessageTTL
+
+    rBotMediaDir           = GetConf().MediaDir
+    rBotMediaMaxSizeMB     = GetConf().MediaMaxSizeMB
+    rBotMediaRetentionDays = GetConf().MediaRetentionDays
+
+    rBotTranscriber               = GetConf().Transcriber
+    rBotTranscriberCommand        = GetConf().TranscriberCommand
+    rBotTranscriberConvertCommand = GetConf().TranscriberConvert
+    rBotTranscriberTimeoutSecs    = GetConf().TranscriberTimeout
+    rBotTranscriberConcurrency    = GetConf().TranscriberWorkers
+
+    rBotOptOutKeywords     = GetConf().OptOutKeywords
+    rBotOptOutConfirmation = GetConf().OptOutConfirmation
+    rBotOptInKeywords      = GetConf().OptInKeywords
+    rBotOptInConfirmation  = GetConf().OptInConfirmation
+
+    rBotTimezone             = GetConf().Timezone
+    rBotScheduleCatchUpHours = GetConf().ScheduleCatchUp
+
+    rBotAdminListen = GetConf().AdminListen
+    rBotAdminToken  = GetConf().AdminToken
+
+    rBotStaffGroup    = GetConf().StaffGroup
+    rBotSLAMinutes    = GetConf().SLAMinutes
+    rBotSLAReportCron = GetConf().SLAReportCron
+
+    rBotForwardInquiries  = GetConf().ForwardInquiries
+    rBotRelayStaffReplies = GetConf().RelayStaffReplies
+
+    rBotControlGroup     = GetConf().ControlGroup
+    rBotControlOperators = GetConf().ControlOperators
+
+    rBotHandoverKeywords     = GetConf().HandoverKeywords
+    rBotHandoverConfirmation = GetConf().HandoverConfirm
+    rBotHandoverTimeoutHours = GetConf().HandoverTimeout
+    rBotHandoverOnReply      = GetConf().HandoverOnReply
+
+    rBotAwayMessage       = GetConf().AwayMessage
+    rBotAwayCooldownHours = GetConf().AwayCooldown
+
+    rBotFloodWindowSecs       = GetConf().FloodWindow
+    rBotFloodMaxMessages      = GetConf().FloodMaxMessages
+    rBotFloodMaxRepeats       = GetConf().FloodMaxRepeats
+    rBotFloodMaxLinks         = GetConf().FloodMaxLinks
+    rBotFloodActions          = GetConf().FloodActions
+    rBotFloodStrikeResetHours = GetConf().FloodStrikeReset
+    rBotFloodWarning          = GetConf().FloodWarning
+
+    rBotCampaignSendIntervalSecs = GetConf().CampaignInterval
+    rBotCampaignQuietHoursStart  = GetConf().CampaignQuietStart
+    rBotCampaignQuietHoursEnd    = GetConf().CampaignQuietEnd
 )
 
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+/*
+ * Everything we know about a contact, gathered from their messages and from
+ * WhatsApp's contact, push name and business name events. Tags are free-form
+ * labels set by operators through the CLI or admin API.
+ */
+type RIVAContact struct {
+    JID              types.JID         `json:"jid"`                     // Canonical JID of the contact
+    PushName         string            `json:"push_name,omitempty"`     // Display name the contact set for themselves
+    FullName         string            `json:"full_name,omitempty"`     // Name saved in the bot account's address book
+    FirstName        string            `json:"first_name,omitempty"`    // First name saved in the address book
+    BusinessName     string            `json:"business_name,omitempty"` // Verified business name, business accounts only
+    FirstSeen        time.Time         `json:"first_seen,omitzero"`     // First message to or from the contact
+    LastSeen         time.Time         `json:"last_seen,omitzero"`      // Latest message to or from the contact
+    MessagesReceived int               `json:"messages_received"`       // Messages the contact sent us
+    MessagesSent     int               `json:"messages_sent"`           // Messages we sent the contact in their chat
+    Tags             []string          `json:"tags"`                    // Operator tags, sorted
+    PushNames        []RIVAContactName `json:"push_names,omitempty"`    // Push name history, oldest first
+}
+
+type RIVAContactName struct {
+    Name      string    `json:"name"`       // Push name as sent by WhatsApp
+    FirstSeen time.Time `json:"first_seen"` // When we first saw the contact use it
+}
+
+const rBotContactTagMaxLength = 32
+
+// Returns the best name we have for the contact, falling back to the number.
+func (c RIVAContact) DisplayName() string {
+    for _, name := range []string{c.FullName, c.BusinessName, c.PushName} {
+        if name != "" {
+            return name
+        }
+    }
+
+    return c.JID.User
+}
+
+// Returns the contact's phone number in international format, or the JID if
+// only the LID is known.
+func FormatNumber(jid types.JID) string {
+    if jid.Server == types.DefaultUserServer {
+        return "+" + jid.User
+    }
+
+    return jid.String()
+}
+
+/*
+ * Tags are matched case-insensitively and stored lower case. They are kept
+ * to a single word of letters, digits, "-" and "_" so that they can be
+ * listed comma separated and typed on the command line without quoting.
+ */
+func NormalizeContactTag(tag string) (string, error) {
+    tag = strings.ToLower(strings.TrimSpace(tag))
+    if tag == "" {
+        return "", fmt.Errorf("tag must not be empty")
+    }
+
+    if len([]rune(tag)) > rBotContactTagMaxLength {
+        return "", fmt.Errorf("tag %q is longer than %d characters", tag, rBotContactTagMaxLength)
+    }
+
+    for _, r := range tag {
+        if r != '-' && r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+            return "", fmt.Errorf("tag %q may only contain letters, digits, - and _", tag)
+        }
+    }
+
+    return tag, nil
+}
+
+func NormalizeContactTags(tags []string) ([]string, error) {
+    normalized := make([]string, 0, len(tags))
+    for _, tag := range tags {
+        tag, err := NormalizeContactTag(tag)
+        if err != nil {
+            return nil, err
+        }
+
+        normalized = append(normalized, tag)
+    }
+
+    return normalized, nil
+}
+
+func splitContactTags(joined string) []string {
+    if joined == "" {
+        return []string{}
+    }
+
+    tags := strings.Split(joined, ",")
+    slices.Sort(tags)
+    return tags
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// Setting that holds "true" while automation is paused from the control group.
+const rBotSettingAutomationPaused = "automation_paused"
+
+const rBotControlHelp = `*RIVABot commands*
+/pause - hold all automated messages
+/resume - send automated messages again
+/stats today - today's messages and response times
+/cooldown reset <number> - greet the number again on its next message
+/who <number> - what we know about a contact
+/broadcast status - progress of running campaigns
+/handovers - chats handled by a human
+/resolve <number> - let the bot answer a handed over chat again
+/away [on [until <time>] [message] | off] - away mode and its reply
+/blocked - contacts blocked on our number
+/unblock <number> - unblock a contact`
+
+type RIVAOperatorAuditEntry struct {
+    ID          int64     `json:"id"`           // Unique ID of the entry
+    OperatorJID types.JID `json:"operator_jid"` // Member who sent the command
+    Command     string    `json:"command"`      // Command as sent
+    Authorised  bool      `json:"authorised"`   // If the member is allowed to control the bot
+    Result      string    `json:"result"`       // First line of the reply, or the error
+    CreatedAt   time.Time `json:"created_at"`   // When the command was received
+}
+
+func ControlGroupJID() (types.JID, bool) {
+    if rBotControlGroup == "" {
+        return types.EmptyJID, false
+    }
+
+    jid, err := types.ParseJID(rBotControlGroup)
+    if err != nil || jid.Server != types.GroupServer {
+        return types.EmptyJID, false
+    }
+
+    return jid, true
+}
+
+// Members of the control group may only run commands if they are listed in
+// control_operators. Messages sent from the bot's own number always may.
+func (rc *RIVAClient) IsControlOperator(msg RIVAClientMessage) bool {
+    if msg.IsSentByMe() {
+        return true
+    }
+
+    for _, operator := range rBotControlOperators {
+        jid, err := ParseRecipientJID(operator)
+        if err != nil {
+            rc.Log.Warnf("Ignoring invalid control operator %q: %v", operator, err)
+            continue
+        }
+
+        if rc.Resolver.Canonical(jid) == msg.FromNonAD {
+            return true
+        }
+    }
+
+    return false
+}
+
+func (rc *RIVAClient) IsAutomationPaused() bool {
+    value, _, err := rc.DB.GetSetting(rBotSettingAutomationPaused)
+    return err == nil && value == "true"
+}
+
+func (rc *RIVAClient) SetAutomationPaused(paused bool, updatedBy string) error {
+    return rc.DB.SetSetting(rBotSettingAutomationPaused, fmt.Sprint(paused), updatedBy)
+}
+
+func (rc *RIVAClient) SendControlMessage(text string) (whatsmeow.SendResponse, error) {
+    group, found := ControlGroupJID()
+    if !found {
+        return whatsmeow.SendResponse{}, errors.New("control_group is not set to a valid group JID")
+    }
+
+    resp, err := rc.SendTrackedMessage(group, &waE2E.Message{Conversation: proto.String(text)}, SentControl)
+    if err != nil {
+        rc.Log.Errorf("Failed to send message to control group %s: %v", group, err)
+    }
+
+    return resp, err
+}
+
+/*
+ * Runs a command sent to the control group and answers it there. Every
+ * command is audited, including the ones from members who are not operators,
+ * so there is a record of who tried to do what.
+ */
+func (rc *RIVAClient) HandleControlCommand(msg RIVAClientMessage) {
+    command := strings.TrimSpace(msg.Content)
+    entry := RIVAOperatorAuditEntry{
+        OperatorJID: msg.FromNonAD,
+        Command:     command,
+        Authorised:  rc.IsControlOperator(msg),
+        CreatedAt:   msg.Timestamp,
+    }
+
+    var reply string
+    if !entry.Authorised {
+        reply = "Sorry, you are not allowed to control the bot."
+        rc.Log.Warnf("Rejected control command %q from %s", command, msg.FromNonAD)
+    } else {
+        var err error
+        if reply, err = rc.RunControlCommand(msg.FromNonAD, command); err != nil {
+            reply = "Failed: " + err.Error()
+        }
+
+        rc.Log.Infof("Control command %q from %s: %s", command, msg.FromNonAD, reply)
+    }
+
+    entry.Result, _, _ = strings.Cut(reply, "\n")
+    rc.DB.RecordOperatorCommand(entry)
+    rc.SendControlMessage(reply)
+}
+
+func (rc *RIVAClient) RunControlCommand(operator types.JID, command string) (string, error) {
+    fields := strings.Fields(strings.ToLower(command))
+    if len(fields) == 0 {
+        return rBotControlHelp, nil
+    }
+
+    switch {
+    case fields[0] == "/help":
+        return rBotControlHelp, nil
+    case fields[0] == "/pause":
+        return rc.controlSetPaused(operator, true)
+    case fields[0] == "/resume":
+        return rc.controlSetPaused(operator, false)
+    case fields[0] == "/stats" && (len(fields) == 1 || fields[1] == "today"):
+        return rc.controlStatsToday(time.Now())
+    case fields[0] == "/cooldown" && len(fields) > 2 && fields[1] == "reset":
+        return rc.controlCooldownReset(strings.Join(fields[2:], ""))
+    case fields[0] == "/who" && len(fields) > 1:
+        return rc.controlWho(strings.Join(fields[1:], ""))
+    case fields[0] == "/broadcast" && len(fields) == 2 && fields[1] == "status":
+        return rc.controlBroadcastStatus()
+    case fields[0] == "/handovers":
+        return rc.controlHandovers()
+    case fields[0] == "/resolve" && len(fields) > 1:
+        return rc.controlResolve(strings.Join(fields[1:], ""))
+    case fields[0] == "/away":
+        return rc.controlAway(operator, command)
+    case fields[0] == "/blocked":
+        return rc.controlBlocked()
+    case fields[0] == "/unblock" && len(fields) > 1:
+        return rc.controlUnblock(strings.Join(fields[1:], ""))
+    }
+
+    return fmt.Sprintf("Unknown command %q, send /help for the list.", command), nil
+}
+
+func (rc *RIVAClient) controlSetPaused(operator types.JID, paused bool) (string, error) {
+    if rc.IsAutomationPaused() == paused {
+        if paused {
+            return "Automation is already paused.", nil
+        }
+
+        return "Automation is not paused.", nil
+    }
+
+    if err := rc.SetAutomationPaused(paused, operator.String()); err != nil {
+        return "", err
+    }
+
+    if paused {
+        return "Automation paused. Greetings, menus, forms, scheduled messages and campaigns are on hold until /resume.", nil
+    }
+
+    return "Automation resumed.", nil
+}
+
+func (rc *RIVAClient) controlStatsToday(now time.Time) (string, error) {
+    local := now.In(ScheduleLocation())
+    midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+
+    archived, err := rc.DB.CountArchivedMessages(midnight)
+    if err != nil {
+        return "", err
+    }
+
+    sent, err := rc.DB.CountSentMessages(midnight)
+    if err != nil {
+        return "", err
+    }
+
+    conversations, err := rc.DB.ListConversations(midnight, now)
+    if err != nil {
+        return "", err
+    }
+
+    var sb strings.Builder
+    fmt.Fprintf(&sb, "*Today so far* (%s)\n", local.Format("Mon 2 Jan, 15:04"))
+    fmt.Fprintf(&sb, "\nReceived: %d messages", archived[DirectionIncoming])
+
+    total := 0
+    kinds := make([]RIVASentKind, 0, len(sent))
+    for kind, count := range sent {
+        kinds = append(kinds, kind)
+        total += count
+    }
+
+    slices.Sort(kinds)
+    fmt.Fprintf(&sb, "\nSent: %d messages", total)
+    for _, kind := range kinds {
+        fmt.Fprintf(&sb, "\n• %s: %d", strings.ToLower(string(kind)), sent[kind])
+    }
+
+    fmt.Fprintf(&sb, "\n\nConversations: %s", ComputeSLAStats(conversations, midnight, now, now))
+    if rc.IsAutomationPaused() {
+        sb.WriteString("\n\n_Automation is paused._")
+    }
+
+    return sb.String(), nil
+}
+
+func (rc *RIVAClient) controlCooldownReset(number string) (string, error) {
+    jid, err := ParseRecipientJID(number)
+    if err != nil {
+        return "", err
+    }
+
+    jid = rc.Resolver.Canonical(jid)
+    deleted, err := rc.DB.DeleteLastInteraction(jid)
+    if err != nil {
+        return "", err
+    }
+
+    if !deleted {
+        return fmt.Sprintf("%s has no greeting cooldown.", FormatNumber(jid)), nil
+    }
+
+    return fmt.Sprintf("Greeting cooldown reset for %s, their next message will be greeted.", FormatNumber(jid)), nil
+}
+
+func (rc *RIVAClient) controlWho(number string) (string, error) {
+    jid, err := ParseRecipientJID(number)
+    if err != nil {
+        return "", err
+    }
+
+    jid = rc.Resolver.Canonical(jid)
+    contact, found, err := rc.DB.GetContact(jid)
+    if err != nil {
+        return "", err
+    }
+
+    if !found {
+        return fmt.Sprintf("No contact with %s.", FormatNumber(jid)), nil
+    }
+
+    var sb strings.Builder
+    fmt.Fprintf(&sb, "*%s* (%s)\n", contact.DisplayName(), FormatNumber(jid))
+    fmt.Fprintf(&sb, "\nFirst seen: %s", formatCLITime(contact.FirstSeen))
+    fmt.Fprintf(&sb, "\nLast seen: %s", formatCLITime(contact.LastSeen))
+    fmt.Fprintf(&sb, "\nMessages: %d received, %d sent", contact.MessagesReceived, contact.MessagesSent)
+    if len(contact.Tags) > 0 {
+        fmt.Fprintf(&sb, "\nTags: %s", strings.Join(contact.Tags, ", "))
+    }
+
+    if labels, err := rc.DB.ListChatLabels(jid); err == nil && len(labels) > 0 {
+        names := make([]string, 0, len(labels))
+        for _, label := range labels {
+            names = append(names, label.Name)
+        }
+
+        fmt.Fprintf(&sb, "\nLabels: %s", strings.Join(names, ", "))
+    }
+
+    if suppressed, err := rc.DB.IsSuppressed(jid); err == nil && suppressed {
+        sb.WriteString("\nOpted out of automated messages")
+    }
+
+    if last, found, err := rc.DB.GetLastInteractionTime(jid); err == nil && found {
+        fmt.Fprintf(&sb, "\nGreeting cooldown until: %s", formatCLITime(last.Add(time.Duration(rBotGreetingCooldownHours * float64(time.Hour)))))
+    }
+
+    if b, found, err := rc.DB.GetBlockedContact(jid); err == nil && found {
+        fmt.Fprintf(&sb, "\nBlocked since %s (%s)", formatCLITime(b.BlockedAt), describeBlock(b))
+    }
+
+    if h, found, err := rc.DB.GetHandover(jid, time.Now()); err == nil && found {
+        fmt.Fprintf(&sb, "\nHandled by a human until %s", formatCLITime(h.ExpiresAt))
+    }
+
+    if c, found, err := rc.DB.GetLatestConversation(jid); err == nil && found {
+        waited := c.ResponseTime(time.Now()).Round(time.Minute)
+        if c.FirstResponseAt.IsZero() {
+            fmt.Fprintf(&sb, "\nWaiting for a reply for %s", waited)
+        } else {
+            fmt.Fprintf(&sb, "\nLast conversation answered after %s", waited)
+        }
+    }
+
+    return sb.String(), nil
+}
+
+func (rc *RIVAClient) controlBroadcastStatus() (string, error) {
+    campaigns, err := rc.DB.ListCampaigns()
+    if err != nil {
+        return "", err
+    }
+
+    var sb strings.Builder
+    sb.WriteString("*Campaigns*")
+    active := 0
+    for _, campaign := range campaigns {
+        if campaign.Status != CampaignRunning && campaign.Status != CampaignPaused {
+            continue
+        }
+
+        report, found, err := rc.DB.GetCampaignReport(campaign.ID)
+        if err != nil || !found {
+            continue
+        }
+
+        active++
+        fmt.Fprintf(&sb, "\n\n#%d %s (%s)\n%d/%d sent, %d failed, %.0f%% read",
+                    campaign.ID, campaign.Name, campaign.Status,
+                    report.Total - report.Counts[RecipientQueued], report.Total,
+                    report.Counts[RecipientFailed], 100 * report.ReadRate)
+    }
+
+    if active == 0 {
+        return "No campaigns are running or paused.", nil
+    }
+
+    switch {
+    case rc.IsAutomationPaused():
+        sb.WriteString("\n\n_Automation is paused, nothing is being sent._")
+    case InCampaignQuietHours(time.Now()):
+        sb.WriteString("\n\n_Quiet hours, sending resumes at " + rBotCampaignQuietHoursEnd + "._")
+    }
+
+    return sb.String(), nil
+}
+
+func (rc *RIVAClient) controlHandovers() (string, error) {
+    handovers, err := rc.DB.ListHandovers(time.Now())
+    if err != nil {
+        return "", err
+    }
+
+    if len(handovers) == 0 {
+        return "No chats are handled by a human.", nil
+    }
+
+    var sb strings.Builder
+    fmt.Fprintf(&sb, "*Handed over* (%d)\n", len(handovers))
+    for _, h := range handovers {
+        name := h.ChatJID.User
+        if contact, found, err := rc.DB.GetContact(h.ChatJID); err == nil && found {
+            name = contact.DisplayName()
+        }
+
+        fmt.Fprintf(&sb, "\n• %s (%s), %s, until %s", name, FormatNumber(h.ChatJID), strings.ToLower(string(h.Reason)), formatCLITime(h.ExpiresAt))
+    }
+
+    return sb.String(), nil
+}
+
+func (rc *RIVAClient) controlResolve(number string) (string, error) {
+    jid, err := ParseRecipientJID(number)
+    if err != nil {
+        return "", err
+    }
+
+    jid = rc.Resolver.Canonical(jid)
+    resolved, err := rc.DB.ResolveHandover(jid, time.Now())
+    if err != nil {
+        return "", err
+    }
+
+    if !resolved {
+        return fmt.Sprintf("%s is not handled by a human.", FormatNumber(jid)), nil
+    }
+
+    return fmt.Sprintf("Handover of %s resolved, the bot will answer the chat again.", FormatNumber(jid)), nil
+}
+
+// The away message is taken from the command as sent, so its case and line
+// breaks are kept.
+func (rc *RIVAClient) controlAway(operator types.JID, command string) (string, error) {
+    _, rest := cutToken(command)
+    action, rest := cutToken(rest)
+    now := time.Now()
+
+    switch strings.ToLower(action) {
+    case "":
+        away, found, err := rc.DB.GetAwayMode()
+        if err != nil {
+            return "", err
+        }
+
+        return DescribeAwayMode(away, found, now), nil
+    case "off":
+        cleared, err := rc.DB.ClearAwayMode()
+        if err != nil {
+            return "", err
+        }
+
+        if !cleared {
+            return "Away mode is not on.", nil
+        }
+
+        return "Away mode is off, contacts get the greeting again.", nil
+    case "on":
+        away, err := ParseAwayCommand(rest, operator.String(), now)
+        if err != nil {
+            return "", err
+        }
+
+        if err := rc.DB.SetAwayMode(away); err != nil {
+            return "", err
+        }
+
+        return DescribeAwayMode(away, true, now), nil
+    }
+
+    return "Usage: /away [on [until <time>] [message] | off]", nil
+}
+
+func describeBlock(b RIVABlockedContact) string {
+    if b.Source == BlockedByFloodGuard {
+        return "flood guard, " + strings.ToLower(b.Reason)
+    }
+
+    return "blocked on WhatsApp"
+}
+
+func (rc *RIVAClient) controlBlocked() (string, error) {
+    blocked, err := rc.DB.ListBlockedContacts()
+    if err != nil {
+        return "", err
+    }
+
+    if len(blocked) == 0 {
+        return "No contacts are blocked.", nil
+    }
+
+    var sb strings.Builder
+    fmt.Fprintf(&sb, "*Blocked* (%d)\n", len(blocked))
+    for _, b := range blocked {
+        fmt.Fprintf(&sb, "\n• %s since %s, %s", FormatNumber(b.JID), formatCLITime(b.BlockedAt), describeBlock(b))
+    }
+
+    return sb.String(), nil
+}
+
+func (rc *RIVAClient) controlUnblock(number string) (string, error) {
+    jid, err := ParseRecipientJID(number)
+    if err != nil {
+        return "", err
+    }
+
+    jid = rc.Resolver.Canonical(jid)
+    if err := rc.UnblockContact(jid); err != nil {
+        return "", err
+    }
+
+    return fmt.Sprintf("Unblocked %s.", FormatNumber(jid)), nil
+}
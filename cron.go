@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Minimal standard 5-field cron expression:
+//
+//   minute hour day-of-month month day-of-week
+//
+// Each field accepts *, single values, ranges (1-5), lists (1,3,5) and steps
+// (*/15, 0-30/10). Day-of-week is 0-6 starting on Sunday, 7 is also Sunday.
+// As in Vixie cron, if both day fields are restricted a time matches when
+// either of them does.
+type RIVACronSchedule struct {
+    minutes  map[int]bool
+    hours    map[int]bool
+    days     map[int]bool
+    months   map[int]bool
+    weekdays map[int]bool
+
+    anyDay     bool
+    anyWeekday bool
+}
+
+func ParseCronSchedule(expr string) (*RIVACronSchedule, error) {
+    fields := strings.Fields(expr)
+    if len(fields) != 5 {
+        return nil, fmt.Errorf("cron expression %q must have 5 fields, got %d", expr, len(fields))
+    }
+
+    bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+    sets := [5]map[int]bool{}
+    for i, field := range fields {
+        set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+        if err != nil {
+            return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+        }
+
+        sets[i] = set
+    }
+
+    if sets[4][7] {
+        sets[4][0] = true
+    }
+
+    return &RIVACronSchedule{
+        minutes:    sets[0],
+        hours:      sets[1],
+        days:       sets[2],
+        months:     sets[3],
+        weekdays:   sets[4],
+        anyDay:     fields[2] == "*",
+        anyWeekday: fields[4] == "*",
+    }, nil
+}
+
+// Returns the first matching minute strictly after the given time, or the
+// zero time if there is none within the next 5 years (e.g. 30 February).
+func (cs *RIVACronSchedule) Next(after time.Time) time.Time {
+    t := after.Truncate(time.Minute).Add(time.Minute)
+    limit := after.AddDate(5, 0, 0)
+
+    for t.Before(limit) {
+        if !cs.months[int(t.Month())] {
+            t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+            continue
+        }
+
+        if !cs.matchesDay(t) {
+            t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+            continue
+        }
+
+        if !cs.hours[t.Hour()] {
+            t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+            continue
+        }
+
+        if !cs.minutes[t.Minute()] {
+            t = t.Add(time.Minute)
+            continue
+        }
+
+        return t
+    }
+
+    return time.Time{}
+}
+
+func (cs *RIVACronSchedule) matchesDay(t time.Time) bool {
+    dayMatch := cs.days[t.Day()]
+    weekdayMatch := cs.weekdays[int(t.Weekday())]
+
+    switch {
+    case cs.anyDay && cs.anyWeekday:
+        return true
+    case cs.anyDay:
+        return weekdayMatch
+    case cs.anyWeekday:
+        return dayMatch
+    }
+
+    return dayMatch || weekdayMatch
+}
+
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+    set := make(map[int]bool)
+
+    for _, part := range strings.Split(field, ",") {
+        rangePart, step := part, 1
+        if idx := strings.Index(part, "/"); idx >= 0 {
+            var err error
+            rangePart = part[:idx]
+            step, err = strconv.Atoi(part[idx+1:])
+            if err != nil || step <= 0 {
+                return nil, fmt.Errorf("invalid step in %q", part)
+            }
+        }
+
+        lo, hi := min, max
+        switch {
+        case rangePart == "*":
+        case strings.Contains(rangePart, "-"):
+            bounds := strings.SplitN(rangePart, "-", 2)
+            var errLo, errHi error
+            lo, errLo = strconv.Atoi(bounds[0])
+            hi, errHi = strconv.Atoi(bounds[1])
+            if errLo != nil || errHi != nil {
+                return nil, fmt.Errorf("invalid range %q", rangePart)
+            }
+        default:
+            value, err := strconv.Atoi(rangePart)
+            if err != nil {
+                return nil, fmt.Errorf("invalid value %q", rangePart)
+            }
+
+            lo, hi = value, value
+            if step > 1 {
+                hi = max
+            }
+        }
+
+        if lo < min || hi > max || lo > hi {
+            return nil, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+        }
+
+        for v := lo; v <= hi; v += step {
+            set[v] = true
+        }
+    }
+
+    return set, nil
+}
@@ -2,12 +2,54 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"go.mau.fi/whatsmeow/types"
 )
 
+type RIVAProcessedMessageStatus string
+const (
+    ProcessedStatusProcessing RIVAProcessedMessageStatus = "PROCESSING"
+    ProcessedStatusCompleted  RIVAProcessedMessageStatus = "COMPLETED"
+)
+
+type RIVAProcessedMessage struct {
+    ChatJID     types.JID                  `json:"chat_jid"`     // Chat the message belongs to
+    MessageID   string                     `json:"message_id"`   // Unique ID of the message
+    Status      RIVAProcessedMessageStatus `json:"status"`       // Pipeline status of the message
+    FirstSeen   time.Time                  `json:"first_seen"`   // When the pipeline first saw the message
+    ProcessedAt time.Time                  `json:"processed_at"` // When the status was last updated
+}
+
+// When the record is purged and the message would be handled again.
+func (pm RIVAProcessedMessage) ExpiresAt() time.Time {
+    return pm.ProcessedAt.Add(ProcessedMessageTTL())
+}
+
+type RIVAStoredMedia struct {
+    ChatJID   types.JID             // Chat the media was sent in
+    MessageID string                // ID of the message carrying the media
+    Type      RIVAClientMessageType // Message type the media came from
+    SHA256    string                // Hex SHA-256 of the file content
+    MimeType  string                // MIME type of the file
+    FileName  string                // Original file name, documents only
+    Size      int64                 // Size of the file in bytes
+    Path      string                // Path on disk, empty unless stored
+    Status    RIVAStoredMediaStatus // Download status of the media
+    CreatedAt time.Time             // When the record was created
+}
+
+type RIVAMessageEdit struct {
+    Kind            RIVAClientMessageType // TypeEdit or TypeRevoke
+    PreviousContent string                // Content before the change
+    NewContent      string                // Content after the change
+    EditedAt        time.Time             // When the change was made
+}
+
 type RIVAClientDB struct {
     RClient *RIVAClient
     DB      *sql.DB
@@ -26,19 +68,62 @@ func (*RIVAClientDB) New(rClient *RIVAClient, db *sql.DB) *RIVAClientDB {
         panic(err)
     }
 
+    for deviceID, name := range rBotRepresentatives {
+        if err := cdb.SeedRepresentative(deviceID, name); err != nil {
+            panic(err)
+        }
+    }
+
     return cdb
 }
 
 func (db *RIVAClientDB) SetupTables() error {
-    query := fmt.Sprintf(rBotSqlLastInteractionCreateQuery, rBotSqlLastInteractionTableName)
+    tables := []struct {
+        name  string
+        query string
+    }{
+        {rBotSqlLastInteractionTableName, rBotSqlLastInteractionCreateQuery},
+        {rBotSqlProcessedMessageTableName, rBotSqlProcessedMessageCreateQuery},
+        {rBotSqlArchiveTableName, rBotSqlArchiveCreateQuery},
+        {rBotSqlEditHistoryTableName, rBotSqlEditHistoryCreateQuery},
+        {rBotSqlMediaTableName, rBotSqlMediaCreateQuery},
+        {rBotSqlRepresentativeTableName, rBotSqlRepresentativeCreateQuery},
+        {rBotSqlSuppressionTableName, rBotSqlSuppressionCreateQuery},
+        {rBotSqlScheduledTableName, rBotSqlScheduledCreateQuery},
+        {rBotSqlCampaignTableName, rBotSqlCampaignCreateQuery},
+        {rBotSqlCampaignRecipientTableName, rBotSqlCampaignRecipientCreateQuery},
+        {rBotSqlSentMessageTableName, rBotSqlSentMessageCreateQuery},
+        {rBotSqlMenuSessionTableName, rBotSqlMenuSessionCreateQuery},
+        {rBotSqlFormSessionTableName, rBotSqlFormSessionCreateQuery},
+        {rBotSqlFormSubmissionTableName, rBotSqlFormSubmissionCreateQuery},
+        {rBotSqlContactTableName, rBotSqlContactCreateQuery},
+        {rBotSqlContactNameTableName, rBotSqlContactNameCreateQuery},
+        {rBotSqlContactTagTableName, rBotSqlContactTagCreateQuery},
+        {rBotSqlLabelTableName, rBotSqlLabelCreateQuery},
+        {rBotSqlChatLabelTableName, rBotSqlChatLabelCreateQuery},
+        {rBotSqlMessageLabelTableName, rBotSqlMessageLabelCreateQuery},
+        {rBotSqlConversationTableName, rBotSqlConversationCreateQuery},
+        {rBotSqlStaffForwardTableName, rBotSqlStaffForwardCreateQuery},
+        {rBotSqlHandoverTableName, rBotSqlHandoverCreateQuery},
+        {rBotSqlSettingTableName, rBotSqlSettingCreateQuery},
+        {rBotSqlOperatorAuditTableName, rBotSqlOperatorAuditCreateQuery},
+        {rBotSqlAwayReplyTableName, rBotSqlAwayReplyCreateQuery},
+        {rBotSqlFloodEventTableName, rBotSqlFloodEventCreateQuery},
+        {rBotSqlBlockedTableName, rBotSqlBlockedCreateQuery},
+    }
 
-    _, err := db.DB.Exec(query)
-    if err != nil {
-        db.Log.Errorf("Failed to create %s table: %v", rBotSqlLastInteractionTableName, err)
-        return err
+    for _, table := range tables {
+        query := fmt.Sprintf(table.query, table.name)
+
+        _, err := db.DB.Exec(query)
+        if err != nil {
+            db.Log.Errorf("Failed to create %s table: %v", table.name, err)
+            return err
+        }
+
+        db.Log.Infof("Table %s ensured to exist.", table.name)
     }
 
-    db.Log.Infof("Table %s ensured to exist.", rBotSqlLastInteractionTableName)
     return nil
 }
 
@@ -71,3 +156,2130 @@ func (db *RIVAClientDB) UpdateLastInteractionTime(userJID types.JID, timestamp t
     return nil
 }
 
+// Forgets when we last heard from a chat, so the next message gets a greeting.
+func (db *RIVAClientDB) DeleteLastInteraction(userJID types.JID) (bool, error) {
+    query := fmt.Sprintf(rBotSqlLastInteractionDeleteQuery, rBotSqlLastInteractionTableName)
+
+    result, err := db.DB.Exec(query, userJID.String())
+    if err != nil {
+        db.Log.Errorf("Failed to delete last interaction time for %s: %v", userJID.String(), err)
+        return false, err
+    }
+
+    affected, err := result.RowsAffected()
+    return affected > 0, err
+}
+
+func ProcessedMessageTTL() time.Duration {
+    return time.Duration(rBotProcessedMessageTTLHours * float64(time.Hour))
+}
+
+func (db *RIVAClientDB) processedMessageCutoff() time.Time {
+    return time.Now().UTC().Add(-ProcessedMessageTTL())
+}
+
+func (db *RIVAClientDB) GetProcessedMessage(chatJID types.JID, messageID string) (RIVAProcessedMessage, bool, error) {
+    pm := RIVAProcessedMessage{
+        ChatJID:   chatJID,
+        MessageID: messageID,
+    }
+
+    query := fmt.Sprintf(rBotSqlProcessedMessageGetQuery, rBotSqlProcessedMessageTableName)
+    err := db.DB.QueryRow(query, chatJID.String(), messageID, db.processedMessageCutoff()).Scan(&pm.Status, &pm.FirstSeen, &pm.ProcessedAt)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return RIVAProcessedMessage{}, false, nil
+        }
+
+        db.Log.Errorf("Failed to query processed state of message %s in %s: %v", messageID, chatJID.String(), err)
+        return RIVAProcessedMessage{}, false, err
+    }
+
+    return pm, true, nil
+}
+
+func (db *RIVAClientDB) SetProcessedMessageStatus(chatJID types.JID, messageID string, status RIVAProcessedMessageStatus) error {
+    now := time.Now().UTC()
+    query := fmt.Sprintf(rBotSqlProcessedMessageInsertQuery, rBotSqlProcessedMessageTableName)
+
+    _, err := db.DB.Exec(query, chatJID.String(), messageID, status, now, now)
+    if err != nil {
+        db.Log.Errorf("Failed to mark message %s in %s as %s: %v", messageID, chatJID.String(), status, err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) PurgeExpiredProcessedMessages() (int64, error) {
+    query := fmt.Sprintf(rBotSqlProcessedMessagePurgeQuery, rBotSqlProcessedMessageTableName)
+
+    res, err := db.DB.Exec(query, db.processedMessageCutoff())
+    if err != nil {
+        db.Log.Errorf("Failed to purge expired processed messages: %v", err)
+        return 0, err
+    }
+
+    return res.RowsAffected()
+}
+
+func (db *RIVAClientDB) CountProcessedMessages() (map[RIVAProcessedMessageStatus]int, error) {
+    counts := make(map[RIVAProcessedMessageStatus]int)
+
+    query := fmt.Sprintf(rBotSqlProcessedMessageCountQuery, rBotSqlProcessedMessageTableName)
+    rows, err := db.DB.Query(query)
+    if err != nil {
+        db.Log.Errorf("Failed to count processed messages: %v", err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var status RIVAProcessedMessageStatus
+        var count int
+
+        if err := rows.Scan(&status, &count); err != nil {
+            db.Log.Errorf("Failed to scan processed message count: %v", err)
+            return nil, err
+        }
+
+        counts[status] = count
+    }
+
+    return counts, rows.Err()
+}
+
+func (db *RIVAClientDB) ArchiveMessage(msg RIVAClientMessage) error {
+    chatJID := msg.Chat
+    query := fmt.Sprintf(rBotSqlArchiveInsertQuery, rBotSqlArchiveTableName)
+
+    _, err := db.DB.Exec(query,
+                         chatJID.String(),
+                         msg.ID,
+                         msg.FromNonAD.String(),
+                         msg.Direction,
+                         msg.Type,
+                         msg.Content,
+                         msg.Timestamp.UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to archive message %s in %s: %v", msg.ID, chatJID.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) UpdateArchivedContent(chatJID types.JID, messageID string, content string) error {
+    query := fmt.Sprintf(rBotSqlArchiveUpdateContentQuery, rBotSqlArchiveTableName)
+
+    _, err := db.DB.Exec(query, content, chatJID.String(), messageID)
+    if err != nil {
+        db.Log.Errorf("Failed to update archived content of message %s in %s: %v", messageID, chatJID.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+/*
+ * Applies an edit or revoke to the archived copy of the original message and
+ * records the change so the full history can be reconstructed. Messages we
+ * never archived (e.g. sent before the archive existed) only get a history
+ * entry.
+ */
+func (db *RIVAClientDB) ApplyArchivedEdit(chatJID types.JID, messageID string, kind RIVAClientMessageType, newContent string, editedAt time.Time) error {
+    tx, err := db.DB.Begin()
+    if err != nil {
+        db.Log.Errorf("Failed to begin edit of message %s in %s: %v", messageID, chatJID.String(), err)
+        return err
+    }
+    defer tx.Rollback()
+
+    var previousContent string
+    query := fmt.Sprintf(rBotSqlArchiveGetContentQuery, rBotSqlArchiveTableName)
+    err = tx.QueryRow(query, chatJID.String(), messageID).Scan(&previousContent)
+    if err != nil && err != sql.ErrNoRows {
+        db.Log.Errorf("Failed to query archived content of message %s in %s: %v", messageID, chatJID.String(), err)
+        return err
+    }
+
+    query = fmt.Sprintf(rBotSqlEditHistoryInsertQuery, rBotSqlEditHistoryTableName)
+    if _, err := tx.Exec(query, chatJID.String(), messageID, kind, previousContent, newContent, editedAt.UTC()); err != nil {
+        db.Log.Errorf("Failed to record %s of message %s in %s: %v", kind, messageID, chatJID.String(), err)
+        return err
+    }
+
+    query = fmt.Sprintf(rBotSqlArchiveUpdateContentQuery, rBotSqlArchiveTableName)
+    if _, err := tx.Exec(query, newContent, chatJID.String(), messageID); err != nil {
+        db.Log.Errorf("Failed to update archived content of message %s in %s: %v", messageID, chatJID.String(), err)
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        db.Log.Errorf("Failed to commit %s of message %s in %s: %v", kind, messageID, chatJID.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) GetEditHistory(chatJID types.JID, messageID string) ([]RIVAMessageEdit, error) {
+    query := fmt.Sprintf(rBotSqlEditHistoryListQuery, rBotSqlEditHistoryTableName)
+    rows, err := db.DB.Query(query, chatJID.String(), messageID)
+    if err != nil {
+        db.Log.Errorf("Failed to query edit history of message %s in %s: %v", messageID, chatJID.String(), err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    edits := make([]RIVAMessageEdit, 0)
+    for rows.Next() {
+        var edit RIVAMessageEdit
+        if err := rows.Scan(&edit.Kind, &edit.PreviousContent, &edit.NewContent, &edit.EditedAt); err != nil {
+            db.Log.Errorf("Failed to scan edit history of message %s: %v", messageID, err)
+            return nil, err
+        }
+
+        edits = append(edits, edit)
+    }
+
+    return edits, rows.Err()
+}
+
+func (db *RIVAClientDB) GetRepresentative(deviceID uint16) (string, bool, error) {
+    var name string
+
+    query := fmt.Sprintf(rBotSqlRepresentativeGetQuery, rBotSqlRepresentativeTableName)
+    err := db.DB.QueryRow(query, deviceID).Scan(&name)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return "", false, nil
+        }
+
+        db.Log.Errorf("Failed to query representative for device %d: %v", deviceID, err)
+        return "", false, err
+    }
+
+    return name, true, nil
+}
+
+func (db *RIVAClientDB) SetRepresentative(deviceID uint16, name string) error {
+    query := fmt.Sprintf(rBotSqlRepresentativeInsertQuery, rBotSqlRepresentativeTableName)
+
+    _, err := db.DB.Exec(query, deviceID, name, time.Now().UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to set representative for device %d: %v", deviceID, err)
+        return err
+    }
+
+    return nil
+}
+
+// Adds a representative from config.yaml unless the device already has one,
+// so names changed with /iam survive restarts.
+func (db *RIVAClientDB) SeedRepresentative(deviceID uint16, name string) error {
+    query := fmt.Sprintf(rBotSqlRepresentativeSeedQuery, rBotSqlRepresentativeTableName)
+
+    _, err := db.DB.Exec(query, deviceID, name, time.Now().UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to seed representative for device %d: %v", deviceID, err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) DeleteRepresentative(deviceID uint16) error {
+    query := fmt.Sprintf(rBotSqlRepresentativeDeleteQuery, rBotSqlRepresentativeTableName)
+
+    _, err := db.DB.Exec(query, deviceID)
+    if err != nil {
+        db.Log.Errorf("Failed to delete representative for device %d: %v", deviceID, err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) IsSuppressed(jid types.JID) (bool, error) {
+    var count int
+
+    query := fmt.Sprintf(rBotSqlSuppressionGetQuery, rBotSqlSuppressionTableName)
+    if err := db.DB.QueryRow(query, jid.String()).Scan(&count); err != nil {
+        db.Log.Errorf("Failed to query suppression list for %s: %v", jid.String(), err)
+        return false, err
+    }
+
+    return count > 0, nil
+}
+
+// Returns true if the JID was not already on the suppression list.
+func (db *RIVAClientDB) AddSuppression(jid types.JID, keyword string) (bool, error) {
+    query := fmt.Sprintf(rBotSqlSuppressionInsertQuery, rBotSqlSuppressionTableName)
+
+    res, err := db.DB.Exec(query, jid.String(), keyword, time.Now().UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to add %s to suppression list: %v", jid.String(), err)
+        return false, err
+    }
+
+    added, err := res.RowsAffected()
+    return added > 0, err
+}
+
+// Returns true if the JID was on the suppression list.
+func (db *RIVAClientDB) RemoveSuppression(jid types.JID) (bool, error) {
+    query := fmt.Sprintf(rBotSqlSuppressionDeleteQuery, rBotSqlSuppressionTableName)
+
+    res, err := db.DB.Exec(query, jid.String())
+    if err != nil {
+        db.Log.Errorf("Failed to remove %s from suppression list: %v", jid.String(), err)
+        return false, err
+    }
+
+    removed, err := res.RowsAffected()
+    return removed > 0, err
+}
+
+func (db *RIVAClientDB) GetStoredMedia(chatJID types.JID, messageID string) (RIVAStoredMedia, bool, error) {
+    sm := RIVAStoredMedia{
+        ChatJID:   chatJID,
+        MessageID: messageID,
+    }
+
+    query := fmt.Sprintf(rBotSqlMediaGetQuery, rBotSqlMediaTableName)
+    err := db.DB.QueryRow(query, chatJID.String(), messageID).Scan(&sm.Type, &sm.SHA256, &sm.MimeType, &sm.FileName, &sm.Size, &sm.Path, &sm.Status, &sm.CreatedAt)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return RIVAStoredMedia{}, false, nil
+        }
+
+        db.Log.Errorf("Failed to query stored media for message %s in %s: %v", messageID, chatJID.String(), err)
+        return RIVAStoredMedia{}, false, err
+    }
+
+    return sm, true, nil
+}
+
+func (db *RIVAClientDB) UpsertStoredMedia(chatJID types.JID, msg RIVAClientMessage, sha256 string, path string, status RIVAStoredMediaStatus) error {
+    query := fmt.Sprintf(rBotSqlMediaInsertQuery, rBotSqlMediaTableName)
+
+    _, err := db.DB.Exec(query,
+                         chatJID.String(),
+                         msg.ID,
+                         msg.Type,
+                         sha256,
+                         msg.Media.MimeType,
+                         msg.Media.FileName,
+                         msg.Media.FileLength,
+                         path,
+                         status,
+                         time.Now().UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to record media for message %s in %s: %v", msg.ID, chatJID.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+// Removes media records past the retention period and returns the paths of
+// files that are no longer referenced by any remaining record. Without a
+// retention period media is kept forever.
+func (db *RIVAClientDB) PurgeExpiredStoredMedia() ([]string, error) {
+    retention := time.Duration(rBotMediaRetentionDays * 24 * float64(time.Hour))
+    if retention <= 0 {
+        return nil, nil
+    }
+
+    cutoff := time.Now().UTC().Add(-retention)
+
+    tx, err := db.DB.Begin()
+    if err != nil {
+        db.Log.Errorf("Failed to begin media purge: %v", err)
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    rows, err := tx.Query(fmt.Sprintf(rBotSqlMediaExpiredQuery, rBotSqlMediaTableName), cutoff)
+    if err != nil {
+        db.Log.Errorf("Failed to query expired media: %v", err)
+        return nil, err
+    }
+
+    expired := make([]string, 0)
+    for rows.Next() {
+        var path string
+        if err := rows.Scan(&path); err != nil {
+            rows.Close()
+            db.Log.Errorf("Failed to scan expired media: %v", err)
+            return nil, err
+        }
+
+        expired = append(expired, path)
+    }
+    rows.Close()
+
+    if _, err := tx.Exec(fmt.Sprintf(rBotSqlMediaPurgeQuery, rBotSqlMediaTableName), cutoff); err != nil {
+        db.Log.Errorf("Failed to purge expired media: %v", err)
+        return nil, err
+    }
+
+    unreferenced := make([]string, 0)
+    for _, path := range expired {
+        var count int
+        if err := tx.QueryRow(fmt.Sprintf(rBotSqlMediaPathInUseQuery, rBotSqlMediaTableName), path).Scan(&count); err != nil {
+            db.Log.Errorf("Failed to check references to media %s: %v", path, err)
+            return nil, err
+        }
+
+        if count == 0 {
+            unreferenced = append(unreferenced, path)
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        db.Log.Errorf("Failed to commit media purge: %v", err)
+        return nil, err
+    }
+
+    return unreferenced, nil
+}
+
+// Setting that holds "true" once LID keyed rows have been migrated.
+const rBotSettingCanonicalJIDsMigrated = "canonical_jids_migrated"
+
+/*
+ * Rows written before LID resolution existed, or before a mapping was known,
+ * may be keyed by a LID. Re-key every LID we can now resolve to its phone
+ * number JID. Where both identities already have a row in a table that holds
+ * one row per chat, the newer row is kept, except for contacts, which are
+ * merged. Rows keyed by message or tag are the same under either identity
+ * and are simply joined up. This runs once; rows written since are keyed by
+ * the resolver as they come in.
+ */
+func (db *RIVAClientDB) MigrateCanonicalJIDs(resolver *RIVAClientResolver) (int, error) {
+    if done, _, err := db.GetSetting(rBotSettingCanonicalJIDsMigrated); err != nil || done == "true" {
+        return 0, err
+    }
+
+    columns := []struct {
+        table   string
+        column  string
+        newerBy string // Column that tells which of two rows for a chat is newer
+    }{
+        {rBotSqlLastInteractionTableName, "chat_jid", "last_message"},
+        {rBotSqlProcessedMessageTableName, "chat_jid", ""},
+        {rBotSqlArchiveTableName, "chat_jid", ""},
+        {rBotSqlArchiveTableName, "sender_jid", ""},
+        {rBotSqlEditHistoryTableName, "chat_jid", ""},
+        {rBotSqlMediaTableName, "chat_jid", ""},
+        {rBotSqlSuppressionTableName, "jid", "created_at"},
+        {rBotSqlScheduledTableName, "recipient_jid", ""},
+        {rBotSqlSentMessageTableName, "chat_jid", ""},
+        {rBotSqlMenuSessionTableName, "chat_jid", "updated_at"},
+        {rBotSqlFormSessionTableName, "chat_jid", "updated_at"},
+        {rBotSqlFormSubmissionTableName, "chat_jid", ""},
+        {rBotSqlContactTableName, "jid", ""},
+        {rBotSqlContactNameTableName, "jid", ""},
+        {rBotSqlContactTagTableName, "jid", ""},
+        {rBotSqlChatLabelTableName, "chat_jid", ""},
+        {rBotSqlMessageLabelTableName, "chat_jid", ""},
+        {rBotSqlConversationTableName, "chat_jid", ""},
+        {rBotSqlStaffForwardTableName, "chat_jid", ""},
+        {rBotSqlHandoverTableName, "chat_jid", "expires_at"},
+        {rBotSqlOperatorAuditTableName, "operator_jid", ""},
+        {rBotSqlAwayReplyTableName, "chat_jid", "replied_at"},
+        {rBotSqlFloodEventTableName, "jid", ""},
+        {rBotSqlBlockedTableName, "jid", "blocked_at"},
+    }
+
+    migrated := 0
+    for _, col := range columns {
+        lids, err := db.listLIDs(col.table, col.column)
+        if err != nil {
+            return migrated, err
+        }
+
+        for _, lid := range lids {
+            canonical := resolver.Canonical(lid)
+            if canonical.Server == types.HiddenUserServer {
+                continue
+            }
+
+            if err := db.migrateJID(col.table, col.column, col.newerBy, lid, canonical); err != nil {
+                return migrated, err
+            }
+
+            migrated++
+        }
+    }
+
+    return migrated, db.SetSetting(rBotSettingCanonicalJIDsMigrated, "true", "migration")
+}
+
+func (db *RIVAClientDB) listLIDs(table string, column string) ([]types.JID, error) {
+    rows, err := db.DB.Query(fmt.Sprintf(rBotSqlLidListQuery, column, table, column))
+    if err != nil {
+        db.Log.Errorf("Failed to list LIDs in %s.%s: %v", table, column, err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    lids := make([]types.JID, 0)
+    for rows.Next() {
+        var raw string
+        if err := rows.Scan(&raw); err != nil {
+            db.Log.Errorf("Failed to scan LID in %s.%s: %v", table, column, err)
+            return nil, err
+        }
+
+        lid, err := types.ParseJID(raw)
+        if err != nil {
+            db.Log.Warnf("Skipping unparseable JID %s in %s.%s: %v", raw, table, column, err)
+            continue
+        }
+
+        lids = append(lids, lid)
+    }
+
+    return lids, rows.Err()
+}
+
+func (db *RIVAClientDB) migrateJID(table string, column string, newerBy string, from types.JID, to types.JID) error {
+    tx, err := db.DB.Begin()
+    if err != nil {
+        db.Log.Errorf("Failed to begin migration of %s in %s: %v", from, table, err)
+        return err
+    }
+    defer tx.Rollback()
+
+    // Settle conflicts first, so the re-key below only leaves behind LID
+    // rows whose content already lives on under the phone number JID.
+    if table == rBotSqlContactTableName {
+        query := fmt.Sprintf(rBotSqlContactMergeQuery, table, table)
+        if _, err := tx.Exec(query, to.String(), from.String()); err != nil {
+            db.Log.Errorf("Failed to merge %s into %s in %s: %v", from, to, table, err)
+            return err
+        }
+    } else if newerBy != "" {
+        query := fmt.Sprintf(rBotSqlLidKeepNewerQuery, table, column, newerBy)
+        if _, err := tx.Exec(query, to.String(), from.String()); err != nil {
+            db.Log.Errorf("Failed to replace %s with newer %s in %s: %v", to, from, table, err)
+            return err
+        }
+    }
+
+    query := fmt.Sprintf(rBotSqlLidUpdateQuery, table, column, column)
+    if _, err := tx.Exec(query, to.String(), from.String()); err != nil {
+        db.Log.Errorf("Failed to re-key %s to %s in %s: %v", from, to, table, err)
+        return err
+    }
+
+    query = fmt.Sprintf(rBotSqlLidDeleteQuery, table, column)
+    if _, err := tx.Exec(query, from.String()); err != nil {
+        db.Log.Errorf("Failed to remove leftover %s rows in %s: %v", from, table, err)
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        db.Log.Errorf("Failed to commit migration of %s in %s: %v", from, table, err)
+        return err
+    }
+
+    db.Log.Infof("Migrated %s to %s in %s.%s", from, to, table, column)
+    return nil
+}
+
+func (db *RIVAClientDB) scanScheduledMessages(rows *sql.Rows) ([]RIVAScheduledMessage, error) {
+    defer rows.Close()
+
+    scheduled := make([]RIVAScheduledMessage, 0)
+    for rows.Next() {
+        sm, err := db.scanScheduledMessage(rows)
+        if err != nil {
+            return nil, err
+        }
+
+        scheduled = append(scheduled, sm)
+    }
+
+    return scheduled, rows.Err()
+}
+
+func (db *RIVAClientDB) scanScheduledMessage(row interface{ Scan(...any) error }) (RIVAScheduledMessage, error) {
+    var sm RIVAScheduledMessage
+    var recipient string
+    var lastSentAt sql.NullTime
+
+    err := row.Scan(&sm.ID, &recipient, &sm.Content, &sm.MediaPath, &sm.SendAt, &sm.Recurrence, &sm.Status, &sm.CreatedBy, &sm.CreatedAt, &lastSentAt, &sm.LastError)
+    if err != nil {
+        if err != sql.ErrNoRows {
+            db.Log.Errorf("Failed to scan scheduled message: %v", err)
+        }
+
+        return RIVAScheduledMessage{}, err
+    }
+
+    sm.RecipientJID, err = types.ParseJID(recipient)
+    if err != nil {
+        db.Log.Errorf("Failed to parse recipient %s of scheduled message %d: %v", recipient, sm.ID, err)
+        return RIVAScheduledMessage{}, err
+    }
+
+    if lastSentAt.Valid {
+        sm.LastSentAt = lastSentAt.Time
+    }
+
+    return sm, nil
+}
+
+func (db *RIVAClientDB) InsertScheduledMessage(sm RIVAScheduledMessage) (int64, error) {
+    query := fmt.Sprintf(rBotSqlScheduledInsertQuery, rBotSqlScheduledTableName)
+
+    res, err := db.DB.Exec(query,
+                           sm.RecipientJID.String(),
+                           sm.Content,
+                           sm.MediaPath,
+                           sm.SendAt.UTC(),
+                           sm.Recurrence,
+                           sm.Status,
+                           sm.CreatedBy,
+                           sm.CreatedAt.UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to schedule message to %s: %v", sm.RecipientJID.String(), err)
+        return 0, err
+    }
+
+    return res.LastInsertId()
+}
+
+func (db *RIVAClientDB) GetScheduledMessage(id int64) (RIVAScheduledMessage, bool, error) {
+    query := fmt.Sprintf(rBotSqlScheduledGetQuery, rBotSqlScheduledColumns, rBotSqlScheduledTableName)
+
+    sm, err := db.scanScheduledMessage(db.DB.QueryRow(query, id))
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return RIVAScheduledMessage{}, false, nil
+        }
+
+        return RIVAScheduledMessage{}, false, err
+    }
+
+    return sm, true, nil
+}
+
+func (db *RIVAClientDB) ListDueScheduledMessages(now time.Time) ([]RIVAScheduledMessage, error) {
+    query := fmt.Sprintf(rBotSqlScheduledDueQuery, rBotSqlScheduledColumns, rBotSqlScheduledTableName)
+
+    rows, err := db.DB.Query(query, now.UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to query due scheduled messages: %v", err)
+        return nil, err
+    }
+
+    return db.scanScheduledMessages(rows)
+}
+
+// Lists pending messages only, unless all is set.
+func (db *RIVAClientDB) ListScheduledMessages(all bool) ([]RIVAScheduledMessage, error) {
+    query := fmt.Sprintf(rBotSqlScheduledListQuery, rBotSqlScheduledColumns, rBotSqlScheduledTableName)
+    if all {
+        query = fmt.Sprintf(rBotSqlScheduledListAllQuery, rBotSqlScheduledColumns, rBotSqlScheduledTableName)
+    }
+
+    rows, err := db.DB.Query(query)
+    if err != nil {
+        db.Log.Errorf("Failed to query scheduled messages: %v", err)
+        return nil, err
+    }
+
+    return db.scanScheduledMessages(rows)
+}
+
+// Returns true if the message was pending and is now cancelled.
+func (db *RIVAClientDB) CancelScheduledMessage(id int64) (bool, error) {
+    query := fmt.Sprintf(rBotSqlScheduledCancelQuery, rBotSqlScheduledTableName)
+
+    res, err := db.DB.Exec(query, id)
+    if err != nil {
+        db.Log.Errorf("Failed to cancel scheduled message %d: %v", id, err)
+        return false, err
+    }
+
+    cancelled, err := res.RowsAffected()
+    return cancelled > 0, err
+}
+
+func (db *RIVAClientDB) UpdateScheduledMessageState(id int64, status RIVAScheduledStatus, sendAt time.Time, lastSentAt time.Time, lastError string) error {
+    var sentAt sql.NullTime
+    if !lastSentAt.IsZero() {
+        sentAt = sql.NullTime{Time: lastSentAt.UTC(), Valid: true}
+    }
+
+    query := fmt.Sprintf(rBotSqlScheduledUpdateQuery, rBotSqlScheduledTableName)
+    if _, err := db.DB.Exec(query, status, sendAt.UTC(), sentAt, lastError, id); err != nil {
+        db.Log.Errorf("Failed to update scheduled message %d: %v", id, err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) scanCampaign(row interface{ Scan(...any) error }) (RIVACampaign, error) {
+    var c RIVACampaign
+    err := row.Scan(&c.ID, &c.Name, &c.Template, &c.MediaPath, &c.Status, &c.CreatedAt, &c.UpdatedAt)
+    if err != nil && err != sql.ErrNoRows {
+        db.Log.Errorf("Failed to scan campaign: %v", err)
+    }
+
+    return c, err
+}
+
+// Creates the campaign as a draft together with its audience.
+func (db *RIVAClientDB) InsertCampaign(campaign RIVACampaign, recipients []RIVACampaignRecipient) (int64, error) {
+    tx, err := db.DB.Begin()
+    if err != nil {
+        db.Log.Errorf("Failed to begin campaign import: %v", err)
+        return 0, err
+    }
+    defer tx.Rollback()
+
+    now := time.Now().UTC()
+    res, err := tx.Exec(fmt.Sprintf(rBotSqlCampaignInsertQuery, rBotSqlCampaignTableName),
+                        campaign.Name, campaign.Template, campaign.MediaPath, CampaignDraft, now, now)
+    if err != nil {
+        db.Log.Errorf("Failed to create campaign %s: %v", campaign.Name, err)
+        return 0, err
+    }
+
+    id, err := res.LastInsertId()
+    if err != nil {
+        return 0, err
+    }
+
+    query := fmt.Sprintf(rBotSqlCampaignRecipientInsertQuery, rBotSqlCampaignRecipientTableName)
+    for _, recipient := range recipients {
+        variables, err := json.Marshal(recipient.Variables)
+        if err != nil {
+            return 0, err
+        }
+
+        if _, err := tx.Exec(query, id, recipient.JID.String(), recipient.Phone, string(variables), RecipientQueued, now); err != nil {
+            db.Log.Errorf("Failed to add %s to campaign %d: %v", recipient.JID.String(), id, err)
+            return 0, err
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        db.Log.Errorf("Failed to commit campaign import: %v", err)
+        return 0, err
+    }
+
+    return id, nil
+}
+
+func (db *RIVAClientDB) GetCampaign(id int64) (RIVACampaign, bool, error) {
+    query := fmt.Sprintf(rBotSqlCampaignGetQuery, rBotSqlCampaignTableName)
+
+    campaign, err := db.scanCampaign(db.DB.QueryRow(query, id))
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return RIVACampaign{}, false, nil
+        }
+
+        return RIVACampaign{}, false, err
+    }
+
+    return campaign, true, nil
+}
+
+func (db *RIVAClientDB) listCampaigns(queryTemplate string) ([]RIVACampaign, error) {
+    rows, err := db.DB.Query(fmt.Sprintf(queryTemplate, rBotSqlCampaignTableName))
+    if err != nil {
+        db.Log.Errorf("Failed to query campaigns: %v", err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    campaigns := make([]RIVACampaign, 0)
+    for rows.Next() {
+        campaign, err := db.scanCampaign(rows)
+        if err != nil {
+            return nil, err
+        }
+
+        campaigns = append(campaigns, campaign)
+    }
+
+    return campaigns, rows.Err()
+}
+
+func (db *RIVAClientDB) ListCampaigns() ([]RIVACampaign, error) {
+    return db.listCampaigns(rBotSqlCampaignListQuery)
+}
+
+func (db *RIVAClientDB) ListRunningCampaigns() ([]RIVACampaign, error) {
+    return db.listCampaigns(rBotSqlCampaignRunningQuery)
+}
+
+// Moves the campaign to status if it is currently in one of the from
+// statuses. Returns true if the status changed.
+func (db *RIVAClientDB) SetCampaignStatus(id int64, status RIVACampaignStatus, from ...RIVACampaignStatus) (bool, error) {
+    placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(from)), ", ")
+    query := fmt.Sprintf(rBotSqlCampaignStatusQuery, rBotSqlCampaignTableName, placeholders)
+
+    args := []any{status, time.Now().UTC(), id}
+    for _, s := range from {
+        args = append(args, s)
+    }
+
+    res, err := db.DB.Exec(query, args...)
+    if err != nil {
+        db.Log.Errorf("Failed to set campaign %d to %s: %v", id, status, err)
+        return false, err
+    }
+
+    changed, err := res.RowsAffected()
+    return changed > 0, err
+}
+
+func (db *RIVAClientDB) ListQueuedCampaignRecipients(campaignID int64, limit int) ([]RIVACampaignRecipient, error) {
+    query := fmt.Sprintf(rBotSqlCampaignRecipientQueuedQuery, rBotSqlCampaignRecipientTableName)
+
+    rows, err := db.DB.Query(query, campaignID, limit)
+    if err != nil {
+        db.Log.Errorf("Failed to query queued recipients of campaign %d: %v", campaignID, err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    recipients := make([]RIVACampaignRecipient, 0)
+    for rows.Next() {
+        var r RIVACampaignRecipient
+        var jid, variables string
+        if err := rows.Scan(&r.CampaignID, &jid, &r.Phone, &variables, &r.Status, &r.MessageID, &r.Error, &r.UpdatedAt); err != nil {
+            db.Log.Errorf("Failed to scan recipient of campaign %d: %v", campaignID, err)
+            return nil, err
+        }
+
+        if r.JID, err = types.ParseJID(jid); err != nil {
+            db.Log.Warnf("Skipping unparseable recipient %s of campaign %d: %v", jid, campaignID, err)
+            continue
+        }
+
+        if err := json.Unmarshal([]byte(variables), &r.Variables); err != nil {
+            db.Log.Warnf("Skipping recipient %s of campaign %d with invalid variables: %v", jid, campaignID, err)
+            continue
+        }
+
+        recipients = append(recipients, r)
+    }
+
+    return recipients, rows.Err()
+}
+
+func (db *RIVAClientDB) UpdateCampaignRecipient(campaignID int64, jid types.JID, status RIVACampaignRecipientStatus, messageID string, reason string) error {
+    query := fmt.Sprintf(rBotSqlCampaignRecipientUpdateQuery, rBotSqlCampaignRecipientTableName)
+
+    _, err := db.DB.Exec(query, status, messageID, reason, time.Now().UTC(), campaignID, jid.String())
+    if err != nil {
+        db.Log.Errorf("Failed to update %s in campaign %d: %v", jid.String(), campaignID, err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) CountCampaignRecipients(campaignID int64) (map[RIVACampaignRecipientStatus]int, error) {
+    query := fmt.Sprintf(rBotSqlCampaignRecipientCountQuery, rBotSqlCampaignRecipientTableName)
+
+    rows, err := db.DB.Query(query, campaignID)
+    if err != nil {
+        db.Log.Errorf("Failed to count recipients of campaign %d: %v", campaignID, err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    counts := make(map[RIVACampaignRecipientStatus]int)
+    for rows.Next() {
+        var status RIVACampaignRecipientStatus
+        var count int
+        if err := rows.Scan(&status, &count); err != nil {
+            db.Log.Errorf("Failed to scan recipient count of campaign %d: %v", campaignID, err)
+            return nil, err
+        }
+
+        counts[status] = count
+    }
+
+    return counts, rows.Err()
+}
+
+func (db *RIVAClientDB) GetCampaignReport(id int64) (RIVACampaignReport, bool, error) {
+    campaign, found, err := db.GetCampaign(id)
+    if err != nil || !found {
+        return RIVACampaignReport{}, found, err
+    }
+
+    counts, err := db.CountCampaignRecipients(id)
+    if err != nil {
+        return RIVACampaignReport{}, true, err
+    }
+
+    report := RIVACampaignReport{Campaign: campaign, Counts: counts}
+    for _, count := range counts {
+        report.Total += count
+    }
+
+    sent := counts[RecipientSent] + counts[RecipientDelivered] + counts[RecipientRead]
+    if sent > 0 {
+        report.ReadRate = float64(counts[RecipientRead]) / float64(sent)
+    }
+
+    return report, true, nil
+}
+
+// Receipts only ever move a recipient forward, so a late delivery receipt
+// does not overwrite a read one.
+func (db *RIVAClientDB) ApplyCampaignReceipt(messageIDs []string, status RIVACampaignRecipientStatus) error {
+    from := "'SENT'"
+    if status == RecipientRead {
+        from = "'SENT', 'DELIVERED'"
+    }
+
+    query := fmt.Sprintf(rBotSqlCampaignRecipientReceiptQuery, rBotSqlCampaignRecipientTableName, from)
+    for _, messageID := range messageIDs {
+        if _, err := db.DB.Exec(query, status, time.Now().UTC(), messageID); err != nil {
+            db.Log.Errorf("Failed to apply %s receipt to campaign message %s: %v", status, messageID, err)
+            return err
+        }
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) RecordSentMessage(chatJID types.JID, messageID string, kind RIVASentKind, sentAt time.Time) error {
+    query := fmt.Sprintf(rBotSqlSentMessageInsertQuery, rBotSqlSentMessageTableName)
+
+    _, err := db.DB.Exec(query, chatJID.String(), messageID, kind, ReceiptSent, sentAt.UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to record sent message %s in %s: %v", messageID, chatJID.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) scanSentMessage(row interface{ Scan(...any) error }) (RIVASentMessage, error) {
+    var sm RIVASentMessage
+    var chatJID string
+    var deliveredAt, readAt, playedAt sql.NullTime
+
+    err := row.Scan(&chatJID, &sm.MessageID, &sm.Kind, &sm.Status, &sm.SentAt, &deliveredAt, &readAt, &playedAt)
+    if err != nil {
+        if err != sql.ErrNoRows {
+            db.Log.Errorf("Failed to scan sent message: %v", err)
+        }
+
+        return RIVASentMessage{}, err
+    }
+
+    if sm.ChatJID, err = types.ParseJID(chatJID); err != nil {
+        db.Log.Errorf("Failed to parse chat %s of sent message %s: %v", chatJID, sm.MessageID, err)
+        return RIVASentMessage{}, err
+    }
+
+    sm.DeliveredAt = deliveredAt.Time
+    sm.ReadAt = readAt.Time
+    sm.PlayedAt = playedAt.Time
+    return sm, nil
+}
+
+func (db *RIVAClientDB) GetSentMessage(messageID string) (RIVASentMessage, bool, error) {
+    query := fmt.Sprintf(rBotSqlSentMessageGetQuery, rBotSqlSentMessageColumns, rBotSqlSentMessageTableName)
+
+    sm, err := db.scanSentMessage(db.DB.QueryRow(query, messageID))
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return RIVASentMessage{}, false, nil
+        }
+
+        return RIVASentMessage{}, false, err
+    }
+
+    return sm, true, nil
+}
+
+// Lists the most recent messages we sent to the chat, newest first.
+func (db *RIVAClientDB) ListSentMessages(chatJID types.JID, limit int) ([]RIVASentMessage, error) {
+    query := fmt.Sprintf(rBotSqlSentMessageListQuery, rBotSqlSentMessageColumns, rBotSqlSentMessageTableName)
+
+    rows, err := db.DB.Query(query, chatJID.String(), limit)
+    if err != nil {
+        db.Log.Errorf("Failed to query sent messages in %s: %v", chatJID.String(), err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    sent := make([]RIVASentMessage, 0)
+    for rows.Next() {
+        sm, err := db.scanSentMessage(rows)
+        if err != nil {
+            return nil, err
+        }
+
+        sent = append(sent, sm)
+    }
+
+    return sent, rows.Err()
+}
+
+func (db *RIVAClientDB) GetChatReceiptSummary(chatJID types.JID) (RIVAChatReceiptSummary, error) {
+    summary := RIVAChatReceiptSummary{
+        ChatJID: chatJID,
+        Counts:  make(map[RIVAReceiptStatus]int),
+    }
+
+    query := fmt.Sprintf(rBotSqlSentMessageCountQuery, rBotSqlSentMessageTableName)
+    rows, err := db.DB.Query(query, chatJID.String())
+    if err != nil {
+        db.Log.Errorf("Failed to count sent messages in %s: %v", chatJID.String(), err)
+        return summary, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var status RIVAReceiptStatus
+        var count int
+        if err := rows.Scan(&status, &count); err != nil {
+            db.Log.Errorf("Failed to scan sent message count in %s: %v", chatJID.String(), err)
+            return summary, err
+        }
+
+        summary.Counts[status] = count
+    }
+
+    last, err := db.ListSentMessages(chatJID, 1)
+    if err != nil {
+        return summary, err
+    }
+
+    if len(last) > 0 {
+        summary.LastSent = &last[0]
+    }
+
+    return summary, nil
+}
+
+/*
+ * A read receipt implies delivery and a played receipt implies both, so the
+ * earlier timestamps are filled in as well when they are still missing.
+ */
+func (db *RIVAClientDB) ApplySentMessageReceipt(messageIDs []string, status RIVAReceiptStatus, timestamp time.Time) error {
+    rank := slices.Index(rBotReceiptOrder, status)
+    if rank < 1 {
+        return fmt.Errorf("not a receipt status: %s", status)
+    }
+
+    lower := make([]string, 0, rank)
+    for _, s := range rBotReceiptOrder[:rank] {
+        lower = append(lower, fmt.Sprintf("'%s'", s))
+    }
+
+    // delivered_at, read_at and played_at, up to and including this status.
+    var stamps [3]any
+    for i := 0; i < rank; i++ {
+        stamps[i] = timestamp.UTC()
+    }
+
+    query := fmt.Sprintf(rBotSqlSentMessageReceiptQuery, rBotSqlSentMessageTableName, strings.Join(lower, ", "))
+    for _, messageID := range messageIDs {
+        if _, err := db.DB.Exec(query, status, stamps[0], stamps[1], stamps[2], messageID); err != nil {
+            db.Log.Errorf("Failed to apply %s receipt to message %s: %v", status, messageID, err)
+            return err
+        }
+    }
+
+    return nil
+}
+
+// Returns the menu last shown in the chat and when it was shown.
+func (db *RIVAClientDB) GetMenuSession(chatJID types.JID) (string, time.Time, bool, error) {
+    var menuID string
+    var updatedAt time.Time
+
+    query := fmt.Sprintf(rBotSqlMenuSessionGetQuery, rBotSqlMenuSessionTableName)
+    err := db.DB.QueryRow(query, chatJID.String()).Scan(&menuID, &updatedAt)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return "", time.Time{}, false, nil
+        }
+
+        db.Log.Errorf("Failed to query menu session for %s: %v", chatJID.String(), err)
+        return "", time.Time{}, false, err
+    }
+
+    return menuID, updatedAt, true, nil
+}
+
+func (db *RIVAClientDB) SetMenuSession(chatJID types.JID, menuID string, updatedAt time.Time) error {
+    query := fmt.Sprintf(rBotSqlMenuSessionInsertQuery, rBotSqlMenuSessionTableName)
+
+    if _, err := db.DB.Exec(query, chatJID.String(), menuID, updatedAt.UTC()); err != nil {
+        db.Log.Errorf("Failed to set menu session for %s: %v", chatJID.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) GetFormSession(chatJID types.JID) (RIVAFormSession, bool, error) {
+    session := RIVAFormSession{ChatJID: chatJID}
+    var answers string
+
+    query := fmt.Sprintf(rBotSqlFormSessionGetQuery, rBotSqlFormSessionTableName)
+    err := db.DB.QueryRow(query, chatJID.String()).Scan(&session.FormID, &session.Step, &answers, &session.StartedAt, &session.UpdatedAt)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return RIVAFormSession{}, false, nil
+        }
+
+        db.Log.Errorf("Failed to query form session for %s: %v", chatJID.String(), err)
+        return RIVAFormSession{}, false, err
+    }
+
+    if err := json.Unmarshal([]byte(answers), &session.Answers); err != nil {
+        db.Log.Errorf("Failed to parse form answers for %s: %v", chatJID.String(), err)
+        return RIVAFormSession{}, false, err
+    }
+
+    return session, true, nil
+}
+
+func (db *RIVAClientDB) SaveFormSession(session RIVAFormSession) error {
+    answers, err := json.Marshal(session.Answers)
+    if err != nil {
+        return err
+    }
+
+    query := fmt.Sprintf(rBotSqlFormSessionInsertQuery, rBotSqlFormSessionTableName)
+    _, err = db.DB.Exec(query,
+                        session.ChatJID.String(),
+                        session.FormID,
+                        session.Step,
+                        string(answers),
+                        session.StartedAt.UTC(),
+                        session.UpdatedAt.UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to save form session for %s: %v", session.ChatJID.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) DeleteFormSession(chatJID types.JID) error {
+    query := fmt.Sprintf(rBotSqlFormSessionDeleteQuery, rBotSqlFormSessionTableName)
+
+    if _, err := db.DB.Exec(query, chatJID.String()); err != nil {
+        db.Log.Errorf("Failed to delete form session for %s: %v", chatJID.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+// Stores the answers as a submission and removes the session in one go.
+func (db *RIVAClientDB) CompleteFormSession(session RIVAFormSession) error {
+    answers, err := json.Marshal(session.Answers)
+    if err != nil {
+        return err
+    }
+
+    tx, err := db.DB.Begin()
+    if err != nil {
+        db.Log.Errorf("Failed to begin form submission: %v", err)
+        return err
+    }
+    defer tx.Rollback()
+
+    query := fmt.Sprintf(rBotSqlFormSubmissionInsertQuery, rBotSqlFormSubmissionTableName)
+    if _, err := tx.Exec(query, session.FormID, session.ChatJID.String(), string(answers), session.UpdatedAt.UTC()); err != nil {
+        db.Log.Errorf("Failed to store %s submission from %s: %v", session.FormID, session.ChatJID.String(), err)
+        return err
+    }
+
+    query = fmt.Sprintf(rBotSqlFormSessionDeleteQuery, rBotSqlFormSessionTableName)
+    if _, err := tx.Exec(query, session.ChatJID.String()); err != nil {
+        db.Log.Errorf("Failed to delete form session for %s: %v", session.ChatJID.String(), err)
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        db.Log.Errorf("Failed to commit form submission: %v", err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) ListFormSubmissions(formID string) ([]RIVAFormSubmission, error) {
+    query := fmt.Sprintf(rBotSqlFormSubmissionListQuery, rBotSqlFormSubmissionTableName)
+
+    rows, err := db.DB.Query(query, formID)
+    if err != nil {
+        db.Log.Errorf("Failed to query submissions of form %s: %v", formID, err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    submissions := make([]RIVAFormSubmission, 0)
+    for rows.Next() {
+        var s RIVAFormSubmission
+        var chatJID, answers string
+        if err := rows.Scan(&s.ID, &s.FormID, &chatJID, &answers, &s.SubmittedAt); err != nil {
+            db.Log.Errorf("Failed to scan submission of form %s: %v", formID, err)
+            return nil, err
+        }
+
+        if s.ChatJID, err = types.ParseJID(chatJID); err != nil {
+            db.Log.Warnf("Skipping submission %d with unparseable chat %s: %v", s.ID, chatJID, err)
+            continue
+        }
+
+        if err := json.Unmarshal([]byte(answers), &s.Answers); err != nil {
+            db.Log.Warnf("Skipping submission %d with invalid answers: %v", s.ID, err)
+            continue
+        }
+
+        submissions = append(submissions, s)
+    }
+
+    return submissions, rows.Err()
+}
+
+/*
+ * Counts a message to or from the contact and moves first and last seen to
+ * cover it. A non-empty push name replaces the current one and is added to
+ * the contact's push name history.
+ */
+func (db *RIVAClientDB) RecordContactMessage(jid types.JID, pushName string, at time.Time, incoming bool) error {
+    received, sent := 0, 1
+    if incoming {
+        received, sent = 1, 0
+    }
+
+    tx, err := db.DB.Begin()
+    if err != nil {
+        db.Log.Errorf("Failed to begin contact update for %s: %v", jid.String(), err)
+        return err
+    }
+    defer tx.Rollback()
+
+    query := fmt.Sprintf(rBotSqlContactSeenQuery, rBotSqlContactTableName)
+    if _, err := tx.Exec(query, jid.String(), pushName, at.UTC(), at.UTC(), received, sent); err != nil {
+        db.Log.Errorf("Failed to record message for contact %s: %v", jid.String(), err)
+        return err
+    }
+
+    if pushName != "" {
+        query = fmt.Sprintf(rBotSqlContactNameInsertQuery, rBotSqlContactNameTableName)
+        if _, err := tx.Exec(query, jid.String(), pushName, at.UTC()); err != nil {
+            db.Log.Errorf("Failed to record push name for contact %s: %v", jid.String(), err)
+            return err
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        db.Log.Errorf("Failed to commit contact update for %s: %v", jid.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) RecordContactPushName(jid types.JID, pushName string, at time.Time) error {
+    query := fmt.Sprintf(rBotSqlContactPushNameQuery, rBotSqlContactTableName)
+    if _, err := db.DB.Exec(query, jid.String(), pushName); err != nil {
+        db.Log.Errorf("Failed to set push name of contact %s: %v", jid.String(), err)
+        return err
+    }
+
+    query = fmt.Sprintf(rBotSqlContactNameInsertQuery, rBotSqlContactNameTableName)
+    if _, err := db.DB.Exec(query, jid.String(), pushName, at.UTC()); err != nil {
+        db.Log.Errorf("Failed to record push name for contact %s: %v", jid.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) SetContactBusinessName(jid types.JID, businessName string) error {
+    query := fmt.Sprintf(rBotSqlContactBusinessNameQuery, rBotSqlContactTableName)
+    if _, err := db.DB.Exec(query, jid.String(), businessName); err != nil {
+        db.Log.Errorf("Failed to set business name of contact %s: %v", jid.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+// Stores the name the contact is saved under in the bot account's address book.
+func (db *RIVAClientDB) SetContactSavedName(jid types.JID, fullName string, firstName string) error {
+    query := fmt.Sprintf(rBotSqlContactSavedNameQuery, rBotSqlContactTableName)
+    if _, err := db.DB.Exec(query, jid.String(), fullName, firstName); err != nil {
+        db.Log.Errorf("Failed to set saved name of contact %s: %v", jid.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+// Adds the tags to the contact, creating it if it is not known yet.
+func (db *RIVAClientDB) AddContactTags(jid types.JID, tags []string) error {
+    tx, err := db.DB.Begin()
+    if err != nil {
+        db.Log.Errorf("Failed to begin tagging %s: %v", jid.String(), err)
+        return err
+    }
+    defer tx.Rollback()
+
+    query := fmt.Sprintf(rBotSqlContactEnsureQuery, rBotSqlContactTableName)
+    if _, err := tx.Exec(query, jid.String()); err != nil {
+        db.Log.Errorf("Failed to create contact %s: %v", jid.String(), err)
+        return err
+    }
+
+    query = fmt.Sprintf(rBotSqlContactTagInsertQuery, rBotSqlContactTagTableName)
+    for _, tag := range tags {
+        if _, err := tx.Exec(query, jid.String(), tag, time.Now().UTC()); err != nil {
+            db.Log.Errorf("Failed to tag %s with %s: %v", jid.String(), tag, err)
+            return err
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        db.Log.Errorf("Failed to commit tags of %s: %v", jid.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) RemoveContactTags(jid types.JID, tags []string) error {
+    query := fmt.Sprintf(rBotSqlContactTagDeleteQuery, rBotSqlContactTagTableName)
+    for _, tag := range tags {
+        if _, err := db.DB.Exec(query, jid.String(), tag); err != nil {
+            db.Log.Errorf("Failed to remove tag %s from %s: %v", tag, jid.String(), err)
+            return err
+        }
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) scanContact(row interface{ Scan(...any) error }) (RIVAContact, error) {
+    var c RIVAContact
+    var jid, tags string
+    var firstSeen, lastSeen sql.NullTime
+
+    err := row.Scan(&jid, &c.PushName, &c.FullName, &c.FirstName, &c.BusinessName, &firstSeen, &lastSeen, &c.MessagesReceived, &c.MessagesSent, &tags)
+    if err != nil {
+        return RIVAContact{}, err
+    }
+
+    if c.JID, err = types.ParseJID(jid); err != nil {
+        return RIVAContact{}, err
+    }
+
+    c.FirstSeen = firstSeen.Time
+    c.LastSeen = lastSeen.Time
+    c.Tags = splitContactTags(tags)
+    return c, nil
+}
+
+// Returns the contact together with its push name history.
+func (db *RIVAClientDB) GetContact(jid types.JID) (RIVAContact, bool, error) {
+    query := fmt.Sprintf(rBotSqlContactGetQuery, rBotSqlContactTableName, rBotSqlContactTagTableName)
+    contact, err := db.scanContact(db.DB.QueryRow(query, jid.String()))
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return RIVAContact{}, false, nil
+        }
+
+        db.Log.Errorf("Failed to query contact %s: %v", jid.String(), err)
+        return RIVAContact{}, false, err
+    }
+
+    query = fmt.Sprintf(rBotSqlContactNameListQuery, rBotSqlContactNameTableName)
+    rows, err := db.DB.Query(query, jid.String())
+    if err != nil {
+        db.Log.Errorf("Failed to query push names of %s: %v", jid.String(), err)
+        return RIVAContact{}, false, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var name RIVAContactName
+        if err := rows.Scan(&name.Name, &name.FirstSeen); err != nil {
+            db.Log.Errorf("Failed to scan push name of %s: %v", jid.String(), err)
+            return RIVAContact{}, false, err
+        }
+
+        contact.PushNames = append(contact.PushNames, name)
+    }
+
+    return contact, true, rows.Err()
+}
+
+/*
+ * Lists contacts, most recently seen first. An empty tag or search matches
+ * every contact; search is a case-insensitive substring of the JID, push
+ * name, saved name or business name.
+ */
+func (db *RIVAClientDB) ListContacts(tag string, search string, limit int) ([]RIVAContact, error) {
+    like := "%" + search + "%"
+    query := fmt.Sprintf(rBotSqlContactListQuery, rBotSqlContactTableName, rBotSqlContactTagTableName)
+
+    rows, err := db.DB.Query(query, tag, tag, search, like, like, like, like, limit)
+    if err != nil {
+        db.Log.Errorf("Failed to query contacts: %v", err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    contacts := make([]RIVAContact, 0)
+    for rows.Next() {
+        contact, err := db.scanContact(rows)
+        if err != nil {
+            db.Log.Errorf("Failed to scan contact: %v", err)
+            return nil, err
+        }
+
+        contacts = append(contacts, contact)
+    }
+
+    return contacts, rows.Err()
+}
+
+// Stores a label edit. A deleted label also loses its chats and messages, so
+// it no longer shows up when listing the labels of a chat.
+func (db *RIVAClientDB) SaveLabel(label RIVALabel) error {
+    tx, err := db.DB.Begin()
+    if err != nil {
+        db.Log.Errorf("Failed to begin saving label %s: %v", label.ID, err)
+        return err
+    }
+    defer tx.Rollback()
+
+    query := fmt.Sprintf(rBotSqlLabelInsertQuery, rBotSqlLabelTableName)
+    if _, err := tx.Exec(query, label.ID, label.Name, label.Color, label.Deleted, label.UpdatedAt.UTC()); err != nil {
+        db.Log.Errorf("Failed to save label %s: %v", label.ID, err)
+        return err
+    }
+
+    if label.Deleted {
+        for _, table := range []string{rBotSqlChatLabelTableName, rBotSqlMessageLabelTableName} {
+            query = fmt.Sprintf(rBotSqlLabelAssociationDeleteQuery, table)
+            if _, err := tx.Exec(query, label.ID); err != nil {
+                db.Log.Errorf("Failed to remove associations of label %s from %s: %v", label.ID, table, err)
+                return err
+            }
+        }
+    }
+
+    if err := tx.Commit(); err != nil {
+        db.Log.Errorf("Failed to commit label %s: %v", label.ID, err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) scanLabels(rows *sql.Rows) ([]RIVALabel, error) {
+    defer rows.Close()
+
+    labels := make([]RIVALabel, 0)
+    for rows.Next() {
+        var label RIVALabel
+        if err := rows.Scan(&label.ID, &label.Name, &label.Color, &label.Deleted, &label.UpdatedAt, &label.Chats, &label.Messages); err != nil {
+            db.Log.Errorf("Failed to scan label: %v", err)
+            return nil, err
+        }
+
+        labels = append(labels, label)
+    }
+
+    return labels, rows.Err()
+}
+
+func (db *RIVAClientDB) ListLabels(includeDeleted bool) ([]RIVALabel, error) {
+    query := fmt.Sprintf(rBotSqlLabelListQuery, rBotSqlLabelTableName, rBotSqlChatLabelTableName, rBotSqlMessageLabelTableName)
+
+    rows, err := db.DB.Query(query, includeDeleted)
+    if err != nil {
+        db.Log.Errorf("Failed to query labels: %v", err)
+        return nil, err
+    }
+
+    return db.scanLabels(rows)
+}
+
+// Returns the labels on a chat. Chat and message counts are not filled in.
+func (db *RIVAClientDB) ListChatLabels(chatJID types.JID) ([]RIVALabel, error) {
+    query := fmt.Sprintf(rBotSqlChatLabelsOfQuery, rBotSqlLabelTableName, rBotSqlChatLabelTableName)
+
+    rows, err := db.DB.Query(query, chatJID.String())
+    if err != nil {
+        db.Log.Errorf("Failed to query labels of %s: %v", chatJID.String(), err)
+        return nil, err
+    }
+
+    return db.scanLabels(rows)
+}
+
+func (db *RIVAClientDB) SetChatLabel(labelID string, chatJID types.JID, labeled bool, at time.Time) error {
+    var err error
+    if labeled {
+        query := fmt.Sprintf(rBotSqlChatLabelInsertQuery, rBotSqlChatLabelTableName)
+        _, err = db.DB.Exec(query, labelID, chatJID.String(), at.UTC())
+    } else {
+        query := fmt.Sprintf(rBotSqlChatLabelDeleteQuery, rBotSqlChatLabelTableName)
+        _, err = db.DB.Exec(query, labelID, chatJID.String())
+    }
+
+    if err != nil {
+        db.Log.Errorf("Failed to set label %s on %s to %t: %v", labelID, chatJID.String(), labeled, err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) SetMessageLabel(labelID string, chatJID types.JID, messageID string, labeled bool, at time.Time) error {
+    var err error
+    if labeled {
+        query := fmt.Sprintf(rBotSqlMessageLabelInsertQuery, rBotSqlMessageLabelTableName)
+        _, err = db.DB.Exec(query, labelID, chatJID.String(), messageID, at.UTC())
+    } else {
+        query := fmt.Sprintf(rBotSqlMessageLabelDeleteQuery, rBotSqlMessageLabelTableName)
+        _, err = db.DB.Exec(query, labelID, chatJID.String(), messageID)
+    }
+
+    if err != nil {
+        db.Log.Errorf("Failed to set label %s on message %s to %t: %v", labelID, messageID, labeled, err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) ListLabeledChats(labelID string) ([]RIVALabeledChat, error) {
+    query := fmt.Sprintf(rBotSqlChatLabelListQuery, rBotSqlChatLabelTableName)
+
+    rows, err := db.DB.Query(query, labelID)
+    if err != nil {
+        db.Log.Errorf("Failed to query chats with label %s: %v", labelID, err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    chats := make([]RIVALabeledChat, 0)
+    for rows.Next() {
+        var chat RIVALabeledChat
+        var chatJID string
+        if err := rows.Scan(&chatJID, &chat.LabeledAt); err != nil {
+            db.Log.Errorf("Failed to scan chat with label %s: %v", labelID, err)
+            return nil, err
+        }
+
+        if chat.ChatJID, err = types.ParseJID(chatJID); err != nil {
+            db.Log.Warnf("Skipping unparseable chat %s with label %s: %v", chatJID, labelID, err)
+            continue
+        }
+
+        chats = append(chats, chat)
+    }
+
+    return chats, rows.Err()
+}
+
+func (db *RIVAClientDB) ListLabeledMessages(labelID string) ([]RIVALabeledMessage, error) {
+    query := fmt.Sprintf(rBotSqlMessageLabelListQuery, rBotSqlMessageLabelTableName)
+
+    rows, err := db.DB.Query(query, labelID)
+    if err != nil {
+        db.Log.Errorf("Failed to query messages with label %s: %v", labelID, err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    messages := make([]RIVALabeledMessage, 0)
+    for rows.Next() {
+        var message RIVALabeledMessage
+        var chatJID string
+        if err := rows.Scan(&chatJID, &message.MessageID, &message.LabeledAt); err != nil {
+            db.Log.Errorf("Failed to scan message with label %s: %v", labelID, err)
+            return nil, err
+        }
+
+        if message.ChatJID, err = types.ParseJID(chatJID); err != nil {
+            db.Log.Warnf("Skipping unparseable chat %s with label %s: %v", chatJID, labelID, err)
+            continue
+        }
+
+        messages = append(messages, message)
+    }
+
+    return messages, rows.Err()
+}
+
+/*
+ * Counts an inbound message towards the chat's current conversation, or
+ * starts a new one if the last was answered and has been idle for longer
+ * than the greeting cooldown. Returns true if a conversation was started.
+ */
+func (db *RIVAClientDB) RecordInboundMessage(chatJID types.JID, at time.Time) (bool, error) {
+    tx, err := db.DB.Begin()
+    if err != nil {
+        db.Log.Errorf("Failed to begin conversation update for %s: %v", chatJID.String(), err)
+        return false, err
+    }
+    defer tx.Rollback()
+
+    var id int64
+    var lastInbound time.Time
+    var firstResponse sql.NullTime
+
+    query := fmt.Sprintf(rBotSqlConversationLatestQuery, rBotSqlConversationTableName)
+    err = tx.QueryRow(query, chatJID.String()).Scan(&id, &lastInbound, &firstResponse)
+    if err != nil && err != sql.ErrNoRows {
+        db.Log.Errorf("Failed to query conversation of %s: %v", chatJID.String(), err)
+        return false, err
+    }
+
+    cooldown := time.Duration(rBotGreetingCooldownHours * float64(time.Hour))
+    started := err == sql.ErrNoRows || (firstResponse.Valid && at.Sub(lastInbound) >= cooldown)
+    if started {
+        query = fmt.Sprintf(rBotSqlConversationInsertQuery, rBotSqlConversationTableName)
+        _, err = tx.Exec(query, chatJID.String(), at.UTC(), at.UTC())
+    } else {
+        query = fmt.Sprintf(rBotSqlConversationInboundQuery, rBotSqlConversationTableName)
+        _, err = tx.Exec(query, at.UTC(), id)
+    }
+
+    if err != nil {
+        db.Log.Errorf("Failed to record inbound message of %s: %v", chatJID.String(), err)
+        return false, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        db.Log.Errorf("Failed to commit conversation update for %s: %v", chatJID.String(), err)
+        return false, err
+    }
+
+    return started, nil
+}
+
+// Marks the chat's current conversation as answered, if it was not yet.
+// Returns true if this was the first reply.
+func (db *RIVAClientDB) RecordHumanReply(chatJID types.JID, at time.Time) (bool, error) {
+    query := fmt.Sprintf(rBotSqlConversationResponseQuery, rBotSqlConversationTableName)
+
+    result, err := db.DB.Exec(query, at.UTC(), chatJID.String(), at.UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to record reply to %s: %v", chatJID.String(), err)
+        return false, err
+    }
+
+    affected, err := result.RowsAffected()
+    return affected > 0, err
+}
+
+func (db *RIVAClientDB) queryConversations(query string, args ...any) ([]RIVAConversation, error) {
+    rows, err := db.DB.Query(query, args...)
+    if err != nil {
+        db.Log.Errorf("Failed to query conversations: %v", err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    conversations := make([]RIVAConversation, 0)
+    for rows.Next() {
+        var c RIVAConversation
+        var chatJID string
+        var firstResponse, reminded sql.NullTime
+        if err := rows.Scan(&c.ID, &chatJID, &c.StartedAt, &c.LastInboundAt, &c.InboundCount, &firstResponse, &reminded); err != nil {
+            db.Log.Errorf("Failed to scan conversation: %v", err)
+            return nil, err
+        }
+
+        if c.ChatJID, err = types.ParseJID(chatJID); err != nil {
+            db.Log.Warnf("Skipping conversation %d with unparseable chat %s: %v", c.ID, chatJID, err)
+            continue
+        }
+
+        c.FirstResponseAt = firstResponse.Time
+        c.RemindedAt = reminded.Time
+        conversations = append(conversations, c)
+    }
+
+    return conversations, rows.Err()
+}
+
+// Returns unanswered conversations started before the given time that staff
+// have not been reminded about yet.
+func (db *RIVAClientDB) ListOverdueConversations(startedBefore time.Time) ([]RIVAConversation, error) {
+    query := fmt.Sprintf(rBotSqlConversationOverdueQuery, rBotSqlConversationTableName)
+    return db.queryConversations(query, startedBefore.UTC())
+}
+
+func (db *RIVAClientDB) ListConversations(from time.Time, to time.Time) ([]RIVAConversation, error) {
+    query := fmt.Sprintf(rBotSqlConversationListQuery, rBotSqlConversationTableName)
+    return db.queryConversations(query, from.UTC(), to.UTC())
+}
+
+func (db *RIVAClientDB) MarkConversationReminded(id int64, at time.Time) error {
+    query := fmt.Sprintf(rBotSqlConversationRemindedQuery, rBotSqlConversationTableName)
+
+    if _, err := db.DB.Exec(query, at.UTC(), id); err != nil {
+        db.Log.Errorf("Failed to mark conversation %d as reminded: %v", id, err)
+        return err
+    }
+
+    return nil
+}
+
+// Remembers which contact a summary posted in the staff group is about.
+func (db *RIVAClientDB) RecordStaffForward(messageID string, chatJID types.JID, forwardedAt time.Time) error {
+    query := fmt.Sprintf(rBotSqlStaffForwardInsertQuery, rBotSqlStaffForwardTableName)
+
+    if _, err := db.DB.Exec(query, messageID, chatJID.String(), forwardedAt.UTC()); err != nil {
+        db.Log.Errorf("Failed to record staff forward %s for %s: %v", messageID, chatJID.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) GetStaffForward(messageID string) (types.JID, bool, error) {
+    var chatJID string
+
+    query := fmt.Sprintf(rBotSqlStaffForwardGetQuery, rBotSqlStaffForwardTableName)
+    err := db.DB.QueryRow(query, messageID).Scan(&chatJID)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return types.EmptyJID, false, nil
+        }
+
+        db.Log.Errorf("Failed to query staff forward %s: %v", messageID, err)
+        return types.EmptyJID, false, err
+    }
+
+    jid, err := types.ParseJID(chatJID)
+    if err != nil {
+        db.Log.Errorf("Staff forward %s has unparseable chat %s: %v", messageID, chatJID, err)
+        return types.EmptyJID, false, err
+    }
+
+    return jid, true, nil
+}
+
+func (db *RIVAClientDB) GetLatestConversation(chatJID types.JID) (RIVAConversation, bool, error) {
+    query := fmt.Sprintf(rBotSqlConversationChatQuery, rBotSqlConversationTableName)
+
+    conversations, err := db.queryConversations(query, chatJID.String())
+    if err != nil || len(conversations) == 0 {
+        return RIVAConversation{}, false, err
+    }
+
+    return conversations[0], true, nil
+}
+
+func (db *RIVAClientDB) GetSetting(key string) (string, bool, error) {
+    var value string
+
+    query := fmt.Sprintf(rBotSqlSettingGetQuery, rBotSqlSettingTableName)
+    err := db.DB.QueryRow(query, key).Scan(&value)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return "", false, nil
+        }
+
+        db.Log.Errorf("Failed to query setting %s: %v", key, err)
+        return "", false, err
+    }
+
+    return value, true, nil
+}
+
+func (db *RIVAClientDB) SetSetting(key string, value string, updatedBy string) error {
+    query := fmt.Sprintf(rBotSqlSettingSetQuery, rBotSqlSettingTableName)
+
+    if _, err := db.DB.Exec(query, key, value, updatedBy, time.Now().UTC()); err != nil {
+        db.Log.Errorf("Failed to set setting %s: %v", key, err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) DeleteSetting(key string) (bool, error) {
+    query := fmt.Sprintf(rBotSqlSettingDeleteQuery, rBotSqlSettingTableName)
+
+    result, err := db.DB.Exec(query, key)
+    if err != nil {
+        db.Log.Errorf("Failed to delete setting %s: %v", key, err)
+        return false, err
+    }
+
+    affected, err := result.RowsAffected()
+    return affected > 0, err
+}
+
+func (db *RIVAClientDB) RecordOperatorCommand(entry RIVAOperatorAuditEntry) error {
+    query := fmt.Sprintf(rBotSqlOperatorAuditInsertQuery, rBotSqlOperatorAuditTableName)
+
+    _, err := db.DB.Exec(query, entry.OperatorJID.String(), entry.Command, entry.Authorised, entry.Result, entry.CreatedAt.UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to audit command %q from %s: %v", entry.Command, entry.OperatorJID.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+// Returns the latest operator commands, newest first.
+func (db *RIVAClientDB) ListOperatorAudit(limit int) ([]RIVAOperatorAuditEntry, error) {
+    query := fmt.Sprintf(rBotSqlOperatorAuditListQuery, rBotSqlOperatorAuditTableName)
+
+    rows, err := db.DB.Query(query, limit)
+    if err != nil {
+        db.Log.Errorf("Failed to query operator audit: %v", err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    entries := make([]RIVAOperatorAuditEntry, 0)
+    for rows.Next() {
+        var entry RIVAOperatorAuditEntry
+        var operatorJID string
+        if err := rows.Scan(&entry.ID, &operatorJID, &entry.Command, &entry.Authorised, &entry.Result, &entry.CreatedAt); err != nil {
+            db.Log.Errorf("Failed to scan operator audit entry: %v", err)
+            return nil, err
+        }
+
+        if entry.OperatorJID, err = types.ParseJID(operatorJID); err != nil {
+            db.Log.Warnf("Operator audit entry %d has unparseable operator %s: %v", entry.ID, operatorJID, err)
+        }
+
+        entries = append(entries, entry)
+    }
+
+    return entries, rows.Err()
+}
+
+// Counts archived messages since the given time by direction.
+func (db *RIVAClientDB) CountArchivedMessages(since time.Time) (map[RIVAClientMessageDirection]int, error) {
+    query := fmt.Sprintf(rBotSqlArchiveCountQuery, rBotSqlArchiveTableName)
+
+    rows, err := db.DB.Query(query, since.UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to count archived messages: %v", err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    counts := make(map[RIVAClientMessageDirection]int)
+    for rows.Next() {
+        var direction RIVAClientMessageDirection
+        var count int
+        if err := rows.Scan(&direction, &count); err != nil {
+            db.Log.Errorf("Failed to scan archived message count: %v", err)
+            return nil, err
+        }
+
+        counts[direction] = count
+    }
+
+    return counts, rows.Err()
+}
+
+// Counts messages sent from our number since the given time by kind.
+func (db *RIVAClientDB) CountSentMessages(since time.Time) (map[RIVASentKind]int, error) {
+    query := fmt.Sprintf(rBotSqlSentMessageKindCountQuery, rBotSqlSentMessageTableName)
+
+    rows, err := db.DB.Query(query, since.UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to count sent messages: %v", err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    counts := make(map[RIVASentKind]int)
+    for rows.Next() {
+        var kind RIVASentKind
+        var count int
+        if err := rows.Scan(&kind, &count); err != nil {
+            db.Log.Errorf("Failed to scan sent message count: %v", err)
+            return nil, err
+        }
+
+        counts[kind] = count
+    }
+
+    return counts, rows.Err()
+}
+
+// Returns the handover of a chat if it is still active at the given time.
+func (db *RIVAClientDB) GetHandover(chatJID types.JID, at time.Time) (RIVAHandover, bool, error) {
+    query := fmt.Sprintf(rBotSqlHandoverGetQuery, rBotSqlHandoverTableName)
+
+    handovers, err := db.queryHandovers(query, chatJID.String(), at.UTC())
+    if err != nil || len(handovers) == 0 {
+        return RIVAHandover{}, false, err
+    }
+
+    return handovers[0], true, nil
+}
+
+func (db *RIVAClientDB) SaveHandover(handover RIVAHandover) error {
+    query := fmt.Sprintf(rBotSqlHandoverSaveQuery, rBotSqlHandoverTableName)
+
+    _, err := db.DB.Exec(query, handover.ChatJID.String(), handover.Reason, handover.StartedAt.UTC(), handover.ExpiresAt.UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to save handover of %s: %v", handover.ChatJID.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+// Returns the handovers active at the given time, oldest first.
+func (db *RIVAClientDB) ListHandovers(at time.Time) ([]RIVAHandover, error) {
+    query := fmt.Sprintf(rBotSqlHandoverListQuery, rBotSqlHandoverTableName)
+    return db.queryHandovers(query, at.UTC())
+}
+
+// Ends the active handover of a chat. Returns false if there was none.
+func (db *RIVAClientDB) ResolveHandover(chatJID types.JID, at time.Time) (bool, error) {
+    query := fmt.Sprintf(rBotSqlHandoverDeleteQuery, rBotSqlHandoverTableName)
+
+    result, err := db.DB.Exec(query, chatJID.String(), at.UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to resolve handover of %s: %v", chatJID.String(), err)
+        return false, err
+    }
+
+    affected, err := result.RowsAffected()
+    return affected > 0, err
+}
+
+func (db *RIVAClientDB) queryHandovers(query string, args ...any) ([]RIVAHandover, error) {
+    rows, err := db.DB.Query(query, args...)
+    if err != nil {
+        db.Log.Errorf("Failed to query handovers: %v", err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    handovers := make([]RIVAHandover, 0)
+    for rows.Next() {
+        var h RIVAHandover
+        var chatJID string
+        if err := rows.Scan(&chatJID, &h.Reason, &h.StartedAt, &h.ExpiresAt); err != nil {
+            db.Log.Errorf("Failed to scan handover: %v", err)
+            return nil, err
+        }
+
+        if h.ChatJID, err = types.ParseJID(chatJID); err != nil {
+            db.Log.Warnf("Skipping handover with unparseable chat %s: %v", chatJID, err)
+            continue
+        }
+
+        handovers = append(handovers, h)
+    }
+
+    return handovers, rows.Err()
+}
+
+// Returns the away mode if it is switched on, even if its end time has passed.
+func (db *RIVAClientDB) GetAwayMode() (RIVAAwayMode, bool, error) {
+    value, found, err := db.GetSetting(rBotSettingAwayMode)
+    if err != nil || !found {
+        return RIVAAwayMode{}, false, err
+    }
+
+    var away RIVAAwayMode
+    if err := json.Unmarshal([]byte(value), &away); err != nil {
+        db.Log.Errorf("Failed to decode away mode: %v", err)
+        return RIVAAwayMode{}, false, err
+    }
+
+    return away, true, nil
+}
+
+func (db *RIVAClientDB) SetAwayMode(away RIVAAwayMode) error {
+    value, err := json.Marshal(away)
+    if err != nil {
+        db.Log.Errorf("Failed to encode away mode: %v", err)
+        return err
+    }
+
+    return db.SetSetting(rBotSettingAwayMode, string(value), away.SetBy)
+}
+
+func (db *RIVAClientDB) ClearAwayMode() (bool, error) {
+    return db.DeleteSetting(rBotSettingAwayMode)
+}
+
+func (db *RIVAClientDB) GetAwayReplyTime(chatJID types.JID) (time.Time, bool, error) {
+    var repliedAt time.Time
+
+    query := fmt.Sprintf(rBotSqlAwayReplyGetQuery, rBotSqlAwayReplyTableName)
+    err := db.DB.QueryRow(query, chatJID.String()).Scan(&repliedAt)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return time.Time{}, false, nil
+        }
+
+        db.Log.Errorf("Failed to query away reply time for %s: %v", chatJID.String(), err)
+        return time.Time{}, false, err
+    }
+
+    return repliedAt, true, nil
+}
+
+func (db *RIVAClientDB) SetAwayReplyTime(chatJID types.JID, repliedAt time.Time) error {
+    query := fmt.Sprintf(rBotSqlAwayReplySetQuery, rBotSqlAwayReplyTableName)
+
+    if _, err := db.DB.Exec(query, chatJID.String(), repliedAt.UTC()); err != nil {
+        db.Log.Errorf("Failed to record away reply to %s: %v", chatJID.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) RecordFloodEvent(evt RIVAFloodEvent) error {
+    query := fmt.Sprintf(rBotSqlFloodEventInsertQuery, rBotSqlFloodEventTableName)
+
+    _, err := db.DB.Exec(query, evt.JID.String(), evt.Reason, evt.Action, evt.Strike, evt.Sample, evt.CreatedAt.UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to record flood event for %s: %v", evt.JID.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+// Returns the latest flood events, newest first.
+func (db *RIVAClientDB) ListFloodEvents(limit int) ([]RIVAFloodEvent, error) {
+    query := fmt.Sprintf(rBotSqlFloodEventListQuery, rBotSqlFloodEventTableName)
+
+    rows, err := db.DB.Query(query, limit)
+    if err != nil {
+        db.Log.Errorf("Failed to query flood events: %v", err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    floodEvents := make([]RIVAFloodEvent, 0)
+    for rows.Next() {
+        var evt RIVAFloodEvent
+        var jid string
+        if err := rows.Scan(&evt.ID, &jid, &evt.Reason, &evt.Action, &evt.Strike, &evt.Sample, &evt.CreatedAt); err != nil {
+            db.Log.Errorf("Failed to scan flood event: %v", err)
+            return nil, err
+        }
+
+        if evt.JID, err = types.ParseJID(jid); err != nil {
+            db.Log.Warnf("Skipping flood event %d with unparseable JID %s: %v", evt.ID, jid, err)
+            continue
+        }
+
+        floodEvents = append(floodEvents, evt)
+    }
+
+    return floodEvents, rows.Err()
+}
+
+func (db *RIVAClientDB) SaveBlockedContact(contact RIVABlockedContact) error {
+    return db.execBlockedContact(rBotSqlBlockedSaveQuery, contact)
+}
+
+// Records a block unless the contact is already recorded, so the reason of
+// a block made by the flood guard is not overwritten by the sync.
+func (db *RIVAClientDB) AddBlockedContact(contact RIVABlockedContact) error {
+    return db.execBlockedContact(rBotSqlBlockedAddQuery, contact)
+}
+
+func (db *RIVAClientDB) execBlockedContact(queryFormat string, contact RIVABlockedContact) error {
+    query := fmt.Sprintf(queryFormat, rBotSqlBlockedTableName)
+
+    _, err := db.DB.Exec(query, contact.JID.String(), contact.Source, contact.Reason, contact.BlockedAt.UTC())
+    if err != nil {
+        db.Log.Errorf("Failed to record block of %s: %v", contact.JID.String(), err)
+        return err
+    }
+
+    return nil
+}
+
+func (db *RIVAClientDB) GetBlockedContact(jid types.JID) (RIVABlockedContact, bool, error) {
+    query := fmt.Sprintf(rBotSqlBlockedGetQuery, rBotSqlBlockedTableName)
+
+    contacts, err := db.queryBlockedContacts(query, jid.String())
+    if err != nil || len(contacts) == 0 {
+        return RIVABlockedContact{}, false, err
+    }
+
+    return contacts[0], true, nil
+}
+
+func (db *RIVAClientDB) ListBlockedContacts() ([]RIVABlockedContact, error) {
+    query := fmt.Sprintf(rBotSqlBlockedListQuery, rBotSqlBlockedTableName)
+    return db.queryBlockedContacts(query)
+}
+
+func (db *RIVAClientDB) DeleteBlockedContact(jid types.JID) (bool, error) {
+    query := fmt.Sprintf(rBotSqlBlockedDeleteQuery, rBotSqlBlockedTableName)
+
+    result, err := db.DB.Exec(query, jid.String())
+    if err != nil {
+        db.Log.Errorf("Failed to delete block of %s: %v", jid.String(), err)
+        return false, err
+    }
+
+    affected, err := result.RowsAffected()
+    return affected > 0, err
+}
+
+func (db *RIVAClientDB) queryBlockedContacts(query string, args ...any) ([]RIVABlockedContact, error) {
+    rows, err := db.DB.Query(query, args...)
+    if err != nil {
+        db.Log.Errorf("Failed to query blocked contacts: %v", err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    contacts := make([]RIVABlockedContact, 0)
+    for rows.Next() {
+        var c RIVABlockedContact
+        var jid string
+        if err := rows.Scan(&jid, &c.Source, &c.Reason, &c.BlockedAt); err != nil {
+            db.Log.Errorf("Failed to scan blocked contact: %v", err)
+            return nil, err
+        }
+
+        if c.JID, err = types.ParseJID(jid); err != nil {
+            db.Log.Warnf("Skipping blocked contact with unparseable JID %s: %v", jid, err)
+            continue
+        }
+
+        contacts = append(contacts, c)
+    }
+
+    return contacts, rows.Err()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRepresentativeRenameSurvivesRestart(t *testing.T) {
+    configured := rBotRepresentatives
+    rBotRepresentatives = map[uint16]string{7: "Alex"}
+    t.Cleanup(func() { rBotRepresentatives = configured })
+
+    rc := newTestClient(t, &fakeDownloader{})
+    if err := rc.DB.SetRepresentative(7, "Alex Tan"); err != nil {
+        t.Fatal(err)
+    }
+
+    restarted := (*RIVAClientDB).New(nil, nil, rc.DB.DB)
+    name, found, err := restarted.GetRepresentative(7)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if !found || name != "Alex Tan" {
+        t.Errorf("representative 7 is %q after a restart, want the name set with /iam", name)
+    }
+}
+
+func TestStoredMediaKeptWithoutRetention(t *testing.T) {
+    configured := rBotMediaRetentionDays
+    rBotMediaRetentionDays = 0
+    t.Cleanup(func() { rBotMediaRetentionDays = configured })
+
+    rc := newTestClient(t, &fakeDownloader{})
+    msg := (*RIVAClientMessage).New(nil, rc, testMessageEvent("3EB0OLDPHOTO", &waE2E.Message{
+        ImageMessage: &waE2E.ImageMessage{Mimetype: proto.String("image/jpeg")},
+    }))
+
+    if err := rc.DB.UpsertStoredMedia(msg.Chat, msg, "deadbeef", "old.jpg", MediaStatusStored); err != nil {
+        t.Fatal(err)
+    }
+
+    paths, err := rc.DB.PurgeExpiredStoredMedia()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if _, found, _ := rc.DB.GetStoredMedia(msg.Chat, msg.ID); len(paths) != 0 || !found {
+        t.Errorf("purged %v without a retention period", paths)
+    }
+}
+
+func TestMigrateCanonicalJIDsMergesRows(t *testing.T) {
+    rc := newTestClient(t, &fakeDownloader{})
+
+    // Only paired devices get the LID map, so borrow the container's.
+    rc.WMClient.Store.LIDs = rc.WMClient.Store.Container.(*sqlstore.Container).LIDMap
+
+    lid := types.NewJID("123456789012345", types.HiddenUserServer)
+    if err := rc.WMClient.Store.LIDs.PutLIDMapping(context.Background(), lid, testSender); err != nil {
+        t.Fatal(err)
+    }
+
+    earlier := testTimestamp
+    later := testTimestamp.Add(time.Hour)
+
+    // The contact wrote first under the phone number, then under the LID.
+    rc.DB.RecordContactMessage(testSender, "Old Name", earlier, true)
+    rc.DB.RecordContactMessage(testSender, "Old Name", earlier, true)
+    rc.DB.RecordContactMessage(lid, "New Name", later, true)
+    rc.DB.AddContactTags(testSender, []string{"volunteer"})
+    rc.DB.AddContactTags(lid, []string{"donor", "volunteer"})
+    rc.DB.SetAwayReplyTime(testSender, earlier)
+    rc.DB.SetAwayReplyTime(lid, later)
+    rc.DB.SetMenuSession(testSender, "events", later)
+    rc.DB.SetMenuSession(lid, "main", earlier)
+
+    if _, err := rc.DB.MigrateCanonicalJIDs(rc.Resolver); err != nil {
+        t.Fatal(err)
+    }
+
+    contact, found, err := rc.DB.GetContact(testSender)
+    if err != nil || !found {
+        t.Fatalf("contact is gone after the migration: %v", err)
+    }
+
+    if contact.PushName != "New Name" || contact.MessagesReceived != 3 || !contact.FirstSeen.Equal(earlier) || !contact.LastSeen.Equal(later) {
+        t.Errorf("contact was not merged: %+v", contact)
+    }
+
+    if !slices.Equal(contact.Tags, []string{"donor", "volunteer"}) {
+        t.Errorf("tags are %v, want both identities' tags", contact.Tags)
+    }
+
+    if repliedAt, _, _ := rc.DB.GetAwayReplyTime(testSender); !repliedAt.Equal(later) {
+        t.Errorf("away reply time is %s, want the newer one", repliedAt)
+    }
+
+    if menu, _, _, _ := rc.DB.GetMenuSession(testSender); menu != "events" {
+        t.Errorf("menu session is %q, want the newer one", menu)
+    }
+
+    if _, found, _ := rc.DB.GetContact(lid); found {
+        t.Errorf("LID contact was left behind")
+    }
+
+    // Rows keyed by a LID after the migration are left to the resolver.
+    rc.DB.SetAwayReplyTime(lid, later)
+    if migrated, err := rc.DB.MigrateCanonicalJIDs(rc.Resolver); err != nil || migrated != 0 {
+        t.Errorf("migration ran again and moved %d rows: %v", migrated, err)
+    }
+}
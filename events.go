@@ -2,7 +2,9 @@ package main
 
 import (
 	"os"
+	"time"
 
+	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 )
 
@@ -32,29 +34,75 @@ func (*RIVAClientEvent) New(rClient *RIVAClient, db *RIVAClientDB) *RIVAClientEv
     }
 
     ce.RegisterSequentialHandler(FilterOldMessagesHandler)
+    ce.RegisterSequentialHandler(FilterProcessedMessagesHandler)
+    ce.RegisterSequentialHandler(FloodGuardHandler)
     ce.RegisterSequentialHandler(FilterUnsupportedMessagesHandler)
     ce.RegisterSequentialHandler(LogNewMessageHandler)
+    ce.RegisterSequentialHandler(ArchiveMessageHandler)
+    ce.RegisterSequentialHandler(DownloadMediaHandler)
+    ce.RegisterSequentialHandler(TrackSentMessageHandler)
+    ce.RegisterSequentialHandler(TrackContactHandler)
+    ce.RegisterSequentialHandler(TrackEditsHandler)
+    ce.RegisterSequentialHandler(ControlCommandHandler)
+    ce.RegisterSequentialHandler(RepresentativeCommandHandler)
+    ce.RegisterSequentialHandler(LaterCommandHandler)
+    ce.RegisterSequentialHandler(StaffReplyHandler)
+    ce.RegisterSequentialHandler(OptOutHandler)
+    ce.RegisterSequentialHandler(TrackResponseTimeHandler)
+    ce.RegisterSequentialHandler(HandoverHandler)
     ce.RegisterSequentialHandler(SendGreetingMessageHandler)
+    ce.RegisterSequentialHandler(FormHandler)
+    ce.RegisterSequentialHandler(MenuReplyHandler)
     ce.RegisterSequentialHandler(AutoEditOutgoingMessageHandler)
 
     return ce
 }
 
+func (ce *RIVAClientEvent) emitLifecycle(kind RIVALifecycleKind, jid types.JID, reason string) {
+    evt := RIVALifecycleEvent{
+        Kind:      kind,
+        Timestamp: time.Now(),
+        JID:       jid,
+        Reason:    reason,
+    }
+
+    ce.Log.Infof("Lifecycle event: %v", evt)
+}
+
 func (ce *RIVAClientEvent) EventAppState(evt *events.AppState) {}
 
 func (ce *RIVAClientEvent) EventAppStateSyncComplete(evt *events.AppStateSyncComplete) {}
 
 func (ce *RIVAClientEvent) EventArchive(evt *events.Archive) {}
 
-func (ce *RIVAClientEvent) EventBlocklist(evt *events.Blocklist) {}
+func (ce *RIVAClientEvent) EventBlocklist(evt *events.Blocklist) {
+    if evt.Action == events.BlocklistActionModify {
+        go ce.RClient.SyncBlocklist()
+        return
+    }
+
+    for _, change := range evt.Changes {
+        ce.RClient.ApplyBlocklistChange(change)
+    }
+}
 
 func (ce *RIVAClientEvent) EventBlocklistAction(evt *events.BlocklistAction) {}
 
-func (ce *RIVAClientEvent) EventBlocklistChange(evt *events.BlocklistChange) {}
+func (ce *RIVAClientEvent) EventBlocklistChange(evt *events.BlocklistChange) {
+    ce.RClient.ApplyBlocklistChange(*evt)
+}
 
 func (ce *RIVAClientEvent) EventBlocklistChangeAction(evt *events.BlocklistChangeAction) {}
 
-func (ce *RIVAClientEvent) EventBusinessName(evt *events.BusinessName) {}
+func (ce *RIVAClientEvent) EventBusinessName(evt *events.BusinessName) {
+    jid := ce.RClient.Resolver.Canonical(evt.JID)
+    if evt.Message != nil {
+        jid = ce.RClient.Resolver.CanonicalWithAlt(evt.JID, evt.Message.SenderAlt)
+    }
+
+    ce.Log.Infof("Business name of %s changed from %q to %q", jid, evt.OldBusinessName, evt.NewBusinessName)
+    ce.DB.SetContactBusinessName(jid, evt.NewBusinessName)
+}
 
 func (ce *RIVAClientEvent) EventCallAccept(evt *events.CallAccept) {}
 
@@ -63,7 +111,10 @@ func (ce *RIVAClientEvent) EventCallOffer (evt *events.CallOffer) {
 
     if err := ce.RClient.WMClient.RejectCall(evt.From, evt.CallID); err != nil {
         ce.Log.Errorf("Failed to reject call from %s: %v", evt.From, err)
+        return
     }
+
+    ce.emitLifecycle(LifecycleCallRejected, evt.From.ToNonAD(), "")
 }
 
 func (ce *RIVAClientEvent) EventCallOfferNotice (evt *events.CallOfferNotice) {
@@ -71,7 +122,10 @@ func (ce *RIVAClientEvent) EventCallOfferNotice (evt *events.CallOfferNotice) {
 
     if err := ce.RClient.WMClient.RejectCall(evt.From, evt.CallID); err != nil {
         ce.Log.Errorf("Failed to reject call from %s: %v", evt.From, err)
+        return
     }
+
+    ce.emitLifecycle(LifecycleCallRejected, evt.From.ToNonAD(), "group call")
 }
 
 func (ce *RIVAClientEvent) EventCallPreAccept (evt *events.CallPreAccept) {}
@@ -96,9 +150,43 @@ func (ce *RIVAClientEvent) EventConnectFailureReason (evt *events.ConnectFailure
 
 func (ce *RIVAClientEvent) EventConnected (evt *events.Connected) {
     ce.Log.Infof("Successfully connected and authenticated to WhatsApp.")
+    ce.emitLifecycle(LifecycleConnected, ce.RClient.WMClient.Store.GetJID(), "")
+
+    if migrated, err := ce.DB.MigrateCanonicalJIDs(ce.RClient.Resolver); err == nil && migrated > 0 {
+        ce.Log.Infof("Migrated %d LID keyed records to phone number JIDs.", migrated)
+    }
+
+    go ce.RClient.SyncBlocklist()
+    go ce.RClient.SyncLabels()
+
+    purged, err := ce.DB.PurgeExpiredProcessedMessages()
+    if err != nil {
+        return
+    }
+
+    counts, err := ce.DB.CountProcessedMessages()
+    if err != nil {
+        return
+    }
+
+    ce.Log.Infof("Purged %d expired processed message records. Retained: %+v", purged, counts)
+
+    removed, err := ce.RClient.Media.PurgeExpired()
+    if err != nil {
+        return
+    }
+
+    ce.Log.Infof("Removed %d expired media files.", removed)
 }
 
-func (ce *RIVAClientEvent) EventContact (evt *events.Contact) {}
+func (ce *RIVAClientEvent) EventContact (evt *events.Contact) {
+    if evt.Action == nil {
+        return
+    }
+
+    jid := ce.RClient.Resolver.Canonical(evt.JID)
+    ce.DB.SetContactSavedName(jid, evt.Action.GetFullName(), evt.Action.GetFirstName())
+}
 
 func (ce *RIVAClientEvent) EventDecryptFailMode (evt *events.DecryptFailMode) {}
 
@@ -108,6 +196,7 @@ func (ce *RIVAClientEvent) EventDeleteForMe (evt *events.DeleteForMe) {}
 
 func (ce *RIVAClientEvent) EventDisconnected (evt *events.Disconnected) {
     ce.Log.Infof("Disconnected from WhatsApp. Connection closed by WhatsApp.")
+    ce.emitLifecycle(LifecycleDisconnected, types.EmptyJID, "")
 }
 
 func (ce *RIVAClientEvent) EventFBMessage (evt *events.FBMessage) {}
@@ -124,20 +213,31 @@ func (ce *RIVAClientEvent) EventKeepAliveRestored (evt *events.KeepAliveRestored
 
 func (ce *RIVAClientEvent) EventKeepAliveTimeout (evt *events.KeepAliveTimeout) {}
 
-func (ce *RIVAClientEvent) EventLabelAssociationChat (evt *events.LabelAssociationChat) {}
+func (ce *RIVAClientEvent) EventLabelAssociationChat (evt *events.LabelAssociationChat) {
+    ce.RClient.ApplyLabelAssociationChat(evt)
+}
 
-func (ce *RIVAClientEvent) EventLabelAssociationMessage (evt *events.LabelAssociationMessage) {}
+func (ce *RIVAClientEvent) EventLabelAssociationMessage (evt *events.LabelAssociationMessage) {
+    ce.RClient.ApplyLabelAssociationMessage(evt)
+}
 
-func (ce *RIVAClientEvent) EventLabelEdit (evt *events.LabelEdit) {}
+func (ce *RIVAClientEvent) EventLabelEdit (evt *events.LabelEdit) {
+    ce.RClient.ApplyLabelEdit(evt)
+}
 
 func (ce *RIVAClientEvent) EventLoggedOut (evt *events.LoggedOut) {
     ce.Log.Infof("Logged out. Reason: %s", evt.Reason.String())
+    ce.emitLifecycle(LifecycleLoggedOut, types.EmptyJID, evt.Reason.String())
     os.Exit(0)
 }
 
 func (ce *RIVAClientEvent) EventMarkChatAsRead (evt *events.MarkChatAsRead) {}
 
-func (ce *RIVAClientEvent) EventMediaRetry (evt *events.MediaRetry) {}
+func (ce *RIVAClientEvent) EventMediaRetry (evt *events.MediaRetry) {
+    if err := ce.RClient.Media.HandleMediaRetry(evt); err != nil {
+        ce.Log.Errorf("Failed to handle media retry for message id %s: %v", evt.MessageID, err)
+    }
+}
 
 func (ce *RIVAClientEvent) EventMediaRetryError (evt *events.MediaRetryError) {}
 
@@ -199,6 +299,7 @@ func (ce *RIVAClientEvent) EventPairError (evt *events.PairError) {}
 
 func (ce *RIVAClientEvent) EventPairSuccess (evt *events.PairSuccess) {
     ce.Log.Infof("Pairing successful: %+v", evt)
+    ce.emitLifecycle(LifecyclePaired, evt.ID, evt.Platform)
 }
 
 func (ce *RIVAClientEvent) EventPermanentDisconnect (evt *events.PermanentDisconnect) {}
@@ -211,7 +312,17 @@ func (ce *RIVAClientEvent) EventPresence (evt *events.Presence) {}
 
 func (ce *RIVAClientEvent) EventPrivacySettings (evt *events.PrivacySettings) {}
 
-func (ce *RIVAClientEvent) EventPushName (evt *events.PushName) {}
+func (ce *RIVAClientEvent) EventPushName (evt *events.PushName) {
+    jid := ce.RClient.Resolver.Canonical(evt.JID)
+    seenAt := time.Now()
+    if evt.Message != nil {
+        jid = ce.RClient.Resolver.CanonicalWithAlt(evt.JID, evt.Message.SenderAlt)
+        seenAt = evt.Message.Timestamp
+    }
+
+    ce.Log.Infof("Push name of %s changed from %q to %q", jid, evt.OldPushName, evt.NewPushName)
+    ce.DB.RecordContactPushName(jid, evt.NewPushName, seenAt)
+}
 
 func (ce *RIVAClientEvent) EventPushNameSetting (evt *events.PushNameSetting) {}
 
@@ -219,7 +330,9 @@ func (ce *RIVAClientEvent) EventQR (evt *events.QR) {}
 
 func (ce *RIVAClientEvent) EventQRScannedWithoutMultidevice (evt *events.QRScannedWithoutMultidevice) {}
 
-func (ce *RIVAClientEvent) EventReceipt (evt *events.Receipt) {}
+func (ce *RIVAClientEvent) EventReceipt (evt *events.Receipt) {
+    ce.RClient.ApplyReceipt(evt)
+}
 
 func (ce *RIVAClientEvent) EventStar (evt *events.Star) {}
 
@@ -229,7 +342,10 @@ func (ce *RIVAClientEvent) EventStreamReplaced (evt *events.StreamReplaced) {}
 
 func (ce *RIVAClientEvent) EventTempBanReason (evt *events.TempBanReason) {}
 
-func (ce *RIVAClientEvent) EventTemporaryBan (evt *events.TemporaryBan) {}
+func (ce *RIVAClientEvent) EventTemporaryBan (evt *events.TemporaryBan) {
+    ce.Log.Errorf("Temporarily banned from WhatsApp: %s", evt.String())
+    ce.emitLifecycle(LifecycleTemporaryBan, types.EmptyJID, evt.String())
+}
 
 func (ce *RIVAClientEvent) EventUnarchiveChatsSetting (evt *events.UnarchiveChatsSetting) {}
 
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEventMessageDownloadsIncomingImage(t *testing.T) {
+    downloader := &fakeDownloader{data: []byte("not really a jpeg")}
+    rc := newTestClient(t, downloader)
+
+    evt := testMessageEvent("3EB0INCOMINGIMAGE", &waE2E.Message{
+        ImageMessage: &waE2E.ImageMessage{
+            Mimetype:   proto.String("image/jpeg"),
+            FileLength: proto.Uint64(17),
+            FileSHA256: testSHA256,
+        },
+    })
+    evt.Info.Timestamp = time.Now()
+
+    rc.Handlers.EventMessage(evt)
+
+    sm := waitForStoredMedia(t, rc, testSender, evt.Info.ID, MediaStatusStored)
+    data, err := os.ReadFile(sm.Path)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if string(data) != "not really a jpeg" {
+        t.Errorf("stored %q, want the downloaded bytes", data)
+    }
+
+    if calls := downloader.Calls(); calls != 1 {
+        t.Errorf("downloaded %d times, want 1", calls)
+    }
+}
+
+func TestEventMessageStoresAnySizeWithoutLimit(t *testing.T) {
+    configured := rBotMediaMaxSizeMB
+    rBotMediaMaxSizeMB = 0
+    t.Cleanup(func() { rBotMediaMaxSizeMB = configured })
+
+    rc := newTestClient(t, &fakeDownloader{data: []byte("a very long video")})
+
+    evt := testMessageEvent("3EB0HUGEVIDEO", &waE2E.Message{
+        VideoMessage: &waE2E.VideoMessage{
+            Mimetype:   proto.String("video/mp4"),
+            FileLength: proto.Uint64(1 << 40),
+            FileSHA256: testSHA256,
+        },
+    })
+    evt.Info.Timestamp = time.Now()
+
+    rc.Handlers.EventMessage(evt)
+    waitForStoredMedia(t, rc, testSender, evt.Info.ID, MediaStatusStored)
+}
+
+func TestEventMessageMarksOnlyFilteredMessagesProcessed(t *testing.T) {
+    rc := newTestClient(t, &fakeDownloader{})
+    rc.LastSuccessfulConnectionTime = time.Now()
+
+    old := testMessageEvent("3EB0BACKLOG", &waE2E.Message{Conversation: proto.String("Sent while we were away")})
+    rc.Handlers.EventMessage(old)
+
+    if _, found, err := rc.DB.GetProcessedMessage(testSender, old.Info.ID); err != nil || found {
+        t.Errorf("old message dropped before the processed filter was recorded: %v", err)
+    }
+
+    current := testMessageEvent("3EB0CURRENT", &waE2E.Message{Conversation: proto.String("Hello again")})
+    current.Info.Timestamp = time.Now().Add(time.Second)
+    rc.Handlers.EventMessage(current)
+
+    processed, found, err := rc.DB.GetProcessedMessage(testSender, current.Info.ID)
+    if err != nil || !found || processed.Status != ProcessedStatusCompleted {
+        t.Errorf("current message is %+v, want it completed: %v", processed, err)
+    }
+}
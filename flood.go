@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+type RIVAFloodReason string
+const (
+    FloodRate   RIVAFloodReason = "RATE"
+    FloodRepeat RIVAFloodReason = "REPEAT"
+    FloodLinks  RIVAFloodReason = "LINKS"
+)
+
+type RIVAFloodAction string
+const (
+    FloodIgnore RIVAFloodAction = "IGNORE"
+    FloodWarn   RIVAFloodAction = "WARN"
+    FloodBlock  RIVAFloodAction = "BLOCK"
+)
+
+type RIVABlockSource string
+const (
+    BlockedByFloodGuard RIVABlockSource = "FLOOD"
+    BlockedBySync       RIVABlockSource = "SYNC"
+)
+
+type RIVAFloodEvent struct {
+    ID        int64           `json:"id"`         // Unique ID of the event
+    JID       types.JID       `json:"jid"`        // Sender who went over a limit
+    Reason    RIVAFloodReason `json:"reason"`     // Which limit was exceeded
+    Action    RIVAFloodAction `json:"action"`     // What was done about it
+    Strike    int             `json:"strike"`     // How many times the sender went over a limit recently
+    Sample    string          `json:"sample"`     // Start of the message that crossed the limit
+    CreatedAt time.Time       `json:"created_at"` // When it happened
+}
+
+/*
+ * Contacts blocked on our number. Blocks made by the flood guard carry its
+ * reason; blocks made on the phone or another device reach us through
+ * blocklist events and are recorded as SYNC. WhatsApp's blocklist stays the
+ * source of truth.
+ */
+type RIVABlockedContact struct {
+    JID       types.JID       `json:"jid"`        // Blocked contact
+    Source    RIVABlockSource `json:"source"`     // Who blocked the contact
+    Reason    string          `json:"reason"`     // Why, if blocked by the flood guard
+    BlockedAt time.Time       `json:"blocked_at"` // When the block was recorded
+}
+
+// Longest message sample kept with a flood event, in characters.
+const rBotFloodSampleMaxLength = 200
+
+type rivaFloodSender struct {
+    messages    []time.Time // Inbound messages within the window
+    links       []time.Time // Inbound messages with links within the window
+    lastContent string      // Normalised text of the previous message
+    repeats     int         // Consecutive messages with the same text
+    strikes     int         // Times the sender went over a limit
+    lastStrike  time.Time   // When the last strike was given
+}
+
+/*
+ * Tracks inbound private messages per sender in memory and tells when one
+ * goes over flood_max_messages, flood_max_repeats identical messages in a row
+ * or flood_max_links messages with links within flood_window_seconds. A
+ * sender gets at most one strike per window, and strikes are forgotten after
+ * flood_strike_reset_hours without one. Each strike picks the next action in
+ * flood_actions, the last one repeating.
+ */
+type RIVAClientFlood struct {
+    RClient   *RIVAClient
+    DB        *RIVAClientDB
+    Log       *RIVAClientLog
+    mu        sync.Mutex
+    senders   map[types.JID]*rivaFloodSender
+    lastSweep time.Time
+}
+
+func (*RIVAClientFlood) New(rClient *RIVAClient, db *RIVAClientDB) *RIVAClientFlood {
+    return &RIVAClientFlood{
+        RClient: rClient,
+        DB:      db,
+        Log:     NewRIVAClientLog("RIVABotFlood", "INFO"),
+        senders: make(map[types.JID]*rivaFloodSender),
+    }
+}
+
+func FloodWindow() time.Duration {
+    return time.Duration(rBotFloodWindowSecs * float64(time.Second))
+}
+
+func (f *RIVAClientFlood) IsEnabled() bool {
+    return FloodWindow() > 0 && (rBotFloodMaxMessages > 0 || rBotFloodMaxRepeats > 0 || rBotFloodMaxLinks > 0)
+}
+
+func FloodActionFor(strike int) RIVAFloodAction {
+    if len(rBotFloodActions) == 0 || strike < 1 {
+        return FloodIgnore
+    }
+
+    action := RIVAFloodAction(strings.ToUpper(rBotFloodActions[min(strike, len(rBotFloodActions)) - 1]))
+    switch action {
+    case FloodIgnore, FloodWarn, FloodBlock:
+        return action
+    }
+
+    return FloodIgnore
+}
+
+func containsLink(text string) bool {
+    text = strings.ToLower(text)
+    return strings.Contains(text, "http://") || strings.Contains(text, "https://") || strings.Contains(text, "www.")
+}
+
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+    i := 0
+    for i < len(times) && times[i].Before(cutoff) {
+        i++
+    }
+
+    return times[i:]
+}
+
+/*
+ * Records a message from a sender. Returns the limit it went over, if any,
+ * the sender's strike count, and whether this message earned a new strike.
+ * Messages over a limit are meant to be dropped either way. Media counts
+ * towards the rate and, by its caption, the link limit, but an album of
+ * photos is not a run of repeated messages, so it leaves the repeat count
+ * alone.
+ */
+func (f *RIVAClientFlood) Check(sender types.JID, text string, isMedia bool, at time.Time) (RIVAFloodReason, int, bool) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    window := FloodWindow()
+    strikeReset := time.Duration(rBotFloodStrikeResetHours * float64(time.Hour))
+    f.sweep(at, window, strikeReset)
+
+    s, found := f.senders[sender]
+    if !found {
+        s = &rivaFloodSender{}
+        f.senders[sender] = s
+    }
+
+    cutoff := at.Add(-window)
+    s.messages = append(pruneBefore(s.messages, cutoff), at)
+    s.links = pruneBefore(s.links, cutoff)
+    if containsLink(text) {
+        s.links = append(s.links, at)
+    }
+
+    normalised := strings.ToLower(strings.Join(strings.Fields(text), " "))
+    if !isMedia {
+        if normalised != "" && normalised == s.lastContent && len(s.messages) > 1 {
+            s.repeats++
+        } else {
+            s.repeats = 1
+        }
+        s.lastContent = normalised
+    }
+
+    var reason RIVAFloodReason
+    switch {
+    case rBotFloodMaxMessages > 0 && len(s.messages) > rBotFloodMaxMessages:
+        reason = FloodRate
+    case rBotFloodMaxRepeats > 0 && !isMedia && normalised != "" && s.repeats > rBotFloodMaxRepeats:
+        reason = FloodRepeat
+    case rBotFloodMaxLinks > 0 && len(s.links) > rBotFloodMaxLinks:
+        reason = FloodLinks
+    default:
+        return "", s.strikes, false
+    }
+
+    if !s.lastStrike.IsZero() && at.Sub(s.lastStrike) < window {
+        return reason, s.strikes, false
+    }
+
+    if strikeReset > 0 && at.Sub(s.lastStrike) > strikeReset {
+        s.strikes = 0
+    }
+
+    s.strikes++
+    s.lastStrike = at
+    return reason, s.strikes, true
+}
+
+// Forgets a sender's history, e.g. after an operator unblocks them.
+func (f *RIVAClientFlood) Reset(sender types.JID) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    delete(f.senders, sender)
+}
+
+// Drops senders with nothing left to remember, at most once per window.
+func (f *RIVAClientFlood) sweep(now time.Time, window time.Duration, strikeReset time.Duration) {
+    if now.Sub(f.lastSweep) < window {
+        return
+    }
+
+    f.lastSweep = now
+    for jid, s := range f.senders {
+        quiet := len(s.messages) == 0 || now.Sub(s.messages[len(s.messages) - 1]) > window
+        forgiven := s.strikes == 0 || now.Sub(s.lastStrike) > strikeReset
+        if quiet && forgiven {
+            delete(f.senders, jid)
+        }
+    }
+}
+
+func (f *RIVAClientFlood) Escalate(msg RIVAClientMessage, text string, reason RIVAFloodReason, strike int) {
+    action := FloodActionFor(strike)
+    f.Log.Warnf("%s went over the %s limit (strike %d), action: %s", msg.FromNonAD, reason, strike, action)
+
+    sample := []rune(text)
+    if len(sample) > rBotFloodSampleMaxLength {
+        sample = append(sample[:rBotFloodSampleMaxLength], '…')
+    }
+
+    f.DB.RecordFloodEvent(RIVAFloodEvent{
+        JID:       msg.FromNonAD,
+        Reason:    reason,
+        Action:    action,
+        Strike:    strike,
+        Sample:    string(sample),
+        CreatedAt: msg.Timestamp,
+    })
+
+    switch action {
+    case FloodWarn:
+        if rBotFloodWarning == "" {
+            return
+        }
+
+        payload := &waE2E.Message{Conversation: proto.String(rBotFloodWarning)}
+        if _, err := f.RClient.SendAutomatedMessage(msg.FromNonAD, payload, SentFlood); err != nil {
+            f.Log.Errorf("Failed to warn %s: %v", msg.FromNonAD, err)
+        }
+    case FloodBlock:
+        if err := f.RClient.BlockContact(msg.FromNonAD, string(reason)); err != nil {
+            return
+        }
+
+        name := msg.PushName
+        if name == "" {
+            name = "Unknown"
+        }
+
+        notice := fmt.Sprintf("*Blocked* %s (%s) after %d flood strikes, last for %s. Send /unblock %s here to undo.",
+                              name, FormatNumber(msg.FromNonAD), strike, strings.ToLower(string(reason)), msg.FromNonAD.User)
+        if _, found := ControlGroupJID(); found {
+            f.RClient.SendControlMessage(notice)
+        }
+    }
+}
+
+func (rc *RIVAClient) BlockContact(jid types.JID, reason string) error {
+    if _, err := rc.WMClient.UpdateBlocklist(jid, events.BlocklistChangeActionBlock); err != nil {
+        rc.Log.Errorf("Failed to block %s: %v", jid, err)
+        return err
+    }
+
+    rc.Log.Infof("Blocked %s: %s", jid, reason)
+    return rc.DB.SaveBlockedContact(RIVABlockedContact{JID: jid, Source: BlockedByFloodGuard, Reason: reason, BlockedAt: time.Now()})
+}
+
+func (rc *RIVAClient) UnblockContact(jid types.JID) error {
+    if _, err := rc.WMClient.UpdateBlocklist(jid, events.BlocklistChangeActionUnblock); err != nil {
+        rc.Log.Errorf("Failed to unblock %s: %v", jid, err)
+        return err
+    }
+
+    rc.Log.Infof("Unblocked %s", jid)
+    rc.Flood.Reset(jid)
+    _, err := rc.DB.DeleteBlockedContact(jid)
+    return err
+}
+
+func (rc *RIVAClient) ApplyBlocklistChange(change events.BlocklistChange) {
+    jid := rc.Resolver.Canonical(change.JID)
+    switch change.Action {
+    case events.BlocklistChangeActionBlock:
+        rc.Log.Infof("%s was blocked", jid)
+        rc.DB.AddBlockedContact(RIVABlockedContact{JID: jid, Source: BlockedBySync, BlockedAt: time.Now()})
+    case events.BlocklistChangeActionUnblock:
+        rc.Log.Infof("%s was unblocked", jid)
+        rc.Flood.Reset(jid)
+        rc.DB.DeleteBlockedContact(jid)
+    }
+}
+
+// Replaces the blocked contacts with WhatsApp's blocklist, keeping the
+// reasons of contacts that are still blocked.
+func (rc *RIVAClient) SyncBlocklist() error {
+    blocklist, err := rc.WMClient.GetBlocklist()
+    if err != nil {
+        rc.Log.Errorf("Failed to fetch blocklist: %v", err)
+        return err
+    }
+
+    blocked := make(map[types.JID]bool, len(blocklist.JIDs))
+    for _, jid := range blocklist.JIDs {
+        jid = rc.Resolver.Canonical(jid)
+        blocked[jid] = true
+        rc.DB.AddBlockedContact(RIVABlockedContact{JID: jid, Source: BlockedBySync, BlockedAt: time.Now()})
+    }
+
+    recorded, err := rc.DB.ListBlockedContacts()
+    if err != nil {
+        return err
+    }
+
+    for _, contact := range recorded {
+        if !blocked[contact.JID] {
+            rc.DB.DeleteBlockedContact(contact.JID)
+        }
+    }
+
+    rc.Log.Infof("Synced blocklist, %d contacts blocked.", len(blocked))
+    return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+func isArchived(t *testing.T, rc *RIVAClient, id string) bool {
+    t.Helper()
+
+    var content string
+    query := fmt.Sprintf(rBotSqlArchiveGetContentQuery, rBotSqlArchiveTableName)
+    err := rc.DB.DB.QueryRow(query, testSender.String(), id).Scan(&content)
+    if err != nil && err != sql.ErrNoRows {
+        t.Fatal(err)
+    }
+
+    return err == nil
+}
+
+func TestFloodGuardSkipsRedeliveriesAndCountsMedia(t *testing.T) {
+    if rBotFloodMaxMessages <= rBotFloodMaxRepeats + 1 || FloodWindow() <= 0 {
+        t.Skip("flood_max_messages is not set above flood_max_repeats in config.yaml")
+    }
+
+    rc := newTestClient(t, &fakeDownloader{data: []byte("photo")})
+
+    // An album longer than the repeat limit, so identical photos are not
+    // mistaken for repeated text.
+    album := rBotFloodMaxRepeats + 1
+
+    // Each message is delivered twice, as after a reconnect.
+    for i := 0; i < rBotFloodMaxMessages - album; i++ {
+        evt := testMessageEvent(fmt.Sprintf("3EB0TEXT%d", i), &waE2E.Message{Conversation: proto.String(fmt.Sprintf("Question %d", i))})
+        rc.Handlers.EventMessage(evt)
+        rc.Handlers.EventMessage(evt)
+    }
+
+    for i := 0; i < album; i++ {
+        id := fmt.Sprintf("3EB0ALBUM%d", i)
+        rc.Handlers.EventMessage(testMessageEvent(id, &waE2E.Message{
+            ImageMessage: &waE2E.ImageMessage{Mimetype: proto.String("image/jpeg")},
+        }))
+
+        if !isArchived(t, rc, id) {
+            t.Errorf("album photo %s was not archived", id)
+        }
+    }
+
+    if events, _ := rc.DB.ListFloodEvents(10); len(events) != 0 {
+        t.Fatalf("flood guard tripped on redeliveries or an album: %+v", events)
+    }
+
+    rc.Handlers.EventMessage(testMessageEvent("3EB0STICKEROVER", &waE2E.Message{
+        StickerMessage: &waE2E.StickerMessage{Mimetype: proto.String("image/webp")},
+    }))
+    if isArchived(t, rc, "3EB0STICKEROVER") {
+        t.Errorf("sticker over the limit was archived")
+    }
+
+    if events, _ := rc.DB.ListFloodEvents(10); len(events) != 1 || events[0].Reason != FloodRate {
+        t.Errorf("flood events are %+v, want one rate strike", events)
+    }
+}
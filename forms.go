@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+type RIVAFormFieldType string
+const (
+    FieldText   RIVAFormFieldType = "text"
+    FieldEmail  RIVAFormFieldType = "email"
+    FieldNumber RIVAFormFieldType = "number"
+    FieldChoice RIVAFormFieldType = "choice"
+)
+
+type RIVAFormField struct {
+    ID      string            `yaml:"id"`      // Column name in submissions and exports
+    Type    RIVAFormFieldType `yaml:"type"`    // text, email, number or choice
+    Prompt  string            `yaml:"prompt"`  // Question sent to the contact
+    Error   string            `yaml:"error"`   // Sent before the prompt again when the answer is invalid
+    Choices []string          `yaml:"choices"` // Options for choice fields
+    Min     int               `yaml:"min"`     // Lowest accepted value for number fields
+    Max     int               `yaml:"max"`     // Highest accepted value for number fields, 0 for no limit
+}
+
+type RIVAForm struct {
+    ID        string          `yaml:"id"`        // Unique ID, used by menu items and exports
+    Title     string          `yaml:"title"`     // Name shown to operators
+    Triggers  []string        `yaml:"triggers"`  // Keywords that start the form
+    Intro     string          `yaml:"intro"`     // Sent before the first question
+    Completed string          `yaml:"completed"` // Sent after the last answer
+    Cancelled string          `yaml:"cancelled"` // Sent when the contact cancels
+    Fields    []RIVAFormField `yaml:"fields"`    // Questions, asked in order
+}
+
+type RIVAFormSession struct {
+    ChatJID   types.JID         // Chat filling in the form
+    FormID    string            // Form being filled in
+    Step      int               // Index of the field being asked
+    Answers   map[string]string // Valid answers so far, by field ID
+    StartedAt time.Time         // When the form was started
+    UpdatedAt time.Time         // When the last answer was given
+}
+
+type RIVAFormSubmission struct {
+    ID          int64             // Unique ID of the submission
+    FormID      string            // Form that was filled in
+    ChatJID     types.JID         // Chat that filled it in
+    Answers     map[string]string // Answers by field ID
+    SubmittedAt time.Time         // When the last answer was given
+}
+
+const rBotFormTextMaxLength = 200
+
+func FindForm(id string) (RIVAForm, bool) {
+    for _, form := range rBotForms {
+        if form.ID == id {
+            return form, true
+        }
+    }
+
+    return RIVAForm{}, false
+}
+
+func (f RIVAFormField) PromptText() string {
+    if f.Type != FieldChoice {
+        return f.Prompt
+    }
+
+    var sb strings.Builder
+    sb.WriteString(f.Prompt)
+    sb.WriteString("\n")
+    for i, choice := range f.Choices {
+        fmt.Fprintf(&sb, "\n%d. %s", i + 1, choice)
+    }
+
+    return sb.String()
+}
+
+// Returns the normalised answer, or false if it is not valid for the field.
+func (f RIVAFormField) Validate(answer string) (string, bool) {
+    answer = strings.TrimSpace(answer)
+    if answer == "" {
+        return "", false
+    }
+
+    switch f.Type {
+    case FieldEmail:
+        addr, err := mail.ParseAddress(answer)
+        if err != nil || addr.Address != answer || !strings.Contains(answer[strings.LastIndex(answer, "@"):], ".") {
+            return "", false
+        }
+
+        return strings.ToLower(answer), true
+    case FieldNumber:
+        value, err := strconv.Atoi(answer)
+        if err != nil || value < f.Min || (f.Max != 0 && value > f.Max) {
+            return "", false
+        }
+
+        return strconv.Itoa(value), true
+    case FieldChoice:
+        if index, err := strconv.Atoi(strings.TrimRight(answer, ".")); err == nil {
+            if index >= 1 && index <= len(f.Choices) {
+                return f.Choices[index - 1], true
+            }
+
+            return "", false
+        }
+
+        for _, choice := range f.Choices {
+            if strings.EqualFold(answer, choice) {
+                return choice, true
+            }
+        }
+
+        return "", false
+    }
+
+    if len([]rune(answer)) > rBotFormTextMaxLength {
+        return "", false
+    }
+
+    return answer, true
+}
+
+func (rc *RIVAClient) sendFormText(recipientJID types.JID, text string) error {
+    if text == "" {
+        return nil
+    }
+
+    _, err := rc.SendAutomatedMessage(recipientJID, &waE2E.Message{Conversation: proto.String(text)}, SentForm)
+    if err != nil {
+        rc.Log.Errorf("Failed to send form message to %s: %v", recipientJID, err)
+    }
+
+    return err
+}
+
+// Starts the form from the first question, discarding any unfinished answers.
+func (rc *RIVAClient) StartForm(recipientJID types.JID, formID string) error {
+    form, found := FindForm(formID)
+    if !found || len(form.Fields) == 0 {
+        return fmt.Errorf("unknown or empty form %q", formID)
+    }
+
+    now := time.Now()
+    session := RIVAFormSession{
+        ChatJID:   recipientJID,
+        FormID:    form.ID,
+        Answers:   make(map[string]string),
+        StartedAt: now,
+        UpdatedAt: now,
+    }
+
+    if err := rc.DB.SaveFormSession(session); err != nil {
+        return err
+    }
+
+    rc.Log.Infof("Started form %s for %s", form.ID, recipientJID)
+    rc.sendFormText(recipientJID, form.Intro)
+    return rc.sendFormText(recipientJID, form.Fields[0].PromptText())
+}
+
+func (rc *RIVAClient) CancelForm(session RIVAFormSession) error {
+    if err := rc.DB.DeleteFormSession(session.ChatJID); err != nil {
+        return err
+    }
+
+    form, _ := FindForm(session.FormID)
+    rc.Log.Infof("Cancelled form %s for %s", session.FormID, session.ChatJID)
+    return rc.sendFormText(session.ChatJID, form.Cancelled)
+}
+
+/*
+ * Records the answer to the current question and asks the next one, or asks
+ * the same question again if the answer is invalid. After the last question
+ * the answers are stored as a submission and the session is removed.
+ */
+func (rc *RIVAClient) AnswerForm(session RIVAFormSession, answer string) error {
+    form, found := FindForm(session.FormID)
+    if !found || session.Step >= len(form.Fields) {
+        rc.Log.Warnf("Dropping form session of %s for unknown form %s", session.ChatJID, session.FormID)
+        return rc.DB.DeleteFormSession(session.ChatJID)
+    }
+
+    field := form.Fields[session.Step]
+    value, valid := field.Validate(answer)
+    if !valid {
+        reprompt := field.PromptText()
+        if field.Error != "" {
+            reprompt = field.Error + "\n\n" + reprompt
+        }
+
+        return rc.sendFormText(session.ChatJID, reprompt)
+    }
+
+    session.Answers[field.ID] = value
+    session.Step++
+    session.UpdatedAt = time.Now()
+
+    if session.Step < len(form.Fields) {
+        if err := rc.DB.SaveFormSession(session); err != nil {
+            return err
+        }
+
+        return rc.sendFormText(session.ChatJID, form.Fields[session.Step].PromptText())
+    }
+
+    if err := rc.DB.CompleteFormSession(session); err != nil {
+        return err
+    }
+
+    rc.Log.Infof("Form %s completed by %s", form.ID, session.ChatJID)
+    return rc.sendFormText(session.ChatJID, form.Completed)
+}
+
+/*
+ * Answers are typed by contacts, and spreadsheets run cells starting with =,
+ * +, -, @, a tab or a carriage return as formulas. A leading ' makes them
+ * plain text again. Number answers were validated as integers when they were
+ * given, so a negative one is left alone to stay a number.
+ */
+func escapeCSVCell(field RIVAFormField, value string) string {
+    if field.Type == FieldNumber {
+        if _, err := strconv.Atoi(value); err == nil {
+            return value
+        }
+    }
+
+    if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+        return "'" + value
+    }
+
+    return value
+}
+
+// Writes submissions as CSV with one column per form field, in form order.
+func WriteFormSubmissionsCSV(w io.Writer, form RIVAForm, submissions []RIVAFormSubmission) error {
+    writer := csv.NewWriter(w)
+
+    header := []string{"submission_id", "submitted_at", "chat_jid"}
+    for _, field := range form.Fields {
+        header = append(header, field.ID)
+    }
+
+    if err := writer.Write(header); err != nil {
+        return err
+    }
+
+    for _, submission := range submissions {
+        record := []string{
+            strconv.FormatInt(submission.ID, 10),
+            submission.SubmittedAt.In(ScheduleLocation()).Format(time.RFC3339),
+            submission.ChatJID.String(),
+        }
+
+        for _, field := range form.Fields {
+            record = append(record, escapeCSVCell(field, submission.Answers[field.ID]))
+        }
+
+        if err := writer.Write(record); err != nil {
+            return err
+        }
+    }
+
+    writer.Flush()
+    return writer.Error()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWriteFormSubmissionsCSVEscapesFormulas(t *testing.T) {
+    form := RIVAForm{ID: "signup", Fields: []RIVAFormField{{ID: "name"}, {ID: "note"}, {ID: "change", Type: FieldNumber, Min: -10}}}
+    submissions := []RIVAFormSubmission{{
+        ID:          1,
+        FormID:      "signup",
+        ChatJID:     testSender,
+        Answers:     map[string]string{"name": "=HYPERLINK(\"http://evil\")", "note": "Plain answer", "change": "-5"},
+        SubmittedAt: time.Now(),
+    }, {
+        ID:          2,
+        FormID:      "signup",
+        ChatJID:     testSender,
+        Answers:     map[string]string{"name": "+65 9123 4567", "note": "\t=1+1", "change": "-SUM(A1)"},
+        SubmittedAt: time.Now(),
+    }}
+
+    var buf bytes.Buffer
+    if err := WriteFormSubmissionsCSV(&buf, form, submissions); err != nil {
+        t.Fatal(err)
+    }
+
+    records, err := csv.NewReader(&buf).ReadAll()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    want := [][]string{
+        {"'=HYPERLINK(\"http://evil\")", "Plain answer", "-5"},
+        {"'+65 9123 4567", "'\t=1+1", "'-SUM(A1)"},
+    }
+    for i, row := range want {
+        got := records[i + 1][3:]
+        if !slices.Equal(got, row) {
+            t.Errorf("row %d is %q, want %q", i + 1, got, row)
+        }
+    }
+}
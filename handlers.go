@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"strings"
 	"time"
+
+	"go.mau.fi/whatsmeow/types"
 )
 
 type SequentialMessageHandlerFunc func(
@@ -25,6 +29,67 @@ func FilterOldMessagesHandler(rc *RIVAClient, msg RIVAClientMessage, next func()
     return next
 }
 
+/*
+ * Drops inbound private messages from senders who flood us before they are
+ * archived or answered, and escalates once per window through flood_actions.
+ * Redeliveries are filtered out before this so they are not counted twice.
+ * Media counts towards the rate like any other message, so a flood of
+ * stickers or photos is stopped before it is downloaded, but it is judged by
+ * its caption and never as repeated text.
+ */
+func FloodGuardHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    if msg.IsSentByMe() || msg.IsGroup || msg.IsNewsletter() || !rc.Flood.IsEnabled() {
+        return next
+    }
+
+    text := msg.Content
+    if msg.Media != nil {
+        text = msg.Media.Caption
+    }
+
+    reason, strike, newStrike := rc.Flood.Check(msg.FromNonAD, text, msg.Media != nil, msg.Timestamp)
+    if reason == "" {
+        return next
+    }
+
+    if newStrike {
+        rc.Flood.Escalate(msg, msg.Content, reason, strike)
+    } else {
+        rc.Log.Infof("FloodGuardHandler: Dropping message %s from %s (%s)", msg.ID, msg.FromNonAD, reason)
+    }
+
+    return stop
+}
+
+func FilterProcessedMessagesHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    chatJID := msg.Chat
+
+    processed, found, err := rc.DB.GetProcessedMessage(chatJID, msg.ID)
+    if err != nil {
+        rc.Log.Errorf("FilterProcessedMessagesHandler: Failed to check message %s, processing anyway: %v", msg.ID, err)
+        return next
+    }
+
+    if found && processed.Status == ProcessedStatusCompleted {
+        rc.Log.Infof("FilterProcessedMessagesHandler: Ignoring already processed message %s in %s (first seen %s)", msg.ID, chatJID, processed.FirstSeen.Format(time.RFC3339))
+        return stop
+    }
+
+    if err := rc.DB.SetProcessedMessageStatus(chatJID, msg.ID, ProcessedStatusProcessing); err != nil {
+        rc.Log.Errorf("FilterProcessedMessagesHandler: Failed to mark message %s as processing: %v", msg.ID, err)
+    }
+
+    // The rest of the pipeline runs within next, so only messages that got
+    // this far are marked as completed once it returns.
+    return func() {
+        next()
+
+        if err := rc.DB.SetProcessedMessageStatus(chatJID, msg.ID, ProcessedStatusCompleted); err != nil {
+            rc.Log.Errorf("FilterProcessedMessagesHandler: Failed to mark message %s as processed: %v", msg.ID, err)
+        }
+    }
+}
+
 func FilterUnsupportedMessagesHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
     if msg.Type == TypeUnsupported {
         rc.Log.Infof("Ignoring unsupported message: %+v", msg)
@@ -41,19 +106,350 @@ func FilterUnsupportedMessagesHandler(rc *RIVAClient, msg RIVAClientMessage, nex
 
 func LogNewMessageHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
     rc.Log.Infof("New message: %+v", msg)
+
+    if msg.IsGroup && msg.MentionsMe() {
+        rc.Log.Infof("Mentioned by %s in group %s: %s", msg.FromNonAD, msg.Chat, msg.Content)
+    }
+
+    if msg.IsForwardedChain() {
+        rc.Log.Infof("Message %s from %s was forwarded many times (score %d)", msg.ID, msg.FromNonAD, msg.Context.ForwardingScore)
+    }
+
+    return next
+}
+
+func ArchiveMessageHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    if msg.Type == TypeEdit || msg.Type == TypeRevoke {
+        return next
+    }
+
+    if err := rc.DB.ArchiveMessage(msg); err != nil {
+        rc.Log.Errorf("ArchiveMessageHandler: Failed to archive message %s: %v", msg.ID, err)
+    }
+
+    return next
+}
+
+// Messages representatives send from the phone are tracked like the bot's own,
+// so receipts tell us whether the contact has seen a human reply.
+func TrackSentMessageHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    if !msg.IsSentByMe() || msg.Type == TypeEdit || msg.Type == TypeRevoke {
+        return next
+    }
+
+    rc.DB.RecordSentMessage(msg.Chat, msg.ID, SentManual, msg.Timestamp)
+    return next
+}
+
+// Keeps the contacts directory current. Messages we send only count towards
+// the contact in one-to-one chats, as a group message is not sent to anyone.
+func TrackContactHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    if msg.Type == TypeEdit || msg.Type == TypeRevoke {
+        return next
+    }
+
+    if !msg.IsSentByMe() {
+        rc.DB.RecordContactMessage(msg.FromNonAD, msg.PushName, msg.Timestamp, true)
+    } else if !msg.IsGroup && !rc.Resolver.IsOwnJID(msg.Chat) {
+        rc.DB.RecordContactMessage(msg.Chat, "", msg.Timestamp, false)
+    }
+
     return next
 }
 
+func TrackEditsHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    if msg.Type != TypeEdit && msg.Type != TypeRevoke {
+        return next
+    }
+
+    content := msg.Content
+    if msg.Type == TypeRevoke {
+        content = "[REVOKED]"
+    }
+
+    if err := rc.DB.ApplyArchivedEdit(msg.Chat, msg.Target.MessageID, msg.Type, content, msg.Timestamp); err != nil {
+        rc.Log.Errorf("TrackEditsHandler: Failed to apply %s to message %s: %v", msg.Type, msg.Target.MessageID, err)
+    } else {
+        rc.Log.Infof("TrackEditsHandler: Applied %s from %s to message %s", msg.Type, msg.FromNonAD, msg.Target.MessageID)
+    }
+
+    // Edits and revokes only change an earlier message, nothing else in the
+    // pipeline should treat them as a new message.
+    return stop
+}
+
+/*
+ * Operators control the running bot by sending commands such as /pause or
+ * /stats today to the control group. Other messages in the group are handled
+ * as usual.
+ */
+func ControlCommandHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    if !msg.IsGroup || msg.IsReferential() || !strings.HasPrefix(strings.TrimSpace(msg.Content), "/") {
+        return next
+    }
+
+    if group, found := ControlGroupJID(); !found || msg.Chat != group {
+        return next
+    }
+
+    rc.HandleControlCommand(msg)
+    return stop
+}
+
+/*
+ * Representatives register the linked device they are using by sending
+ *
+ *   /iam <name>
+ *
+ * to the "Message yourself" chat of the bot's number. "/iam" on its own
+ * removes the mapping so the device falls back to the generic footer.
+ */
+func RepresentativeCommandHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    if !msg.IsSentByMe() || msg.IsGroup || !rc.Resolver.IsOwnJID(msg.Chat) {
+        return next
+    }
+
+    command := strings.TrimSpace(msg.Content)
+    if command != "/iam" && !strings.HasPrefix(command, "/iam ") {
+        return next
+    }
+
+    deviceID := msg.From.Device
+    name := strings.TrimSpace(strings.TrimPrefix(command, "/iam"))
+    if name == "" {
+        if err := rc.DB.DeleteRepresentative(deviceID); err == nil {
+            rc.Log.Infof("RepresentativeCommandHandler: Cleared representative for device %d", deviceID)
+        }
+
+        return stop
+    }
+
+    if err := rc.DB.SetRepresentative(deviceID, name); err == nil {
+        rc.Log.Infof("RepresentativeCommandHandler: Device %d is now signed as %s", deviceID, name)
+    }
+
+    return stop
+}
+
+func cutToken(s string) (string, string) {
+    s = strings.TrimLeft(s, " \t")
+    if idx := strings.IndexAny(s, " \t\n"); idx >= 0 {
+        return s[:idx], s[idx:]
+    }
+
+    return s, ""
+}
+
+/*
+ * Representatives schedule a message to the chat they are in by sending
+ *
+ *   /later [daily|weekly] <when> <text>
+ *
+ * from the linked phone, e.g. "/later 18:30 See you tonight!" or
+ * "/later weekly 2025-06-02 09:00 Weekly reminder". The command itself is
+ * revoked so the contact never sees it, except in the "Message yourself" chat.
+ */
+func LaterCommandHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    if !msg.IsSentByMe() || msg.Type == TypeEdit || msg.Type == TypeRevoke {
+        return next
+    }
+
+    command, rest := cutToken(msg.Content)
+    if command != "/later" {
+        return next
+    }
+
+    recurrence := RecurrenceNone
+    when, rest := cutToken(rest)
+    if when == RecurrenceDaily || when == RecurrenceWeekly {
+        recurrence = when
+        when, rest = cutToken(rest)
+    }
+
+    if _, err := time.Parse("2006-01-02", when); err == nil {
+        clock, remainder := cutToken(rest)
+        when, rest = when + " " + clock, remainder
+    }
+
+    text := strings.TrimSpace(rest)
+    sendAt, err := ParseScheduleTime(when, time.Now())
+    if err != nil || text == "" {
+        rc.Log.Warnf("LaterCommandHandler: Ignoring malformed command in %s: %v", msg.Chat, err)
+        return stop
+    }
+
+    sm, err := NewScheduledMessage(msg.Chat, sendAt, recurrence, rc.formatHeaderFooter(msg, text), "", msg.FromNonAD.String())
+    if err != nil {
+        rc.Log.Warnf("LaterCommandHandler: Failed to schedule message in %s: %v", msg.Chat, err)
+        return stop
+    }
+
+    id, err := rc.DB.InsertScheduledMessage(sm)
+    if err != nil {
+        return stop
+    }
+
+    rc.Log.Infof("LaterCommandHandler: Scheduled message %d to %s at %s", id, sm.RecipientJID, sm.SendAt.Format(time.RFC3339))
+
+    if !rc.Resolver.IsOwnJID(msg.Chat) {
+        revoke := rc.WMClient.BuildRevoke(msg.Chat, types.EmptyJID, msg.ID)
+        if _, err := rc.WMClient.SendMessage(context.Background(), msg.Chat, revoke); err != nil {
+            rc.Log.Errorf("LaterCommandHandler: Failed to revoke command message %s: %v", msg.ID, err)
+        }
+    }
+
+    return stop
+}
+
+func matchesKeyword(content string, keywords []string) (string, bool) {
+    cleanMsg := strings.TrimSpace(content)
+    for _, keyword := range keywords {
+        if strings.EqualFold(cleanMsg, keyword) {
+            return keyword, true
+        }
+    }
+
+    return "", false
+}
+
+/*
+ * Contacts opt out of automated messages by sending one of the opt-out
+ * keywords on its own, and opt back in with one of the opt-in keywords. The
+ * confirmation is only sent when the state actually changes, so repeating
+ * STOP does not get a reply every time.
+ */
+func OptOutHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    if msg.IsSentByMe() || msg.IsGroup || msg.IsReferential() {
+        return next
+    }
+
+    if keyword, found := matchesKeyword(msg.Content, rBotOptOutKeywords); found {
+        added, err := rc.DB.AddSuppression(msg.FromNonAD, keyword)
+        if err != nil {
+            return stop
+        }
+
+        rc.Log.Infof("OptOutHandler: %s opted out with %q", msg.FromNonAD, keyword)
+        if added {
+            rc.SendConsentConfirmation(msg.FromNonAD, rBotOptOutConfirmation)
+        }
+
+        return stop
+    }
+
+    if keyword, found := matchesKeyword(msg.Content, rBotOptInKeywords); found {
+        removed, err := rc.DB.RemoveSuppression(msg.FromNonAD)
+        if err != nil {
+            return stop
+        }
+
+        rc.Log.Infof("OptOutHandler: %s opted in with %q", msg.FromNonAD, keyword)
+        if removed {
+            rc.SendConsentConfirmation(msg.FromNonAD, rBotOptInConfirmation)
+        }
+
+        return stop
+    }
+
+    return next
+}
+
+// Relays replies to enquiry summaries in the staff group back to the contact.
+func StaffReplyHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    if !rBotRelayStaffReplies || !msg.IsGroup || msg.Context == nil || msg.IsReferential() {
+        return next
+    }
+
+    if group, found := StaffGroupJID(); !found || msg.Chat != group {
+        return next
+    }
+
+    relayed, err := rc.RelayStaffReply(msg)
+    if err != nil {
+        rc.Log.Errorf("StaffReplyHandler: Failed to relay reply %s: %v", msg.ID, err)
+    }
+
+    if relayed {
+        return stop
+    }
+
+    return next
+}
+
+// Starts and answers conversations for first-response time tracking. Only
+// private chats count, and the "Message yourself" chat is left out.
+func TrackResponseTimeHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    if msg.IsGroup || msg.IsReferential() || msg.IsNewsletter() || rc.Resolver.IsOwnJID(msg.Chat) {
+        return next
+    }
+
+    if !msg.IsSentByMe() {
+        if started, err := rc.DB.RecordInboundMessage(msg.Chat, msg.Timestamp); err == nil && started {
+            rc.Log.Infof("TrackResponseTimeHandler: New conversation with %s", msg.Chat)
+        }
+
+        return next
+    }
+
+    if answered, err := rc.DB.RecordHumanReply(msg.Chat, msg.Timestamp); err == nil && answered {
+        rc.Log.Infof("TrackResponseTimeHandler: First reply to %s sent", msg.Chat)
+    }
+
+    return next
+}
+
+/*
+ * Keeps the bot silent in chats handled by a human. A contact asks for one by
+ * sending a handover keyword on its own, and a representative replying from
+ * the phone starts or extends the handover. Later handlers (greeting, forms,
+ * menu) are skipped while it lasts, but the last interaction time is still
+ * kept so no greeting goes out right after the handover ends.
+ */
+func HandoverHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    if msg.IsGroup || msg.IsReferential() || msg.IsNewsletter() || rc.Resolver.IsOwnJID(msg.Chat) {
+        return next
+    }
+
+    if msg.IsSentByMe() {
+        if rBotHandoverOnReply {
+            rc.StartHandover(msg.Chat, HandoverRepresentative, msg.Timestamp)
+        }
+
+        return next
+    }
+
+    if keyword, found := matchesKeyword(msg.Content, rBotHandoverKeywords); found {
+        rc.Log.Infof("HandoverHandler: %s asked for a human with %q", msg.Chat, keyword)
+        if started, err := rc.StartHandover(msg.Chat, HandoverKeyword, msg.Timestamp); err == nil && started {
+            rc.AnnounceHandover(msg, true)
+        }
+    } else if _, found, err := rc.DB.GetHandover(msg.Chat, msg.Timestamp); err != nil || !found {
+        return next
+    } else {
+        rc.Log.Infof("HandoverHandler: Chat %s is handled by a human, staying silent", msg.Chat)
+    }
+
+    rc.DB.UpdateLastInteractionTime(msg.Chat, msg.Timestamp)
+    return stop
+}
+
 func SendGreetingMessageHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
-    if !msg.IsSentByMe() && !msg.IsGroup {
+    if !msg.IsSentByMe() && !msg.IsGroup && !msg.IsReferential() {
         rc.Log.Infof("SendGreetingMessageHandler: Processing message: %+v", msg)
 
         fromJID := msg.FromNonAD
         isNewsletter := msg.IsNewsletter()
+        isSuppressed, err := rc.DB.IsSuppressed(fromJID)
+        if err != nil {
+            rc.Log.Errorf("SendGreetingMessageHandler: Error checking suppression list for %s: %v", fromJID, err)
+            return next
+        }
 
         switch {
         case isNewsletter:
             rc.Log.Infof("SendGreetingMessageHandler: Sender %s is a newsletter. Skipping greeting", fromJID)
+        case isSuppressed:
+            rc.Log.Infof("SendGreetingMessageHandler: Sender %s has opted out. Skipping greeting", fromJID)
         default:
             lastInteraction, found, err := rc.DB.GetLastInteractionTime(fromJID)
             if err != nil {
@@ -74,7 +470,21 @@ func SendGreetingMessageHandler(rc *RIVAClient, msg RIVAClientMessage, next func
                 rc.Log.Infof("SendGreetingMessageHandler: Greeting cooldown: %+v", msg)
             }
 
-            if shouldSendGreeting {
+            // Away mode replaces the greeting with the away reply, which
+            // has its own cooldown.
+            paused := rc.IsAutomationPaused()
+            away, isAway := rc.ActiveAwayMode(msg.Timestamp)
+            if isAway && !paused {
+                if err := rc.SendAwayReply(fromJID, away, msg.Timestamp); err != nil {
+                    rc.Log.Errorf("SendGreetingMessageHandler: Failed to send away reply for %s: %v", fromJID, err)
+                }
+            }
+
+            if shouldSendGreeting && paused {
+                rc.Log.Infof("SendGreetingMessageHandler: Automation is paused. Skipping greeting for %s", fromJID)
+            } else if shouldSendGreeting && isAway {
+                rc.Log.Infof("SendGreetingMessageHandler: Away mode is on. Skipping greeting for %s", fromJID)
+            } else if shouldSendGreeting {
                 if err := rc.SendGreetingMessage(fromJID); err != nil {
                     rc.Log.Errorf("SendGreetingMessageHandler: Failed to send greeting for %s: %v", fromJID, err)
                 } else {
@@ -82,6 +492,12 @@ func SendGreetingMessageHandler(rc *RIVAClient, msg RIVAClientMessage, next func
                 }
             }
 
+            if shouldSendGreeting {
+                if err := rc.ForwardInquiry(msg); err != nil {
+                    rc.Log.Errorf("SendGreetingMessageHandler: Failed to forward enquiry from %s: %v", fromJID, err)
+                }
+            }
+
         }
 
         if err := rc.DB.UpdateLastInteractionTime(fromJID, msg.Timestamp); err != nil {
@@ -94,8 +510,132 @@ func SendGreetingMessageHandler(rc *RIVAClient, msg RIVAClientMessage, next func
     return next
 }
 
+/*
+ * Walks contacts through a form once one has been started, by keyword or from
+ * the menu. While a form is in progress every message is taken as an answer,
+ * except for the cancel and restart keywords. A form left idle for longer
+ * than form_timeout_hours is dropped and the message handled as usual.
+ */
+func FormHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    if len(rBotForms) == 0 || msg.IsSentByMe() || msg.IsGroup || msg.IsReferential() {
+        return next
+    }
+
+    session, found, err := rc.DB.GetFormSession(msg.FromNonAD)
+    if err != nil {
+        return next
+    }
+
+    timeout := time.Duration(rBotFormTimeoutHours * float64(time.Hour))
+    if found && timeout > 0 && time.Since(session.UpdatedAt) > timeout {
+        rc.Log.Infof("FormHandler: Form %s of %s expired", session.FormID, msg.FromNonAD)
+        rc.DB.DeleteFormSession(msg.FromNonAD)
+        found = false
+    }
+
+    if !found {
+        for _, form := range rBotForms {
+            if _, triggered := matchesKeyword(msg.Content, form.Triggers); triggered {
+                rc.StartForm(msg.FromNonAD, form.ID)
+                return stop
+            }
+        }
+
+        return next
+    }
+
+    if _, cancel := matchesKeyword(msg.Content, rBotFormCancelKeywords); cancel {
+        rc.CancelForm(session)
+        return stop
+    }
+
+    if _, restart := matchesKeyword(msg.Content, rBotFormRestartKeywords); restart {
+        rc.StartForm(msg.FromNonAD, session.FormID)
+        return stop
+    }
+
+    if err := rc.AnswerForm(session, msg.Content); err != nil {
+        rc.Log.Errorf("FormHandler: Failed to record answer from %s: %v", msg.FromNonAD, err)
+    }
+
+    return stop
+}
+
+/*
+ * Routes replies to the menu sent with the greeting. Only messages sent after
+ * the menu count, so the message that triggered the greeting is not taken as
+ * a choice, and the menu stops listening once it has been idle for longer
+ * than menu.timeout_minutes.
+ */
+func MenuReplyHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    if !rBotMenu.IsEnabled() || msg.IsSentByMe() || msg.IsGroup || msg.IsReferential() {
+        return next
+    }
+
+    menuID, shownAt, found, err := rc.DB.GetMenuSession(msg.FromNonAD)
+    if err != nil || !found || msg.Timestamp.Before(shownAt) {
+        return next
+    }
+
+    timeout := time.Duration(rBotMenu.TimeoutMinutes * float64(time.Minute))
+    if timeout > 0 && time.Since(shownAt) > timeout {
+        return next
+    }
+
+    item, back, ok := rBotMenu.Resolve(menuID, msg)
+    if !ok {
+        return next
+    }
+
+    switch {
+    case back:
+        rc.Log.Infof("MenuReplyHandler: %s went back to the main menu", msg.FromNonAD)
+        rc.SendMenu(msg.FromNonAD, rBotMenuRootID)
+    case len(item.Items) > 0:
+        rc.Log.Infof("MenuReplyHandler: %s opened submenu %q", msg.FromNonAD, item.ID)
+        rc.SendMenu(msg.FromNonAD, item.ID)
+    default:
+        rc.Log.Infof("MenuReplyHandler: %s chose %q", msg.FromNonAD, item.ID)
+        if err := rc.SendMenuReply(msg.FromNonAD, item); err != nil {
+            break
+        }
+
+        rc.DB.SetMenuSession(msg.FromNonAD, menuID, time.Now())
+        if item.Form != "" {
+            rc.StartForm(msg.FromNonAD, item.Form)
+        }
+
+        if item.Handover {
+            if started, err := rc.StartHandover(msg.FromNonAD, HandoverMenu, msg.Timestamp); err == nil && started {
+                rc.AnnounceHandover(msg, false)
+            }
+        }
+    }
+
+    return stop
+}
+
 func AutoEditOutgoingMessageHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
-    if !msg.IsSentByMe() || (msg.Type != TypeTextConv && msg.Type != TypeTextExt) {
+    // Our own BuildEdit comes back through EventMessage as an edit of the
+    // original message. It must never be edited again.
+    if msg.RawMessage.IsEdit || msg.Type == TypeEdit {
+        rc.Log.Infof("AutoEditOutgoingMessageHandler: Skipping edit echo: %+v", msg)
+        return stop
+    }
+
+    if !msg.IsSentByMe() {
+        rc.Log.Infof("AutoEditOutgoingMessageHandler: Skipping message: %+v", msg)
+        return stop
+    }
+
+    switch msg.Type {
+    case TypeTextConv, TypeTextExt:
+    case TypeImage, TypeVideo, TypeDocument:
+        if msg.Media.Caption == "" {
+            rc.Log.Infof("AutoEditOutgoingMessageHandler: Skipping media without caption: %+v", msg)
+            return stop
+        }
+    default:
         rc.Log.Infof("AutoEditOutgoingMessageHandler: Skipping message: %+v", msg)
         return stop
     }
@@ -112,3 +652,21 @@ func AutoEditOutgoingMessageHandler(rc *RIVAClient, msg RIVAClientMessage, next
     return next
 }
 
+/*
+ * Runs right after archiving so every incoming attachment is fetched, even if
+ * a later handler stops the pipeline. The download itself happens in the
+ * background so a large file does not hold up the messages behind it.
+ */
+func DownloadMediaHandler(rc *RIVAClient, msg RIVAClientMessage, next func(), stop func()) func() {
+    if msg.Direction != DirectionIncoming || !rc.Media.IsDownloadable(msg) {
+        return next
+    }
+
+    go func() {
+        if err := rc.Media.Download(msg); err != nil {
+            rc.Log.Errorf("Failed to download media from message %s: %v", msg.ID, err)
+        }
+    }()
+
+    return next
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+type RIVAHandoverReason string
+const (
+    HandoverKeyword        RIVAHandoverReason = "KEYWORD"
+    HandoverMenu           RIVAHandoverReason = "MENU"
+    HandoverRepresentative RIVAHandoverReason = "REPRESENTATIVE"
+)
+
+/*
+ * A chat is handed over to a human when the contact asks for one, by keyword
+ * or from the menu, or when a representative replies. Until it is resolved
+ * or handover_timeout_hours pass without a representative replying, the bot
+ * stays silent in the chat: no greeting, menu or form answers. Scheduled
+ * messages and campaigns are not affected.
+ */
+type RIVAHandover struct {
+    ChatJID   types.JID          `json:"chat_jid"`   // Chat handled by a human
+    Reason    RIVAHandoverReason `json:"reason"`     // What started the handover
+    StartedAt time.Time          `json:"started_at"` // When the handover started
+    ExpiresAt time.Time          `json:"expires_at"` // When the bot takes over again
+}
+
+func HandoverTimeout() time.Duration {
+    return time.Duration(rBotHandoverTimeoutHours * float64(time.Hour))
+}
+
+/*
+ * Hands a chat over to a human, or extends the handover if there already is
+ * one. Returns true if the handover is new, so the contact and staff are only
+ * told once.
+ */
+func (rc *RIVAClient) StartHandover(chatJID types.JID, reason RIVAHandoverReason, at time.Time) (bool, error) {
+    if HandoverTimeout() <= 0 {
+        return false, nil
+    }
+
+    handover, found, err := rc.DB.GetHandover(chatJID, at)
+    if err != nil {
+        return false, err
+    }
+
+    if !found {
+        handover = RIVAHandover{ChatJID: chatJID, Reason: reason, StartedAt: at}
+    }
+
+    handover.ExpiresAt = at.Add(HandoverTimeout())
+    if err := rc.DB.SaveHandover(handover); err != nil {
+        return false, err
+    }
+
+    if !found {
+        rc.Log.Infof("Chat %s handed over to a human (%s) until %s", chatJID, reason, handover.ExpiresAt.Format(time.RFC3339))
+    }
+
+    return !found, nil
+}
+
+// Tells the contact and the staff group that the contact asked for a human.
+func (rc *RIVAClient) AnnounceHandover(msg RIVAClientMessage, sendConfirmation bool) {
+    if sendConfirmation && rBotHandoverConfirmation != "" {
+        payload := &waE2E.Message{Conversation: proto.String(rBotHandoverConfirmation)}
+        if _, err := rc.SendAutomatedMessage(msg.Chat, payload, SentHandover); err != nil {
+            rc.Log.Errorf("Failed to confirm handover to %s: %v", msg.Chat, err)
+        }
+    }
+
+    if _, found := StaffGroupJID(); !found {
+        return
+    }
+
+    name := msg.PushName
+    if name == "" {
+        name = "Unknown"
+    }
+
+    rc.SendStaffMessage(fmt.Sprintf("*Handover:* %s (%s) asked to talk to a human. RIVABot will stay quiet in the chat for %.0f hours or until it is resolved.",
+                                    name, RedactNumber(msg.Chat), rBotHandoverTimeoutHours))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+/*
+ * WhatsApp is moving contacts from phone number JIDs (6581234567@s.whatsapp.net)
+ * to LIDs (123456789012345@lid), and the same person can reach us under either
+ * identity. Everything we persist is keyed by the phone number JID whenever a
+ * mapping is known, falling back to the LID otherwise.
+ */
+type RIVAClientResolver struct {
+    RClient *RIVAClient
+    Log     *RIVAClientLog
+}
+
+func (*RIVAClientResolver) New(rClient *RIVAClient) *RIVAClientResolver {
+    return &RIVAClientResolver{
+        RClient: rClient,
+        Log:     NewRIVAClientLog("RIVABotResolver", "INFO"),
+    }
+}
+
+func (r *RIVAClientResolver) Canonical(jid types.JID) types.JID {
+    return r.CanonicalWithAlt(jid, types.EmptyJID)
+}
+
+// Messages addressed by LID usually carry the phone number JID as an
+// alternative address. Prefer it, and remember the mapping for later lookups.
+func (r *RIVAClientResolver) CanonicalWithAlt(jid types.JID, alt types.JID) types.JID {
+    jid = jid.ToNonAD()
+    if jid.Server != types.HiddenUserServer {
+        return jid
+    }
+
+    if !alt.IsEmpty() && alt.Server == types.DefaultUserServer {
+        pn := alt.ToNonAD()
+        if r.RClient != nil && r.RClient.WMClient.Store.LIDs != nil {
+            if err := r.RClient.WMClient.Store.LIDs.PutLIDMapping(context.Background(), jid, pn); err != nil {
+                r.Log.Warnf("Failed to store LID mapping %s -> %s: %v", jid, pn, err)
+            }
+        }
+
+        return pn
+    }
+
+    if pn, found := r.lookupPN(jid); found {
+        return pn
+    }
+
+    return jid
+}
+
+func (r *RIVAClientResolver) IsOwnJID(jid types.JID) bool {
+    if r.RClient == nil || r.RClient.WMClient.Store == nil || r.RClient.WMClient.Store.ID == nil {
+        return false
+    }
+
+    store := r.RClient.WMClient.Store
+    canonical := r.Canonical(jid)
+    return canonical.User == store.ID.User || (!store.LID.IsEmpty() && jid.ToNonAD().User == store.LID.User)
+}
+
+func (r *RIVAClientResolver) lookupPN(lid types.JID) (types.JID, bool) {
+    if r.RClient == nil || r.RClient.WMClient.Store.LIDs == nil {
+        return types.EmptyJID, false
+    }
+
+    pn, err := r.RClient.WMClient.Store.LIDs.GetPNForLID(context.Background(), lid)
+    if err != nil {
+        r.Log.Warnf("Failed to look up phone number for %s: %v", lid, err)
+        return types.EmptyJID, false
+    }
+
+    if pn.IsEmpty() {
+        return types.EmptyJID, false
+    }
+
+    return pn.ToNonAD(), true
+}
+
+// Accepts a full JID, or a phone number in international format with or
+// without the leading + and spaces, e.g. "+65 8123 4567".
+func ParseRecipientJID(value string) (types.JID, error) {
+    value = strings.TrimSpace(value)
+    if strings.Contains(value, "@") {
+        jid, err := types.ParseJID(value)
+        if err != nil {
+            return types.EmptyJID, err
+        }
+
+        return jid.ToNonAD(), nil
+    }
+
+    number := strings.NewReplacer("+", "", " ", "", "-", "").Replace(value)
+    if number == "" {
+        return types.EmptyJID, fmt.Errorf("empty recipient")
+    }
+
+    for _, c := range number {
+        if c < '0' || c > '9' {
+            return types.EmptyJID, fmt.Errorf("invalid phone number %q", value)
+        }
+    }
+
+    return types.NewJID(number, types.DefaultUserServer), nil
+}
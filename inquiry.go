@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// Longest first message quoted in an inquiry summary, in characters.
+const rBotInquiryTextMaxLength = 500
+
+/*
+ * Hides the middle of a phone number so summaries posted in the staff group
+ * do not expose it in full, e.g. +6581234567 becomes +65****4567. The full
+ * number stays in the database for relaying replies.
+ */
+func RedactNumber(jid types.JID) string {
+    digits := []rune(jid.User)
+    if jid.Server != types.DefaultUserServer {
+        if len(digits) <= 4 {
+            return "LID"
+        }
+
+        return "LID …" + string(digits[len(digits) - 4:])
+    }
+
+    if len(digits) <= 6 {
+        return "+" + strings.Repeat("*", len(digits) - 2) + string(digits[len(digits) - 2:])
+    }
+
+    return "+" + string(digits[:2]) + strings.Repeat("*", len(digits) - 6) + string(digits[len(digits) - 4:])
+}
+
+func inquirySummary(msg RIVAClientMessage) string {
+    var sb strings.Builder
+
+    name := msg.PushName
+    if name == "" {
+        name = "Unknown"
+    }
+
+    fmt.Fprintf(&sb, "*New enquiry* from %s (%s)\n", name, RedactNumber(msg.FromNonAD))
+    if msg.Media != nil || msg.Type == TypeLocation || msg.Type == TypeContact {
+        fmt.Fprintf(&sb, "Type: %s\n", msg.Type)
+    }
+
+    content := msg.Content
+    if msg.Media != nil {
+        content = msg.Media.Caption
+    }
+
+    text := []rune(strings.TrimSpace(content))
+    if len(text) > rBotInquiryTextMaxLength {
+        text = append(text[:rBotInquiryTextMaxLength], '…')
+    }
+
+    if len(text) > 0 {
+        fmt.Fprintf(&sb, "\n%s\n", string(text))
+    }
+
+    if rBotRelayStaffReplies {
+        sb.WriteString("\n_Reply to this message to answer them from our number._")
+    }
+
+    return strings.TrimRight(sb.String(), "\n")
+}
+
+// Posts a summary of the first message of a new conversation to the staff group.
+func (rc *RIVAClient) ForwardInquiry(msg RIVAClientMessage) error {
+    if !rBotForwardInquiries {
+        return nil
+    }
+
+    if _, found := StaffGroupJID(); !found {
+        return nil
+    }
+
+    resp, err := rc.SendStaffMessage(inquirySummary(msg))
+    if err != nil {
+        return err
+    }
+
+    rc.Log.Infof("Forwarded enquiry from %s to the staff group as %s", msg.FromNonAD, resp.ID)
+    return rc.DB.RecordStaffForward(resp.ID, msg.FromNonAD, resp.Timestamp)
+}
+
+/*
+ * Staff answer an enquiry by replying to its summary in the staff group. The
+ * reply is sent to the contact with the representative header and footer,
+ * signed with the staff member's WhatsApp name, and acknowledged with a
+ * reaction so others can see it went out.
+ */
+func (rc *RIVAClient) RelayStaffReply(msg RIVAClientMessage) (bool, error) {
+    if msg.Context == nil || msg.Context.QuotedMessageID == "" {
+        return false, nil
+    }
+
+    contact, found, err := rc.DB.GetStaffForward(msg.Context.QuotedMessageID)
+    if err != nil || !found {
+        return false, err
+    }
+
+    text := strings.TrimSpace(msg.Content)
+    if (msg.Type != TypeTextConv && msg.Type != TypeTextExt) || text == "" {
+        rc.Log.Warnf("Not relaying %s reply from %s to %s, only text can be relayed", msg.Type, msg.FromNonAD, contact)
+        return true, nil
+    }
+
+    content := fmt.Sprintf(rBotOrgHeaderFooter, text)
+    if rBotOrgHeaderFooterSigned != "" && msg.PushName != "" {
+        content = fmt.Sprintf(rBotOrgHeaderFooterSigned, text, msg.PushName)
+    }
+
+    if _, err := rc.SendTrackedMessage(contact, &waE2E.Message{Conversation: proto.String(content)}, SentRelay); err != nil {
+        rc.Log.Errorf("Failed to relay reply from %s to %s: %v", msg.FromNonAD, contact, err)
+        return true, err
+    }
+
+    rc.Log.Infof("Relayed reply from %s in the staff group to %s", msg.FromNonAD, contact)
+    rc.DB.RecordHumanReply(contact, time.Now())
+    if rBotHandoverOnReply {
+        rc.StartHandover(contact, HandoverRepresentative, time.Now())
+    }
+
+    reaction := rc.WMClient.BuildReaction(msg.Chat, msg.From.ToNonAD(), msg.ID, "✅")
+    if _, err := rc.WMClient.SendMessage(context.Background(), msg.Chat, reaction); err != nil {
+        rc.Log.Warnf("Failed to acknowledge relayed reply %s: %v", msg.ID, err)
+    }
+
+    return true, nil
+}
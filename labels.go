@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+/*
+ * WhatsApp Business labels are kept in app state and synced to every linked
+ * device, so the labels representatives set on the phone reach us through
+ * events and the ones we set are visible on the phone. The tables here are a
+ * mirror for querying; app state stays the source of truth.
+ */
+type RIVALabel struct {
+    ID        string    `json:"id"`         // Label ID assigned by WhatsApp
+    Name      string    `json:"name"`       // Name shown in the app
+    Color     int32     `json:"color"`      // Index into WhatsApp's label colour palette
+    Deleted   bool      `json:"deleted"`    // If the label was deleted on the phone
+    UpdatedAt time.Time `json:"updated_at"` // When the label was last edited
+    Chats     int       `json:"chats"`      // Number of chats with the label
+    Messages  int       `json:"messages"`   // Number of messages with the label
+}
+
+type RIVALabeledChat struct {
+    ChatJID   types.JID `json:"chat_jid"`   // Chat with the label
+    LabeledAt time.Time `json:"labeled_at"` // When the label was applied
+}
+
+type RIVALabeledMessage struct {
+    ChatJID   types.JID `json:"chat_jid"`   // Chat the message is in
+    MessageID string    `json:"message_id"` // Message with the label
+    LabeledAt time.Time `json:"labeled_at"` // When the label was applied
+}
+
+// Finds a label that has not been deleted by its ID or, case-insensitively, its name.
+func FindLabel(db *RIVAClientDB, nameOrID string) (RIVALabel, bool, error) {
+    labels, err := db.ListLabels(false)
+    if err != nil {
+        return RIVALabel{}, false, err
+    }
+
+    for _, label := range labels {
+        if label.ID == nameOrID || strings.EqualFold(label.Name, strings.TrimSpace(nameOrID)) {
+            return label, true, nil
+        }
+    }
+
+    return RIVALabel{}, false, nil
+}
+
+// Setting that holds "true" once the label mirror has been filled from app state.
+const rBotSettingLabelsSeeded = "labels_seeded"
+
+/*
+ * Label events only arrive for changes made while we are connected, and
+ * WhatsMeow does not emit them for full syncs at all, so labels created
+ * before the bot was linked never reach the mirror. The first time we
+ * connect, the regular app state, which holds labels and their associations,
+ * is fully synced again with events enabled to fill it. After that the
+ * incremental syncs WhatsMeow runs on its own keep it up to date.
+ */
+func (rc *RIVAClient) SyncLabels() error {
+    seeded, _, err := rc.DB.GetSetting(rBotSettingLabelsSeeded)
+    if err != nil || seeded == "true" {
+        return err
+    }
+
+    rc.WMClient.EmitAppStateEventsOnFullSync = true
+    defer func() { rc.WMClient.EmitAppStateEventsOnFullSync = false }()
+
+    if err := rc.WMClient.FetchAppState(context.Background(), appstate.WAPatchRegular, true, false); err != nil {
+        rc.Log.Errorf("Failed to sync labels: %v", err)
+        return err
+    }
+
+    if err := rc.DB.SetSetting(rBotSettingLabelsSeeded, "true", "sync"); err != nil {
+        return err
+    }
+
+    labels, err := rc.DB.ListLabels(false)
+    if err != nil {
+        return err
+    }
+
+    rc.Log.Infof("Synced labels, %d labels known.", len(labels))
+    return nil
+}
+
+func (rc *RIVAClient) ApplyLabelEdit(evt *events.LabelEdit) {
+    if evt.Action == nil {
+        return
+    }
+
+    label := RIVALabel{
+        ID:        evt.LabelID,
+        Name:      evt.Action.GetName(),
+        Color:     evt.Action.GetColor(),
+        Deleted:   evt.Action.GetDeleted(),
+        UpdatedAt: evt.Timestamp,
+    }
+
+    if err := rc.DB.SaveLabel(label); err == nil && !evt.FromFullSync {
+        rc.Log.Infof("Label %s (%q) updated, deleted: %t", label.ID, label.Name, label.Deleted)
+    }
+}
+
+func (rc *RIVAClient) ApplyLabelAssociationChat(evt *events.LabelAssociationChat) {
+    if evt.Action == nil {
+        return
+    }
+
+    chat := rc.Resolver.Canonical(evt.JID)
+    rc.DB.SetChatLabel(evt.LabelID, chat, evt.Action.GetLabeled(), evt.Timestamp)
+}
+
+func (rc *RIVAClient) ApplyLabelAssociationMessage(evt *events.LabelAssociationMessage) {
+    if evt.Action == nil {
+        return
+    }
+
+    chat := rc.Resolver.Canonical(evt.JID)
+    rc.DB.SetMessageLabel(evt.LabelID, chat, evt.MessageID, evt.Action.GetLabeled(), evt.Timestamp)
+}
+
+/*
+ * Adds or removes a label on a chat through an app state patch, so the
+ * change shows up on the phone as well. The label must already exist; we do
+ * not create labels on our own.
+ */
+func (rc *RIVAClient) LabelChat(chat types.JID, nameOrID string, labeled bool) error {
+    label, found, err := FindLabel(rc.DB, nameOrID)
+    if err != nil {
+        return err
+    }
+
+    if !found {
+        return fmt.Errorf("no label named %q", nameOrID)
+    }
+
+    if err := rc.WMClient.SendAppState(context.Background(), appstate.BuildLabelChat(chat, label.ID, labeled)); err != nil {
+        rc.Log.Errorf("Failed to set label %q on %s: %v", label.Name, chat, err)
+        return err
+    }
+
+    return rc.DB.SetChatLabel(label.ID, chat, labeled, time.Now())
+}
+
+func (rc *RIVAClient) LabelMessage(chat types.JID, messageID string, nameOrID string, labeled bool) error {
+    label, found, err := FindLabel(rc.DB, nameOrID)
+    if err != nil {
+        return err
+    }
+
+    if !found {
+        return fmt.Errorf("no label named %q", nameOrID)
+    }
+
+    if err := rc.WMClient.SendAppState(context.Background(), appstate.BuildLabelMessage(chat, label.ID, messageID, labeled)); err != nil {
+        rc.Log.Errorf("Failed to set label %q on message %s: %v", label.Name, messageID, err)
+        return err
+    }
+
+    return rc.DB.SetMessageLabel(label.ID, chat, messageID, labeled, time.Now())
+}
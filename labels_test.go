@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSyncLabelsSkipsOnceSeeded(t *testing.T) {
+    rc := newTestClient(t, &fakeDownloader{})
+
+    // The test client was never paired, so a full sync would fail.
+    if err := rc.DB.SetSetting(rBotSettingLabelsSeeded, "true", "sync"); err != nil {
+        t.Fatal(err)
+    }
+
+    if err := rc.SyncLabels(); err != nil {
+        t.Errorf("synced again after seeding: %v", err)
+    }
+}
@@ -8,6 +8,7 @@ import (
     "context"
     "syscall"
     "database/sql"
+    _ "time/tzdata"
 
     _ "github.com/mattn/go-sqlite3"
     "go.mau.fi/whatsmeow"
@@ -43,6 +44,16 @@ func main() {
 
     logger.Infof("Successfully connected to SQLite database.")
 
+    if len(os.Args) > 1 {
+        if err := RunCLI(dbConn, os.Args[1:]); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            dbConn.Close()
+            os.Exit(1)
+        }
+
+        return
+    }
+
     container := sqlstore.NewWithDB(dbConn, "sqlite3", logger.logger)
     if container == nil {
         logger.Errorf("Failed to create WhatsMeow SQL store container.")
@@ -50,7 +61,7 @@ func main() {
     }
 
     if err := container.Upgrade(ctx); err != nil {
-        logger.Errorf("Failed to upgrade database: %w", err)
+        logger.Errorf("Failed to upgrade database: %v", err)
         panic(err)
     }
 
@@ -101,6 +112,18 @@ func main() {
         logger.Infof("QR scan process finished.")
     }
 
+    ctxRun, cancelRun := context.WithCancel(ctx)
+    defer cancelRun()
+
+    go client.Scheduler.Run(ctxRun)
+    go client.Campaigner.Run(ctxRun)
+    go client.SLA.Run(ctxRun)
+    go func() {
+        if err := client.Admin.Run(ctxRun); err != nil {
+            logger.Errorf("Failed to start admin API: %v", err)
+        }
+    }()
+
     // Listen to CTRL+C
     c := make(chan os.Signal, 1)
     signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -108,6 +131,7 @@ func main() {
     logger.Infof("Client is running. Press CTRL+C to disconnect and exit.")
     <-c
 
+    cancelRun()
     logger.Infof("Disconnecting client...")
     wm.Disconnect()
     logger.Infof("Client disconnected. Exiting.")
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waMmsRetry"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+type RIVAStoredMediaStatus string
+const (
+    MediaStatusStored       RIVAStoredMediaStatus = "STORED"
+    MediaStatusPendingRetry RIVAStoredMediaStatus = "PENDING_RETRY"
+    MediaStatusTooLarge     RIVAStoredMediaStatus = "TOO_LARGE"
+    MediaStatusFailed       RIVAStoredMediaStatus = "FAILED"
+)
+
+// Fetches and decrypts media attachments. Satisfied by *whatsmeow.Client.
+type MediaDownloader interface {
+    Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error)
+}
+
+type RIVAClientMediaStore struct {
+    RClient    *RIVAClient
+    DB         *RIVAClientDB
+    Log        *RIVAClientLog
+    Dir        string
+    Downloader MediaDownloader
+
+    // Messages waiting on the phone to re-upload expired media, keyed by
+    // message ID. Only kept in memory as the retry has to be answered by the
+    // phone within the same session anyway.
+    pendingRetries map[types.MessageID]RIVAClientMessage
+    pendingMutex   sync.Mutex
+}
+
+func (*RIVAClientMediaStore) New(rClient *RIVAClient, db *RIVAClientDB) *RIVAClientMediaStore {
+    ms := &RIVAClientMediaStore{
+        RClient:        rClient,
+        DB:             db,
+        Log:            NewRIVAClientLog("RIVABotMedia", "INFO"),
+        Dir:            rBotMediaDir,
+        Downloader:     rClient.WMClient,
+        pendingRetries: make(map[types.MessageID]RIVAClientMessage),
+    }
+
+    if err := os.MkdirAll(ms.Dir, 0o750); err != nil {
+        ms.Log.Errorf("Failed to create media directory %s: %v", ms.Dir, err)
+        panic(err)
+    }
+
+    return ms
+}
+
+func (ms *RIVAClientMediaStore) IsDownloadable(msg RIVAClientMessage) bool {
+    switch msg.Type {
+    case TypeImage, TypeVideo, TypeAudio, TypeDocument:
+        return msg.Media != nil && msg.getDownloadable() != nil
+    }
+
+    return false
+}
+
+func (ms *RIVAClientMediaStore) Download(msg RIVAClientMessage) error {
+    if !ms.IsDownloadable(msg) {
+        return nil
+    }
+
+    chatJID := msg.Chat
+    // A size limit of zero means media of any size is stored.
+    maxBytes := uint64(rBotMediaMaxSizeMB * 1024 * 1024)
+    if maxBytes > 0 && msg.Media.FileLength > maxBytes {
+        ms.Log.Warnf("Skipping %s from message %s: %d bytes exceeds limit of %d bytes", msg.Type, msg.ID, msg.Media.FileLength, maxBytes)
+        return ms.DB.UpsertStoredMedia(chatJID, msg, msg.Media.FileSHA256, "", MediaStatusTooLarge)
+    }
+
+    data, err := ms.Downloader.Download(context.Background(), msg.getDownloadable())
+    if errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith404) || errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith410) {
+        return ms.requestRetry(msg)
+    }
+
+    if err != nil {
+        ms.Log.Errorf("Failed to download media from message %s: %v", msg.ID, err)
+        if dbErr := ms.DB.UpsertStoredMedia(chatJID, msg, msg.Media.FileSHA256, "", MediaStatusFailed); dbErr != nil {
+            return dbErr
+        }
+
+        return err
+    }
+
+    return ms.store(msg, data)
+}
+
+func (ms *RIVAClientMediaStore) HandleMediaRetry(evt *events.MediaRetry) error {
+    ms.pendingMutex.Lock()
+    msg, found := ms.pendingRetries[evt.MessageID]
+    delete(ms.pendingRetries, evt.MessageID)
+    ms.pendingMutex.Unlock()
+
+    if !found {
+        ms.Log.Debugf("Ignoring media retry for unknown message %s", evt.MessageID)
+        return nil
+    }
+
+    chatJID := msg.Chat
+    downloadable := msg.getDownloadable()
+
+    retryData, err := whatsmeow.DecryptMediaRetryNotification(evt, downloadable.GetMediaKey())
+    if err != nil || retryData.GetResult() != waMmsRetry.MediaRetryNotification_SUCCESS {
+        ms.Log.Errorf("Media retry for message %s was unsuccessful: %v (result: %s)", msg.ID, err, retryData.GetResult())
+        return ms.DB.UpsertStoredMedia(chatJID, msg, msg.Media.FileSHA256, "", MediaStatusFailed)
+    }
+
+    data, err := ms.RClient.WMClient.DownloadMediaWithPath(context.Background(),
+                                                           retryData.GetDirectPath(),
+                                                           downloadable.GetFileEncSHA256(),
+                                                           downloadable.GetFileSHA256(),
+                                                           downloadable.GetMediaKey(),
+                                                           int(msg.Media.FileLength),
+                                                           whatsmeow.GetMediaType(downloadable),
+                                                           "")
+    if err != nil {
+        ms.Log.Errorf("Failed to download retried media from message %s: %v", msg.ID, err)
+        if dbErr := ms.DB.UpsertStoredMedia(chatJID, msg, msg.Media.FileSHA256, "", MediaStatusFailed); dbErr != nil {
+            return dbErr
+        }
+
+        return err
+    }
+
+    return ms.store(msg, data)
+}
+
+func (ms *RIVAClientMediaStore) PurgeExpired() (int, error) {
+    paths, err := ms.DB.PurgeExpiredStoredMedia()
+    if err != nil {
+        return 0, err
+    }
+
+    removed := 0
+    for _, path := range paths {
+        if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+            ms.Log.Errorf("Failed to remove expired media file %s: %v", path, err)
+            continue
+        }
+
+        removed++
+    }
+
+    return removed, nil
+}
+
+func (ms *RIVAClientMediaStore) requestRetry(msg RIVAClientMessage) error {
+    ms.Log.Infof("Media from message %s has expired, requesting re-upload from sender", msg.ID)
+
+    if err := ms.RClient.WMClient.SendMediaRetryReceipt(&msg.RawMessage.Info, msg.getDownloadable().GetMediaKey()); err != nil {
+        ms.Log.Errorf("Failed to request media retry for message %s: %v", msg.ID, err)
+        return err
+    }
+
+    ms.pendingMutex.Lock()
+    ms.pendingRetries[msg.ID] = msg
+    ms.pendingMutex.Unlock()
+
+    return ms.DB.UpsertStoredMedia(msg.Chat, msg, msg.Media.FileSHA256, "", MediaStatusPendingRetry)
+}
+
+/*
+ * Files are stored by the SHA-256 of their decrypted content, sharded by the
+ * first two bytes of the hash:
+ *
+ *   <media dir>/ab/cd/abcd1234...
+ *
+ * so the same poster forwarded by many contacts is only stored once.
+ */
+func (ms *RIVAClientMediaStore) store(msg RIVAClientMessage, data []byte) error {
+    sum := sha256.Sum256(data)
+    hash := hex.EncodeToString(sum[:])
+    path := filepath.Join(ms.Dir, hash[0:2], hash[2:4], hash)
+
+    if _, err := os.Stat(path); os.IsNotExist(err) {
+        if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+            ms.Log.Errorf("Failed to create media directory for %s: %v", hash, err)
+            return err
+        }
+
+        tmpPath := path + ".tmp"
+        if err := os.WriteFile(tmpPath, data, 0o640); err != nil {
+            ms.Log.Errorf("Failed to write media file %s: %v", tmpPath, err)
+            return err
+        }
+
+        if err := os.Rename(tmpPath, path); err != nil {
+            ms.Log.Errorf("Failed to move media file into place %s: %v", path, err)
+            return err
+        }
+    }
+
+    if err := ms.DB.UpsertStoredMedia(msg.Chat, msg, hash, path, MediaStatusStored); err != nil {
+        return err
+    }
+
+    ms.Log.Infof("Stored %s from message %s as %s (%d bytes)", msg.Type, msg.ID, hash, len(data))
+
+    if msg.Type == TypeAudio && msg.Media.IsVoiceNote {
+        go ms.RClient.TranscribeVoiceNote(msg, path)
+    }
+
+    return nil
+}
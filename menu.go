@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+ * The greeting menu is a tree defined under "menu" in config.yaml. An item
+ * either answers with its reply or, if it has items of its own, opens a
+ * submenu. IDs must be unique across the whole tree as they are what list
+ * and button replies carry back.
+ */
+type RIVAMenuItem struct {
+    ID          string         `yaml:"id"`          // Unique ID, sent back by list and button replies
+    Title       string         `yaml:"title"`       // Text shown in the menu, max 24 characters for lists
+    Description string         `yaml:"description"` // Optional second line for list rows
+    Reply       string         `yaml:"reply"`       // Sent when the item is chosen
+    Form        string         `yaml:"form"`        // ID of a form started after the reply, if any
+    Handover    bool           `yaml:"handover"`    // Hand the chat over to a representative after the reply
+    Items       []RIVAMenuItem `yaml:"items"`       // Submenu opened when the item is chosen
+}
+
+type RIVAMenu struct {
+    Interactive    bool           `yaml:"interactive"`     // Also send the options as a list or button message
+    Title          string         `yaml:"title"`           // Heading of the main menu
+    Body           string         `yaml:"body"`            // Text shown above the options
+    Button         string         `yaml:"button"`          // Label of the button that opens a list message
+    Prompt         string         `yaml:"prompt"`          // Shown below a numbered list
+    Back           string         `yaml:"back"`            // Label of the "0" option in submenus
+    TimeoutMinutes float64        `yaml:"timeout_minutes"` // How long a contact can keep replying to a menu
+    Items          []RIVAMenuItem `yaml:"items"`           // Options of the main menu
+}
+
+// ID under which the main menu is stored in menu_sessions.
+const rBotMenuRootID = ""
+
+func (m RIVAMenu) IsEnabled() bool {
+    return len(m.Items) > 0
+}
+
+// Returns the item with the given ID anywhere in the tree.
+func (m RIVAMenu) Find(id string) (RIVAMenuItem, bool) {
+    var find func(items []RIVAMenuItem) (RIVAMenuItem, bool)
+    find = func(items []RIVAMenuItem) (RIVAMenuItem, bool) {
+        for _, item := range items {
+            if item.ID == id {
+                return item, true
+            }
+
+            if found, ok := find(item.Items); ok {
+                return found, true
+            }
+        }
+
+        return RIVAMenuItem{}, false
+    }
+
+    return find(m.Items)
+}
+
+// Returns the title and options of the menu with the given ID.
+func (m RIVAMenu) Level(id string) (string, []RIVAMenuItem, bool) {
+    if id == rBotMenuRootID {
+        return m.Title, m.Items, true
+    }
+
+    item, found := m.Find(id)
+    if !found || len(item.Items) == 0 {
+        return "", nil, false
+    }
+
+    return item.Title, item.Items, true
+}
+
+func (m RIVAMenu) numberedText(id string, title string, items []RIVAMenuItem) string {
+    var sb strings.Builder
+    if title != "" {
+        fmt.Fprintf(&sb, "*%s*\n", title)
+    }
+
+    if m.Body != "" && id == rBotMenuRootID {
+        fmt.Fprintf(&sb, "%s\n", m.Body)
+    }
+
+    sb.WriteString("\n")
+    for i, item := range items {
+        fmt.Fprintf(&sb, "%d. %s\n", i + 1, item.Title)
+    }
+
+    if id != rBotMenuRootID && m.Back != "" {
+        fmt.Fprintf(&sb, "0. %s\n", m.Back)
+    }
+
+    if m.Prompt != "" {
+        fmt.Fprintf(&sb, "\n_%s_", m.Prompt)
+    }
+
+    return strings.TrimRight(sb.String(), "\n")
+}
+
+/*
+ * The numbered text always goes out as a plain message, as many WhatsApp
+ * clients silently drop button and list messages from non-business accounts.
+ * With interactive on it is followed by the same options as buttons, up to
+ * three, or a list, for the clients that do show them.
+ */
+func (m RIVAMenu) BuildMessages(id string) ([]*waE2E.Message, bool) {
+    title, items, found := m.Level(id)
+    if !found {
+        return nil, false
+    }
+
+    messages := []*waE2E.Message{{Conversation: proto.String(m.numberedText(id, title, items))}}
+    if !m.Interactive {
+        return messages, true
+    }
+
+    text := title
+    if m.Body != "" && id == rBotMenuRootID {
+        text = m.Body
+    }
+
+    if len(items) <= 3 {
+        buttons := make([]*waE2E.ButtonsMessage_Button, 0, len(items))
+        for _, item := range items {
+            buttons = append(buttons, &waE2E.ButtonsMessage_Button{
+                ButtonID:   proto.String(item.ID),
+                ButtonText: &waE2E.ButtonsMessage_Button_ButtonText{DisplayText: proto.String(item.Title)},
+                Type:       waE2E.ButtonsMessage_Button_RESPONSE.Enum(),
+            })
+        }
+
+        return append(messages, &waE2E.Message{ButtonsMessage: &waE2E.ButtonsMessage{
+            ContentText: proto.String(text),
+            Buttons:     buttons,
+            HeaderType:  waE2E.ButtonsMessage_EMPTY.Enum(),
+        }}), true
+    }
+
+    rows := make([]*waE2E.ListMessage_Row, 0, len(items))
+    for _, item := range items {
+        rows = append(rows, &waE2E.ListMessage_Row{
+            RowID:       proto.String(item.ID),
+            Title:       proto.String(item.Title),
+            Description: proto.String(item.Description),
+        })
+    }
+
+    return append(messages, &waE2E.Message{ListMessage: &waE2E.ListMessage{
+        Title:       proto.String(title),
+        Description: proto.String(text),
+        ButtonText:  proto.String(m.Button),
+        ListType:    waE2E.ListMessage_SINGLE_SELECT.Enum(),
+        Sections:    []*waE2E.ListMessage_Section{{Title: proto.String(title), Rows: rows}},
+    }}), true
+}
+
+/*
+ * Resolves a contact's reply against the menu they were last shown. List and
+ * button replies carry the item ID; a bare number picks the option at that
+ * position, and 0 goes back to the main menu. ok is false if the message is
+ * not a menu choice at all.
+ */
+func (m RIVAMenu) Resolve(currentID string, msg RIVAClientMessage) (item RIVAMenuItem, back bool, ok bool) {
+    if msg.Reply != nil && msg.Reply.SelectedID != "" {
+        item, ok = m.Find(msg.Reply.SelectedID)
+        return item, false, ok
+    }
+
+    choice, err := strconv.Atoi(strings.TrimRight(strings.TrimSpace(msg.Content), "."))
+    if err != nil {
+        return RIVAMenuItem{}, false, false
+    }
+
+    if choice == 0 && currentID != rBotMenuRootID {
+        return RIVAMenuItem{}, true, true
+    }
+
+    _, items, found := m.Level(currentID)
+    if !found || choice < 1 || choice > len(items) {
+        return RIVAMenuItem{}, false, false
+    }
+
+    return items[choice - 1], false, true
+}
+
+func (rc *RIVAClient) SendMenu(recipientJID types.JID, id string) error {
+    payloads, found := rBotMenu.BuildMessages(id)
+    if !found {
+        return fmt.Errorf("unknown menu %q", id)
+    }
+
+    if _, err := rc.SendAutomatedMessage(recipientJID, payloads[0], SentMenu); err != nil {
+        rc.Log.Errorf("Failed to send menu %q to %s: %v", id, recipientJID, err)
+        return err
+    }
+
+    // The numbered text is enough to answer the menu, so a rejected
+    // interactive message is not fatal.
+    for _, payload := range payloads[1:] {
+        if _, err := rc.SendAutomatedMessage(recipientJID, payload, SentMenu); err != nil {
+            rc.Log.Warnf("Failed to send interactive menu %q to %s: %v", id, recipientJID, err)
+        }
+    }
+
+    return rc.DB.SetMenuSession(recipientJID, id, time.Now())
+}
+
+func (rc *RIVAClient) SendMenuReply(recipientJID types.JID, item RIVAMenuItem) error {
+    if item.Reply == "" {
+        return nil
+    }
+
+    payload := &waE2E.Message{Conversation: proto.String(item.Reply)}
+    if _, err := rc.SendAutomatedMessage(recipientJID, payload, SentMenu); err != nil {
+        rc.Log.Errorf("Failed to send menu reply %q to %s: %v", item.ID, recipientJID, err)
+        return err
+    }
+
+    return nil
+}
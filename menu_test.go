@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMenuBuildMessagesAlwaysSendsNumberedText(t *testing.T) {
+    menu := RIVAMenu{
+        Title:  "How can we help you today?",
+        Prompt: "Reply with the number of your choice.",
+        Button: "View options",
+        Items: []RIVAMenuItem{
+            {ID: "events", Title: "Upcoming events"},
+            {ID: "volunteer", Title: "Volunteer"},
+        },
+    }
+
+    plain, found := menu.BuildMessages(rBotMenuRootID)
+    if !found || len(plain) != 1 || !strings.Contains(plain[0].GetConversation(), "2. Volunteer") {
+        t.Fatalf("plain menu is %v, want only the numbered text", plain)
+    }
+
+    menu.Interactive = true
+    buttons, _ := menu.BuildMessages(rBotMenuRootID)
+    if len(buttons) != 2 || buttons[0].GetConversation() != plain[0].GetConversation() || len(buttons[1].GetButtonsMessage().GetButtons()) != 2 {
+        t.Errorf("button menu is %v, want the numbered text followed by buttons", buttons)
+    }
+
+    menu.Items = append(menu.Items, RIVAMenuItem{ID: "donate", Title: "Donate"}, RIVAMenuItem{ID: "human", Title: "Talk to a human"})
+    list, _ := menu.BuildMessages(rBotMenuRootID)
+    if len(list) != 2 || !strings.Contains(list[0].GetConversation(), "4. Talk to a human") || len(list[1].GetListMessage().GetSections()[0].GetRows()) != 4 {
+        t.Errorf("list menu is %v, want the numbered text followed by a list", list)
+    }
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"encoding/hex"
 	"fmt"
 	"strings"
 	"time"
 
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 )
@@ -24,93 +28,395 @@ const (
     TypeAudio       RIVAClientMessageType = "AUDIO"
     TypeSticker     RIVAClientMessageType = "STICKER"
     TypeDocument    RIVAClientMessageType = "DOCUMENT"
+    TypeLocation    RIVAClientMessageType = "LOCATION"
+    TypeLiveLoc     RIVAClientMessageType = "LIVE_LOCATION"
+    TypeContact     RIVAClientMessageType = "CONTACT"
+    TypePoll        RIVAClientMessageType = "POLL"
+    TypePollVote    RIVAClientMessageType = "POLL_VOTE"
+    TypeReaction    RIVAClientMessageType = "REACTION"
+    TypeButtonReply RIVAClientMessageType = "BUTTON_REPLY"
+    TypeListReply   RIVAClientMessageType = "LIST_REPLY"
+    TypeEdit        RIVAClientMessageType = "EDIT"
+    TypeRevoke      RIVAClientMessageType = "REVOKE"
     TypeUnsupported RIVAClientMessageType = "UNSUPPORTED"
 )
 
+type RIVAClientMedia struct {
+    Caption     string `json:"caption,omitempty"`       // Caption sent with the media, if any
+    MimeType    string `json:"mime_type,omitempty"`     // MIME type of the media file
+    FileName    string `json:"file_name,omitempty"`     // Original file name, documents only
+    FileLength  uint64 `json:"file_length,omitempty"`   // Size of the media file in bytes
+    FileSHA256  string `json:"file_sha256,omitempty"`   // Hex SHA-256 of the decrypted media file
+    Width       uint32 `json:"width,omitempty"`         // Width in pixels, images, videos and stickers only
+    Height      uint32 `json:"height,omitempty"`        // Height in pixels, images, videos and stickers only
+    Seconds     uint32 `json:"seconds,omitempty"`       // Duration in seconds, videos and audio only
+    IsVoiceNote bool   `json:"is_voice_note,omitempty"` // If the audio was recorded as a voice note
+}
+
+type RIVAClientLocation struct {
+    Latitude       float64 `json:"latitude"`                  // Degrees latitude
+    Longitude      float64 `json:"longitude"`                 // Degrees longitude
+    AccuracyMeters uint32  `json:"accuracy_meters,omitempty"` // Accuracy radius in metres, if known
+    Name           string  `json:"name,omitempty"`            // Name of the place, if shared as a place
+    Address        string  `json:"address,omitempty"`         // Address of the place, if shared as a place
+    URL            string  `json:"url,omitempty"`             // URL of the place, if shared as a place
+    Caption        string  `json:"caption,omitempty"`         // Caption of a live location
+    SequenceNumber int64   `json:"sequence_number,omitempty"` // Sequence number of a live location update
+}
+
+type RIVAClientContactCard struct {
+    DisplayName string `json:"display_name,omitempty"` // Name shown on the contact card
+    VCard       string `json:"vcard,omitempty"`        // Raw vCard of the contact
+}
+
+type RIVAClientPoll struct {
+    Name            string   `json:"name,omitempty"`             // Question asked by the poll
+    Options         []string `json:"options,omitempty"`          // Names of the poll options
+    SelectableCount uint32   `json:"selectable_count,omitempty"` // Number of options a voter may pick, 0 for any
+}
+
+type RIVAClientPollVote struct {
+    PollMessageID   string   `json:"poll_message_id,omitempty"`  // ID of the poll being voted on
+    SelectedOptions []string `json:"selected_options,omitempty"` // Hex SHA-256 hashes of the selected option names
+}
+
+type RIVAClientReaction struct {
+    TargetMessageID string `json:"target_message_id,omitempty"` // ID of the message being reacted to
+    Emoji           string `json:"emoji,omitempty"`             // Reaction emoji, empty if the reaction was removed
+}
+
+type RIVAClientInteractiveReply struct {
+    SelectedID   string `json:"selected_id,omitempty"`   // ID of the selected button or list row
+    SelectedText string `json:"selected_text,omitempty"` // Display text of the selected button or list row
+}
+
+type RIVAClientMessageContext struct {
+    QuotedMessageID string      `json:"quoted_message_id,omitempty"` // ID of the message being replied to
+    QuotedSender    types.JID   `json:"quoted_sender,omitempty"`     // Sender of the message being replied to
+    QuotedText      string      `json:"quoted_text,omitempty"`       // Text content of the message being replied to
+    IsForwarded     bool        `json:"is_forwarded,omitempty"`      // If the message was forwarded
+    ForwardingScore uint32      `json:"forwarding_score,omitempty"`  // Number of times the message has been forwarded
+    MentionedJIDs   []types.JID `json:"mentioned_jids,omitempty"`    // JIDs @-mentioned in the message
+}
+
+type RIVAClientMessageTarget struct {
+    MessageID string `json:"message_id,omitempty"` // ID of the message being edited or revoked
+}
+
 type RIVAClientMessage struct {
-    RClient    *RIVAClient
-    ID         string                     // Unique ID of the message
-    Type       RIVAClientMessageType      // Message type
-    From       types.JID                  // Sender's JID
-    FromPN     string                     // Sender's Phone Number or LID
-    FromNonAD  types.JID                  // Sender's JID without device part
-    To         types.JID                  // Recipient's JID
-    ToPN       string                     // Recipient's Phone Number or LID
-    ToNonAD    types.JID                  // Recipient's JID without device part
-    Direction  RIVAClientMessageDirection // Direction of message
-    IsGroup    bool                       // If message came from a group chat
-    Content    string                     // Text content of the message
-    Timestamp  time.Time                  // Timestamp of the message
-    RawMessage *events.Message            // Raw WhatsMeow message event
+    RClient     *RIVAClient
+    ID          string                      // Unique ID of the message
+    Type        RIVAClientMessageType       // Message type
+    From        types.JID                   // Sender's JID
+    FromPN      string                      // Sender's Phone Number, or LID if unresolved
+    FromNonAD   types.JID                   // Sender's canonical JID without device part
+    PushName    string                      // Display name the sender set for themselves, if sent
+    To          types.JID                   // Recipient's JID
+    ToPN        string                      // Recipient's Phone Number, or LID if unresolved
+    ToNonAD     types.JID                   // Recipient's canonical JID without device part
+    Chat        types.JID                   // Canonical JID of the chat the message belongs to
+    Direction   RIVAClientMessageDirection  // Direction of message
+    IsGroup     bool                        // If message came from a group chat
+    Content     string                      // Text content of the message
+    Timestamp   time.Time                   // Timestamp of the message
+    IsViewOnce  bool                        // If message was unwrapped from a view-once wrapper
+    IsEphemeral bool                        // If message was unwrapped from a disappearing message wrapper
+
+    Media       *RIVAClientMedia            // Set for image, video, audio, document and sticker types
+    Location    *RIVAClientLocation         // Set for TypeLocation and TypeLiveLoc
+    Contacts    []RIVAClientContactCard     // Set for TypeContact
+    Poll        *RIVAClientPoll             // Set for TypePoll
+    PollVote    *RIVAClientPollVote         // Set for TypePollVote
+    Reaction    *RIVAClientReaction         // Set for TypeReaction
+    Reply       *RIVAClientInteractiveReply // Set for TypeButtonReply and TypeListReply
+    Target      *RIVAClientMessageTarget    // Set for TypeEdit and TypeRevoke
+    Context     *RIVAClientMessageContext   // Set if the message quotes, forwards or mentions
+
+    RawMessage  *events.Message             // Raw WhatsMeow message event
 }
 
 func (*RIVAClientMessage) New(rClient *RIVAClient, evt *events.Message) RIVAClientMessage {
     var msgType RIVAClientMessageType
     var msgContent string
 
+    content, isViewOnce, isEphemeral := unwrapWithFlags(evt.Message)
+
+    msg := RIVAClientMessage{
+        RClient:     rClient,
+        ID:          evt.Info.ID,
+        From:        evt.Info.Sender,
+        PushName:    evt.Info.PushName,
+        To:          evt.Info.Chat,
+        IsGroup:     evt.Info.IsGroup,
+        Timestamp:   evt.Info.Timestamp,
+        IsViewOnce:  evt.IsViewOnce || isViewOnce,
+        IsEphemeral: evt.IsEphemeral || isEphemeral,
+        RawMessage:  evt,
+    }
+
     switch {
-    case evt.Message.GetConversation() != "":
+    case content.GetConversation() != "":
         msgType = TypeTextConv
-        msgContent = evt.Message.GetConversation()
-    case evt.Message.GetExtendedTextMessage() != nil:
+        msgContent = content.GetConversation()
+    case content.GetExtendedTextMessage() != nil:
         msgType = TypeTextExt
-        msgContent = evt.Message.GetExtendedTextMessage().GetText()
-    case evt.Message.GetImageMessage() != nil:
+        msgContent = content.GetExtendedTextMessage().GetText()
+    case content.GetImageMessage() != nil:
         msgType = TypeImage
-        imgMsg := evt.Message.GetImageMessage()
+        imgMsg := content.GetImageMessage()
+        msg.Media = &RIVAClientMedia{
+            Caption:    imgMsg.GetCaption(),
+            MimeType:   imgMsg.GetMimetype(),
+            FileLength: imgMsg.GetFileLength(),
+            FileSHA256: hex.EncodeToString(imgMsg.GetFileSHA256()),
+            Width:      imgMsg.GetWidth(),
+            Height:     imgMsg.GetHeight(),
+        }
 
         msgContent = imgMsg.GetCaption()
-        if msgContent != "" {
+        if msgContent == "" {
             msgContent = "[IMAGE]"
         }
-    case evt.Message.GetVideoMessage() != nil:
+    case content.GetVideoMessage() != nil || content.GetPtvMessage() != nil:
         msgType = TypeVideo
-        vidMsg := evt.Message.GetVideoMessage()
+        vidMsg := content.GetVideoMessage()
+        if vidMsg == nil {
+            vidMsg = content.GetPtvMessage()
+        }
+        msg.Media = &RIVAClientMedia{
+            Caption:    vidMsg.GetCaption(),
+            MimeType:   vidMsg.GetMimetype(),
+            FileLength: vidMsg.GetFileLength(),
+            FileSHA256: hex.EncodeToString(vidMsg.GetFileSHA256()),
+            Width:      vidMsg.GetWidth(),
+            Height:     vidMsg.GetHeight(),
+            Seconds:    vidMsg.GetSeconds(),
+        }
 
         msgContent = vidMsg.GetCaption()
-        if msgContent != "" {
+        if msgContent == "" {
             msgContent = "[VIDEO]"
         }
-    case evt.Message.GetAudioMessage() != nil:
+    case content.GetAudioMessage() != nil:
         msgType = TypeAudio
+        audMsg := content.GetAudioMessage()
+        msg.Media = &RIVAClientMedia{
+            MimeType:    audMsg.GetMimetype(),
+            FileLength:  audMsg.GetFileLength(),
+            FileSHA256:  hex.EncodeToString(audMsg.GetFileSHA256()),
+            Seconds:     audMsg.GetSeconds(),
+            IsVoiceNote: audMsg.GetPTT(),
+        }
+
+        // Voice notes are transcribed once downloaded, see TranscribeVoiceNote
         msgContent = "[AUDIO]"
-        // TODO: Use audio transformer models to transcribe audio
-    case evt.Message.GetDocumentMessage() != nil:
+    case content.GetDocumentMessage() != nil:
         msgType = TypeDocument
-        docMsg := evt.Message.GetDocumentMessage()
-        msgContent = fmt.Sprintf("[DOCUMENT] %s (%s)", docMsg.GetFileName(), docMsg.GetFileName())
-    case evt.Message.GetStickerMessage() != nil:
+        docMsg := content.GetDocumentMessage()
+        msg.Media = &RIVAClientMedia{
+            Caption:    docMsg.GetCaption(),
+            MimeType:   docMsg.GetMimetype(),
+            FileName:   docMsg.GetFileName(),
+            FileLength: docMsg.GetFileLength(),
+            FileSHA256: hex.EncodeToString(docMsg.GetFileSHA256()),
+        }
+
+        msgContent = docMsg.GetCaption()
+        if msgContent == "" {
+            msgContent = fmt.Sprintf("[DOCUMENT] %s (%s)", docMsg.GetFileName(), docMsg.GetMimetype())
+        }
+    case content.GetStickerMessage() != nil:
         msgType = TypeSticker
+        stkMsg := content.GetStickerMessage()
+        msg.Media = &RIVAClientMedia{
+            MimeType:   stkMsg.GetMimetype(),
+            FileLength: stkMsg.GetFileLength(),
+            FileSHA256: hex.EncodeToString(stkMsg.GetFileSHA256()),
+            Width:      stkMsg.GetWidth(),
+            Height:     stkMsg.GetHeight(),
+        }
+
         msgContent = "[STICKER]"
+    case content.GetLocationMessage() != nil:
+        locMsg := content.GetLocationMessage()
+        msgType = TypeLocation
+        if locMsg.GetIsLive() {
+            msgType = TypeLiveLoc
+        }
+
+        msg.Location = &RIVAClientLocation{
+            Latitude:       locMsg.GetDegreesLatitude(),
+            Longitude:      locMsg.GetDegreesLongitude(),
+            AccuracyMeters: locMsg.GetAccuracyInMeters(),
+            Name:           locMsg.GetName(),
+            Address:        locMsg.GetAddress(),
+            URL:            locMsg.GetURL(),
+            Caption:        locMsg.GetComment(),
+        }
+        msgContent = fmt.Sprintf("[LOCATION] %f,%f %s", msg.Location.Latitude, msg.Location.Longitude, msg.Location.Name)
+    case content.GetLiveLocationMessage() != nil:
+        liveMsg := content.GetLiveLocationMessage()
+        msgType = TypeLiveLoc
+        msg.Location = &RIVAClientLocation{
+            Latitude:       liveMsg.GetDegreesLatitude(),
+            Longitude:      liveMsg.GetDegreesLongitude(),
+            AccuracyMeters: liveMsg.GetAccuracyInMeters(),
+            Caption:        liveMsg.GetCaption(),
+            SequenceNumber: liveMsg.GetSequenceNumber(),
+        }
+        msgContent = fmt.Sprintf("[LIVE_LOCATION] %f,%f", msg.Location.Latitude, msg.Location.Longitude)
+    case content.GetContactMessage() != nil:
+        contactMsg := content.GetContactMessage()
+        msgType = TypeContact
+        msg.Contacts = []RIVAClientContactCard{{
+            DisplayName: contactMsg.GetDisplayName(),
+            VCard:       contactMsg.GetVcard(),
+        }}
+        msgContent = fmt.Sprintf("[CONTACT] %s", contactMsg.GetDisplayName())
+    case content.GetContactsArrayMessage() != nil:
+        msgType = TypeContact
+        names := make([]string, 0)
+        for _, contactMsg := range content.GetContactsArrayMessage().GetContacts() {
+            msg.Contacts = append(msg.Contacts, RIVAClientContactCard{
+                DisplayName: contactMsg.GetDisplayName(),
+                VCard:       contactMsg.GetVcard(),
+            })
+            names = append(names, contactMsg.GetDisplayName())
+        }
+        msgContent = fmt.Sprintf("[CONTACT] %s", strings.Join(names, ", "))
+    case msg.getPollCreation(content) != nil:
+        pollMsg := msg.getPollCreation(content)
+        msgType = TypePoll
+        msg.Poll = &RIVAClientPoll{
+            Name:            pollMsg.GetName(),
+            Options:         make([]string, 0),
+            SelectableCount: pollMsg.GetSelectableOptionsCount(),
+        }
+        for _, option := range pollMsg.GetOptions() {
+            msg.Poll.Options = append(msg.Poll.Options, option.GetOptionName())
+        }
+        msgContent = fmt.Sprintf("[POLL] %s (%s)", msg.Poll.Name, strings.Join(msg.Poll.Options, " / "))
+    case content.GetPollUpdateMessage() != nil:
+        msgType = TypePollVote
+        msg.PollVote = &RIVAClientPollVote{
+            PollMessageID:   content.GetPollUpdateMessage().GetPollCreationMessageKey().GetID(),
+            SelectedOptions: msg.decryptPollVote(evt),
+        }
+        msgContent = "[POLL_VOTE]"
+    case content.GetReactionMessage() != nil:
+        reactMsg := content.GetReactionMessage()
+        msgType = TypeReaction
+        msg.Reaction = &RIVAClientReaction{
+            TargetMessageID: reactMsg.GetKey().GetID(),
+            Emoji:           reactMsg.GetText(),
+        }
+        msgContent = fmt.Sprintf("[REACTION] %s", reactMsg.GetText())
+    case content.GetButtonsResponseMessage() != nil:
+        btnMsg := content.GetButtonsResponseMessage()
+        msgType = TypeButtonReply
+        msg.Reply = &RIVAClientInteractiveReply{
+            SelectedID:   btnMsg.GetSelectedButtonID(),
+            SelectedText: btnMsg.GetSelectedDisplayText(),
+        }
+        msgContent = btnMsg.GetSelectedDisplayText()
+    case content.GetTemplateButtonReplyMessage() != nil:
+        btnMsg := content.GetTemplateButtonReplyMessage()
+        msgType = TypeButtonReply
+        msg.Reply = &RIVAClientInteractiveReply{
+            SelectedID:   btnMsg.GetSelectedID(),
+            SelectedText: btnMsg.GetSelectedDisplayText(),
+        }
+        msgContent = btnMsg.GetSelectedDisplayText()
+    case content.GetListResponseMessage() != nil:
+        listMsg := content.GetListResponseMessage()
+        msgType = TypeListReply
+        msg.Reply = &RIVAClientInteractiveReply{
+            SelectedID:   listMsg.GetSingleSelectReply().GetSelectedRowID(),
+            SelectedText: listMsg.GetTitle(),
+        }
+        msgContent = listMsg.GetTitle()
+    case content.GetProtocolMessage() != nil && content.GetProtocolMessage().GetType() == waE2E.ProtocolMessage_MESSAGE_EDIT:
+        protoMsg := content.GetProtocolMessage()
+        msgType = TypeEdit
+        msg.Target = &RIVAClientMessageTarget{
+            MessageID: protoMsg.GetKey().GetID(),
+        }
+        msgContent = msg.getTextContent(protoMsg.GetEditedMessage())
+    case content.GetProtocolMessage() != nil && content.GetProtocolMessage().GetType() == waE2E.ProtocolMessage_REVOKE:
+        msgType = TypeRevoke
+        msg.Target = &RIVAClientMessageTarget{
+            MessageID: content.GetProtocolMessage().GetKey().GetID(),
+        }
+        msgContent = "[REVOKE]"
     default:
         msgType = TypeUnsupported
         msgContent = "[UNSUPPORTED]"
     }
 
-    msg := RIVAClientMessage{
-        RClient:    rClient,
-        ID:         evt.Info.ID,
-        Type:       msgType,
-        From:       evt.Info.Sender,
-        To:         evt.Info.Chat,
-        IsGroup:    evt.Info.IsGroup,
-        Content:    msgContent,
-        Timestamp:  evt.Info.Timestamp,
-        RawMessage: evt,
-    }
+    msg.Type = msgType
+    msg.Content = msgContent
+    msg.Context = msg.getMessageContext(content)
     msg.FromPN = msg.getPhoneNumberFromJID(msg.From)
-    msg.FromNonAD = msg.From.ToNonAD()
+    msg.FromNonAD = msg.getCanonicalJID(msg.From, evt.Info.SenderAlt)
     msg.ToPN = msg.getPhoneNumberFromJID(msg.To)
-    msg.ToNonAD = msg.To.ToNonAD()
+    msg.ToNonAD = msg.getCanonicalJID(msg.To, evt.Info.RecipientAlt)
+    msg.Chat = msg.getChatJID()
     msg.Direction = msg.getMessageDirection()
 
-    if msg.Direction == DirectionIncoming && rClient.WMClient.Store.ID != nil {
+    if msg.Direction == DirectionIncoming && rClient != nil && rClient.WMClient.Store.ID != nil {
         msg.To = rClient.WMClient.Store.GetJID()
     }
 
     return msg
 }
 
+// Reactions, poll votes, edits and revokes refer to an earlier message rather
+// than starting a new exchange with the contact.
+func (msg *RIVAClientMessage) IsReferential() bool {
+    switch msg.Type {
+    case TypeReaction, TypePollVote, TypeEdit, TypeRevoke:
+        return true
+    }
+
+    return false
+}
+
+/*
+ * WhatsApp labels a message "Forwarded many times" once it has been forwarded
+ * 5 or more times, which is how chain messages usually arrive.
+ */
+func (msg *RIVAClientMessage) IsForwardedChain() bool {
+    return msg.Context != nil && msg.Context.ForwardingScore >= 5
+}
+
+func (msg *RIVAClientMessage) IsReplyTo(messageID string) bool {
+    return msg.Context != nil && msg.Context.QuotedMessageID == messageID
+}
+
+func (msg *RIVAClientMessage) IsMentioned(jid types.JID) bool {
+    if msg.Context == nil {
+        return false
+    }
+
+    for _, mentioned := range msg.Context.MentionedJIDs {
+        if mentioned.User == jid.User && mentioned.Server == jid.Server {
+            return true
+        }
+    }
+
+    return false
+}
+
+// Mentions in groups may use either our phone number or our LID.
+func (msg *RIVAClientMessage) MentionsMe() bool {
+    if msg.RClient == nil || msg.RClient.WMClient.Store == nil || msg.RClient.WMClient.Store.ID == nil {
+        return false
+    }
+
+    store := msg.RClient.WMClient.Store
+    return msg.IsMentioned(store.ID.ToNonAD()) || (!store.LID.IsEmpty() && msg.IsMentioned(store.LID.ToNonAD()))
+}
+
 func (msg *RIVAClientMessage) IsNewsletter() bool {
     if msg.From.Server == types.NewsletterServer {
         return true
@@ -124,7 +430,7 @@ func (msg *RIVAClientMessage) IsSentByMe() bool {
         return false
     }
 
-    return msg.getPhoneNumberFromJID(msg.From) == msg.RClient.WMClient.Store.ID.User
+    return msg.RClient.Resolver.IsOwnJID(msg.From)
 }
 
 func (msg *RIVAClientMessage) HasOrgPrefix() bool {
@@ -141,12 +447,223 @@ func (msg *RIVAClientMessage) getMessageDirection() RIVAClientMessageDirection {
     return DirectionIncoming
 }
 
+func (msg *RIVAClientMessage) getCanonicalJID(jid types.JID, alt types.JID) types.JID {
+    if msg.RClient == nil {
+        return jid.ToNonAD()
+    }
+
+    return msg.RClient.Resolver.CanonicalWithAlt(jid, alt)
+}
+
+/*
+ * In private chats the chat JID is the other party, so it may be a LID just
+ * like the sender. Incoming messages carry the alternative address of the
+ * sender, outgoing ones that of the recipient.
+ */
+func (msg *RIVAClientMessage) getChatJID() types.JID {
+    info := msg.RawMessage.Info
+    if info.IsGroup {
+        return info.Chat
+    }
+
+    if info.IsFromMe {
+        return msg.getCanonicalJID(info.Chat, info.RecipientAlt)
+    }
+
+    return msg.getCanonicalJID(info.Chat, info.SenderAlt)
+}
+
 func (msg *RIVAClientMessage) getPhoneNumberFromJID(jid types.JID) string {
     if jid.User == "" {
         return ""
     }
 
+    if jid.Server == types.HiddenUserServer && msg.RClient != nil {
+        jid = msg.RClient.Resolver.Canonical(jid)
+    }
+
     parts := strings.Split(jid.User, ":")
     return parts[0]
 }
 
+
+/*
+ * WhatsMeow already unwraps the common wrappers (device sent, ephemeral,
+ * view-once, document with caption and edited), but only in a fixed order and
+ * only once. Wrappers can be nested in other orders and newer FutureProof
+ * wrappers are not unwrapped at all, so keep peeling until we reach the
+ * actual content. Also reports whether a view-once or disappearing message
+ * wrapper was peeled off on the way.
+ */
+func unwrapWithFlags(content *waE2E.Message) (*waE2E.Message, bool, bool) {
+    var isViewOnce, isEphemeral bool
+
+    for content != nil {
+        var wrapper *waE2E.FutureProofMessage
+
+        switch {
+        case content.GetEphemeralMessage().GetMessage() != nil:
+            wrapper = content.GetEphemeralMessage()
+            isEphemeral = true
+        case content.GetViewOnceMessage().GetMessage() != nil:
+            wrapper = content.GetViewOnceMessage()
+            isViewOnce = true
+        case content.GetViewOnceMessageV2().GetMessage() != nil:
+            wrapper = content.GetViewOnceMessageV2()
+            isViewOnce = true
+        case content.GetViewOnceMessageV2Extension().GetMessage() != nil:
+            wrapper = content.GetViewOnceMessageV2Extension()
+            isViewOnce = true
+        case content.GetDocumentWithCaptionMessage().GetMessage() != nil:
+            wrapper = content.GetDocumentWithCaptionMessage()
+        case content.GetEditedMessage().GetMessage() != nil:
+            wrapper = content.GetEditedMessage()
+        case content.GetGroupMentionedMessage().GetMessage() != nil:
+            wrapper = content.GetGroupMentionedMessage()
+        case content.GetBotInvokeMessage().GetMessage() != nil:
+            wrapper = content.GetBotInvokeMessage()
+        case content.GetLottieStickerMessage().GetMessage() != nil:
+            wrapper = content.GetLottieStickerMessage()
+        default:
+            return content, isViewOnce, isEphemeral
+        }
+
+        content = wrapper.GetMessage()
+    }
+
+    return content, isViewOnce, isEphemeral
+}
+
+// Peels the wrappers off quoted, edited or re-read content without touching
+// the flags of the message it belongs to.
+func unwrap(content *waE2E.Message) *waE2E.Message {
+    content, _, _ = unwrapWithFlags(content)
+    return content
+}
+
+func (msg *RIVAClientMessage) getDownloadable() whatsmeow.DownloadableMessage {
+    content := unwrap(msg.RawMessage.Message)
+
+    switch {
+    case content.GetImageMessage() != nil:
+        return content.GetImageMessage()
+    case content.GetVideoMessage() != nil:
+        return content.GetVideoMessage()
+    case content.GetPtvMessage() != nil:
+        return content.GetPtvMessage()
+    case content.GetAudioMessage() != nil:
+        return content.GetAudioMessage()
+    case content.GetDocumentMessage() != nil:
+        return content.GetDocumentMessage()
+    case content.GetStickerMessage() != nil:
+        return content.GetStickerMessage()
+    }
+
+    return nil
+}
+
+func (msg *RIVAClientMessage) getMessageContext(content *waE2E.Message) *RIVAClientMessageContext {
+    type contextual interface {
+        GetContextInfo() *waE2E.ContextInfo
+    }
+
+    var ctxInfo *waE2E.ContextInfo
+    for _, candidate := range []contextual{
+        content.GetExtendedTextMessage(),
+        content.GetImageMessage(),
+        content.GetVideoMessage(),
+        content.GetPtvMessage(),
+        content.GetAudioMessage(),
+        content.GetDocumentMessage(),
+        content.GetStickerMessage(),
+        content.GetLocationMessage(),
+        content.GetLiveLocationMessage(),
+        content.GetContactMessage(),
+        content.GetContactsArrayMessage(),
+        msg.getPollCreation(content),
+        content.GetButtonsResponseMessage(),
+        content.GetTemplateButtonReplyMessage(),
+        content.GetListResponseMessage(),
+    } {
+        if ctxInfo = candidate.GetContextInfo(); ctxInfo != nil {
+            break
+        }
+    }
+
+    if ctxInfo == nil {
+        return nil
+    }
+
+    msgCtx := &RIVAClientMessageContext{
+        QuotedMessageID: ctxInfo.GetStanzaID(),
+        QuotedText:      msg.getTextContent(ctxInfo.GetQuotedMessage()),
+        IsForwarded:     ctxInfo.GetIsForwarded(),
+        ForwardingScore: ctxInfo.GetForwardingScore(),
+        MentionedJIDs:   make([]types.JID, 0),
+    }
+
+    if participant, err := types.ParseJID(ctxInfo.GetParticipant()); err == nil {
+        msgCtx.QuotedSender = participant
+    }
+
+    for _, mentioned := range ctxInfo.GetMentionedJID() {
+        if jid, err := types.ParseJID(mentioned); err == nil {
+            msgCtx.MentionedJIDs = append(msgCtx.MentionedJIDs, jid)
+        }
+    }
+
+    return msgCtx
+}
+
+func (msg *RIVAClientMessage) getPollCreation(content *waE2E.Message) *waE2E.PollCreationMessage {
+    switch {
+    case content.GetPollCreationMessage() != nil:
+        return content.GetPollCreationMessage()
+    case content.GetPollCreationMessageV2() != nil:
+        return content.GetPollCreationMessageV2()
+    case content.GetPollCreationMessageV3() != nil:
+        return content.GetPollCreationMessageV3()
+    }
+
+    return nil
+}
+
+// Poll votes are encrypted with the poll's secret, which WhatsMeow only knows
+// for polls it has seen. Undecryptable votes are kept with no selections.
+func (msg *RIVAClientMessage) decryptPollVote(evt *events.Message) []string {
+    selected := make([]string, 0)
+    if msg.RClient == nil || msg.RClient.WMClient == nil {
+        return selected
+    }
+
+    vote, err := msg.RClient.WMClient.DecryptPollVote(context.Background(), evt)
+    if err != nil {
+        msg.RClient.Log.Warnf("Failed to decrypt poll vote %s: %v", evt.Info.ID, err)
+        return selected
+    }
+
+    for _, hash := range vote.GetSelectedOptions() {
+        selected = append(selected, hex.EncodeToString(hash))
+    }
+
+    return selected
+}
+
+func (msg *RIVAClientMessage) getTextContent(content *waE2E.Message) string {
+    content = unwrap(content)
+
+    switch {
+    case content.GetConversation() != "":
+        return content.GetConversation()
+    case content.GetExtendedTextMessage() != nil:
+        return content.GetExtendedTextMessage().GetText()
+    case content.GetImageMessage() != nil:
+        return content.GetImageMessage().GetCaption()
+    case content.GetVideoMessage() != nil:
+        return content.GetVideoMessage().GetCaption()
+    case content.GetDocumentMessage() != nil:
+        return content.GetDocumentMessage().GetCaption()
+    }
+
+    return ""
+}
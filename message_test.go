@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var (
+    testSender    = types.NewJID("15551234567", types.DefaultUserServer)
+    testTimestamp = time.Date(2025, 6, 1, 9, 30, 0, 0, time.UTC)
+    testSHA256    = []byte{0xde, 0xad, 0xbe, 0xef}
+)
+
+func testMessageEvent(id string, content *waE2E.Message) *events.Message {
+    return &events.Message{
+        Info: types.MessageInfo{
+            MessageSource: types.MessageSource{
+                Chat:   testSender,
+                Sender: testSender,
+            },
+            ID:        id,
+            PushName:  "Test Contact",
+            Timestamp: testTimestamp,
+        },
+        Message: content,
+    }
+}
+
+// Compares got with testdata/<name>, rewriting the file instead with -update.
+func assertGolden(t *testing.T, name string, got []byte) {
+    t.Helper()
+
+    path := filepath.Join("testdata", name)
+    if *updateGolden {
+        if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+            t.Fatal(err)
+        }
+
+        if err := os.WriteFile(path, got, 0o644); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    want, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatalf("%v (run go test -update to create it)", err)
+    }
+
+    if !bytes.Equal(got, want) {
+        t.Errorf("%s does not match:\n got: %s\nwant: %s", path, got, want)
+    }
+}
+
+func TestRIVAClientMessageNewGolden(t *testing.T) {
+    quote := &waE2E.ContextInfo{
+        StanzaID:        proto.String("3EB0QUOTED"),
+        Participant:     proto.String("15557654321@s.whatsapp.net"),
+        QuotedMessage:   &waE2E.Message{Conversation: proto.String("What are your opening hours?")},
+        MentionedJID:    []string{"15557654321@s.whatsapp.net"},
+        IsForwarded:     proto.Bool(true),
+        ForwardingScore: proto.Uint32(5),
+    }
+
+    image := &waE2E.ImageMessage{
+        Mimetype:   proto.String("image/jpeg"),
+        FileLength: proto.Uint64(48213),
+        FileSHA256: testSHA256,
+        Width:      proto.Uint32(1280),
+        Height:     proto.Uint32(720),
+    }
+
+    fixtures := []struct {
+        name    string
+        content *waE2E.Message
+    }{
+        {"text_conversation", &waE2E.Message{
+            Conversation: proto.String("Hello, is anyone there?"),
+        }},
+        {"text_extended_quote", &waE2E.Message{
+            ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+                Text:        proto.String("@15557654321 see below"),
+                ContextInfo: quote,
+            },
+        }},
+        {"image_caption", &waE2E.Message{
+            ImageMessage: &waE2E.ImageMessage{
+                Caption:    proto.String("Flyer for Saturday"),
+                Mimetype:   image.Mimetype,
+                FileLength: image.FileLength,
+                FileSHA256: image.FileSHA256,
+                Width:      image.Width,
+                Height:     image.Height,
+            },
+        }},
+        {"image_no_caption", &waE2E.Message{ImageMessage: image}},
+        {"video_caption", &waE2E.Message{
+            VideoMessage: &waE2E.VideoMessage{
+                Caption:    proto.String("Walkthrough of the venue"),
+                Mimetype:   proto.String("video/mp4"),
+                FileLength: proto.Uint64(1048576),
+                FileSHA256: testSHA256,
+                Width:      proto.Uint32(720),
+                Height:     proto.Uint32(1280),
+                Seconds:    proto.Uint32(42),
+            },
+        }},
+        {"video_no_caption", &waE2E.Message{
+            VideoMessage: &waE2E.VideoMessage{
+                Mimetype:   proto.String("video/mp4"),
+                FileLength: proto.Uint64(1048576),
+                FileSHA256: testSHA256,
+                Width:      proto.Uint32(720),
+                Height:     proto.Uint32(1280),
+                Seconds:    proto.Uint32(42),
+            },
+        }},
+        {"video_note", &waE2E.Message{
+            PtvMessage: &waE2E.VideoMessage{
+                Mimetype: proto.String("video/mp4"),
+                Seconds:  proto.Uint32(9),
+            },
+        }},
+        {"document", &waE2E.Message{
+            DocumentMessage: &waE2E.DocumentMessage{
+                FileName:   proto.String("minutes.pdf"),
+                Mimetype:   proto.String("application/pdf"),
+                FileLength: proto.Uint64(20480),
+                FileSHA256: testSHA256,
+            },
+        }},
+        {"document_caption", &waE2E.Message{
+            DocumentWithCaptionMessage: &waE2E.FutureProofMessage{
+                Message: &waE2E.Message{
+                    DocumentMessage: &waE2E.DocumentMessage{
+                        Caption:    proto.String("Signed form attached"),
+                        FileName:   proto.String("form.pdf"),
+                        Mimetype:   proto.String("application/pdf"),
+                        FileLength: proto.Uint64(20480),
+                        FileSHA256: testSHA256,
+                    },
+                },
+            },
+        }},
+        {"audio", &waE2E.Message{
+            AudioMessage: &waE2E.AudioMessage{
+                Mimetype:   proto.String("audio/mpeg"),
+                FileLength: proto.Uint64(300000),
+                FileSHA256: testSHA256,
+                Seconds:    proto.Uint32(180),
+            },
+        }},
+        {"audio_voice_note", &waE2E.Message{
+            AudioMessage: &waE2E.AudioMessage{
+                Mimetype:   proto.String("audio/ogg; codecs=opus"),
+                FileLength: proto.Uint64(12000),
+                FileSHA256: testSHA256,
+                Seconds:    proto.Uint32(7),
+                PTT:        proto.Bool(true),
+            },
+        }},
+        {"sticker", &waE2E.Message{
+            StickerMessage: &waE2E.StickerMessage{
+                Mimetype:   proto.String("image/webp"),
+                FileLength: proto.Uint64(9000),
+                FileSHA256: testSHA256,
+                Width:      proto.Uint32(512),
+                Height:     proto.Uint32(512),
+            },
+        }},
+        {"location", &waE2E.Message{
+            LocationMessage: &waE2E.LocationMessage{
+                DegreesLatitude:  proto.Float64(51.5072),
+                DegreesLongitude: proto.Float64(-0.1276),
+                Name:             proto.String("Community Hall"),
+                Address:          proto.String("1 High Street"),
+            },
+        }},
+        {"live_location", &waE2E.Message{
+            LiveLocationMessage: &waE2E.LiveLocationMessage{
+                DegreesLatitude:  proto.Float64(51.5072),
+                DegreesLongitude: proto.Float64(-0.1276),
+                AccuracyInMeters: proto.Uint32(15),
+                Caption:          proto.String("On my way"),
+                SequenceNumber:   proto.Int64(3),
+            },
+        }},
+        {"contact", &waE2E.Message{
+            ContactMessage: &waE2E.ContactMessage{
+                DisplayName: proto.String("Jo Bloggs"),
+                Vcard:       proto.String("BEGIN:VCARD\nVERSION:3.0\nFN:Jo Bloggs\nEND:VCARD"),
+            },
+        }},
+        {"contacts_array", &waE2E.Message{
+            ContactsArrayMessage: &waE2E.ContactsArrayMessage{
+                Contacts: []*waE2E.ContactMessage{
+                    {DisplayName: proto.String("Jo Bloggs")},
+                    {DisplayName: proto.String("Sam Smith")},
+                },
+            },
+        }},
+        {"poll", &waE2E.Message{
+            PollCreationMessageV3: &waE2E.PollCreationMessage{
+                Name: proto.String("Which day suits you?"),
+                Options: []*waE2E.PollCreationMessage_Option{
+                    {OptionName: proto.String("Saturday")},
+                    {OptionName: proto.String("Sunday")},
+                },
+                SelectableOptionsCount: proto.Uint32(1),
+            },
+        }},
+        {"poll_vote", &waE2E.Message{
+            PollUpdateMessage: &waE2E.PollUpdateMessage{
+                PollCreationMessageKey: &waCommon.MessageKey{ID: proto.String("3EB0POLL")},
+            },
+        }},
+        {"reaction", &waE2E.Message{
+            ReactionMessage: &waE2E.ReactionMessage{
+                Key:  &waCommon.MessageKey{ID: proto.String("3EB0TARGET")},
+                Text: proto.String("👍"),
+            },
+        }},
+        {"button_reply", &waE2E.Message{
+            ButtonsResponseMessage: &waE2E.ButtonsResponseMessage{
+                SelectedButtonID: proto.String("opt-1"),
+                Response:         &waE2E.ButtonsResponseMessage_SelectedDisplayText{SelectedDisplayText: "Opening hours"},
+            },
+        }},
+        {"template_button_reply", &waE2E.Message{
+            TemplateButtonReplyMessage: &waE2E.TemplateButtonReplyMessage{
+                SelectedID:          proto.String("opt-2"),
+                SelectedDisplayText: proto.String("Volunteer"),
+            },
+        }},
+        {"list_reply", &waE2E.Message{
+            ListResponseMessage: &waE2E.ListResponseMessage{
+                Title:             proto.String("Donate"),
+                SingleSelectReply: &waE2E.ListResponseMessage_SingleSelectReply{SelectedRowID: proto.String("row-3")},
+            },
+        }},
+        {"edit", &waE2E.Message{
+            ProtocolMessage: &waE2E.ProtocolMessage{
+                Type:          waE2E.ProtocolMessage_MESSAGE_EDIT.Enum(),
+                Key:           &waCommon.MessageKey{ID: proto.String("3EB0ORIGINAL")},
+                EditedMessage: &waE2E.Message{Conversation: proto.String("Corrected text")},
+            },
+        }},
+        {"revoke", &waE2E.Message{
+            ProtocolMessage: &waE2E.ProtocolMessage{
+                Type: waE2E.ProtocolMessage_REVOKE.Enum(),
+                Key:  &waCommon.MessageKey{ID: proto.String("3EB0ORIGINAL")},
+            },
+        }},
+        {"view_once_image", &waE2E.Message{
+            ViewOnceMessageV2: &waE2E.FutureProofMessage{
+                Message: &waE2E.Message{ImageMessage: image},
+            },
+        }},
+        {"ephemeral_view_once_image", &waE2E.Message{
+            EphemeralMessage: &waE2E.FutureProofMessage{
+                Message: &waE2E.Message{
+                    ViewOnceMessage: &waE2E.FutureProofMessage{
+                        Message: &waE2E.Message{ImageMessage: image},
+                    },
+                },
+            },
+        }},
+        {"unsupported", &waE2E.Message{
+            CallLogMesssage: &waE2E.CallLogMessage{},
+        }},
+    }
+
+    for _, fixture := range fixtures {
+        t.Run(fixture.name, func(t *testing.T) {
+            msg := (*RIVAClientMessage).New(nil, nil, testMessageEvent("3EB0"+fixture.name, fixture.content))
+
+            got, err := json.MarshalIndent(msg, "", "  ")
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            assertGolden(t, filepath.Join("messages", fixture.name+".json"), append(got, '\n'))
+        })
+    }
+}
+
+func TestRIVAClientMessageNewQuotedWrappersDoNotLeak(t *testing.T) {
+    content := &waE2E.Message{
+        ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+            Text: proto.String("Can you send it again?"),
+            ContextInfo: &waE2E.ContextInfo{
+                StanzaID: proto.String("3EB0QUOTED"),
+                QuotedMessage: &waE2E.Message{
+                    EphemeralMessage: &waE2E.FutureProofMessage{
+                        Message: &waE2E.Message{
+                            ViewOnceMessageV2: &waE2E.FutureProofMessage{
+                                Message: &waE2E.Message{
+                                    ImageMessage: &waE2E.ImageMessage{Caption: proto.String("Ticket")},
+                                },
+                            },
+                        },
+                    },
+                },
+            },
+        },
+    }
+
+    msg := (*RIVAClientMessage).New(nil, nil, testMessageEvent("3EB0QUOTEWRAPPED", content))
+    if msg.IsViewOnce || msg.IsEphemeral {
+        t.Errorf("quoted wrappers marked the reply view-once=%t ephemeral=%t", msg.IsViewOnce, msg.IsEphemeral)
+    }
+
+    if msg.Context == nil || msg.Context.QuotedText != "Ticket" {
+        t.Errorf("quoted text is not the unwrapped caption: %+v", msg.Context)
+    }
+
+    msg.getDownloadable()
+    msg.getTextContent(content.GetExtendedTextMessage().GetContextInfo().GetQuotedMessage())
+    if msg.IsViewOnce || msg.IsEphemeral {
+        t.Errorf("unwrapping again marked the reply view-once=%t ephemeral=%t", msg.IsViewOnce, msg.IsEphemeral)
+    }
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+type RIVASentKind string
+const (
+    SentGreeting   RIVASentKind = "GREETING"
+    SentEdit       RIVASentKind = "EDIT"
+    SentDisclosure RIVASentKind = "DISCLOSURE"
+    SentConsent    RIVASentKind = "CONSENT"
+    SentScheduled  RIVASentKind = "SCHEDULED"
+    SentCampaign   RIVASentKind = "CAMPAIGN"
+    SentMenu       RIVASentKind = "MENU"
+    SentForm       RIVASentKind = "FORM"
+    SentStaff      RIVASentKind = "STAFF"
+    SentRelay      RIVASentKind = "RELAY"
+    SentControl    RIVASentKind = "CONTROL"
+    SentHandover   RIVASentKind = "HANDOVER"
+    SentAway       RIVASentKind = "AWAY"
+    SentFlood      RIVASentKind = "FLOOD"
+    SentManual     RIVASentKind = "MANUAL"
+)
+
+// Ordered from least to most progressed; a message never moves backwards.
+type RIVAReceiptStatus string
+const (
+    ReceiptSent      RIVAReceiptStatus = "SENT"
+    ReceiptDelivered RIVAReceiptStatus = "DELIVERED"
+    ReceiptRead      RIVAReceiptStatus = "READ"
+    ReceiptPlayed    RIVAReceiptStatus = "PLAYED"
+)
+
+var rBotReceiptOrder = []RIVAReceiptStatus{ReceiptSent, ReceiptDelivered, ReceiptRead, ReceiptPlayed}
+
+/*
+ * In group chats every participant sends their own receipts. The status and
+ * timestamps record the first participant to reach each state, which is
+ * enough to tell whether anyone has seen the message.
+ */
+type RIVASentMessage struct {
+    ChatJID     types.JID         `json:"chat_jid"`               // Chat the message was sent to
+    MessageID   string            `json:"message_id"`             // ID of the sent message
+    Kind        RIVASentKind      `json:"kind"`                   // Why the message was sent
+    Status      RIVAReceiptStatus `json:"status"`                 // Most progressed receipt so far
+    SentAt      time.Time         `json:"sent_at"`                // When the message was sent
+    DeliveredAt time.Time         `json:"delivered_at,omitzero"`  // First delivery receipt, if any
+    ReadAt      time.Time         `json:"read_at,omitzero"`       // First read receipt, if any
+    PlayedAt    time.Time         `json:"played_at,omitzero"`     // First played receipt, voice notes only
+}
+
+type RIVAChatReceiptSummary struct {
+    ChatJID  types.JID                 `json:"chat_jid"`           // Chat the summary is for
+    Counts   map[RIVAReceiptStatus]int `json:"counts"`             // Sent messages by receipt status
+    LastSent *RIVASentMessage          `json:"last_sent,omitempty"` // Latest message we sent, if any
+}
+
+// Returns true if the latest message we sent to the chat has been read.
+func (s RIVAChatReceiptSummary) HasSeenLastReply() bool {
+    return s.LastSent != nil && (s.LastSent.Status == ReceiptRead || s.LastSent.Status == ReceiptPlayed)
+}
+
+func receiptStatusFor(receiptType types.ReceiptType) (RIVAReceiptStatus, bool) {
+    switch receiptType {
+    case types.ReceiptTypeDelivered:
+        return ReceiptDelivered, true
+    case types.ReceiptTypeRead:
+        return ReceiptRead, true
+    case types.ReceiptTypePlayed:
+        return ReceiptPlayed, true
+    }
+
+    return "", false
+}
+
+// Sends a message and records it so that its receipts can be tracked.
+func (rc *RIVAClient) SendTrackedMessage(to types.JID, message *waE2E.Message, kind RIVASentKind) (whatsmeow.SendResponse, error) {
+    resp, err := rc.WMClient.SendMessage(context.Background(), to, message)
+    if err != nil {
+        return resp, err
+    }
+
+    rc.DB.RecordSentMessage(rc.Resolver.Canonical(to), resp.ID, kind, resp.Timestamp)
+    return resp, nil
+}
+
+// Receipts from our own other devices (read-self, played-self) are ignored, as
+// they only mean a representative opened the chat.
+func (rc *RIVAClient) ApplyReceipt(evt *events.Receipt) {
+    if evt.IsFromMe {
+        return
+    }
+
+    status, tracked := receiptStatusFor(evt.Type)
+    if !tracked {
+        return
+    }
+
+    if err := rc.DB.ApplySentMessageReceipt(evt.MessageIDs, status, evt.Timestamp); err != nil {
+        return
+    }
+
+    switch status {
+    case ReceiptDelivered:
+        rc.DB.ApplyCampaignReceipt(evt.MessageIDs, RecipientDelivered)
+    case ReceiptRead, ReceiptPlayed:
+        rc.DB.ApplyCampaignReceipt(evt.MessageIDs, RecipientRead)
+    }
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+type RIVAScheduledStatus string
+const (
+    ScheduledPending   RIVAScheduledStatus = "PENDING"
+    ScheduledSent      RIVAScheduledStatus = "SENT"
+    ScheduledFailed    RIVAScheduledStatus = "FAILED"
+    ScheduledMissed    RIVAScheduledStatus = "MISSED"
+    ScheduledCancelled RIVAScheduledStatus = "CANCELLED"
+)
+
+const (
+    RecurrenceNone   = ""
+    RecurrenceDaily  = "daily"
+    RecurrenceWeekly = "weekly"
+    RecurrenceCron   = "cron:"
+)
+
+type RIVAScheduledMessage struct {
+    ID           int64               `json:"id"`                   // Unique ID of the scheduled message
+    RecipientJID types.JID           `json:"recipient_jid"`        // Contact or group to send to
+    Content      string              `json:"content"`              // Text, or caption if MediaPath is set
+    MediaPath    string              `json:"media_path,omitempty"` // Local file to send as media, if any
+    SendAt       time.Time           `json:"send_at"`              // Next time the message is due
+    Recurrence   string              `json:"recurrence,omitempty"` // "", "daily", "weekly" or "cron:<expr>"
+    Status       RIVAScheduledStatus `json:"status"`               // Current status
+    CreatedBy    string              `json:"created_by"`           // Who created it: cli, api or a JID
+    CreatedAt    time.Time           `json:"created_at"`           // When it was created
+    LastSentAt   time.Time           `json:"last_sent_at"`         // When it was last sent, zero if never
+    LastError    string              `json:"last_error,omitempty"` // Error from the last attempt, if any
+}
+
+type RIVAClientScheduler struct {
+    RClient  *RIVAClient
+    DB       *RIVAClientDB
+    Log      *RIVAClientLog
+    Interval time.Duration
+}
+
+func (*RIVAClientScheduler) New(rClient *RIVAClient, db *RIVAClientDB) *RIVAClientScheduler {
+    return &RIVAClientScheduler{
+        RClient:  rClient,
+        DB:       db,
+        Log:      NewRIVAClientLog("RIVABotScheduler", "INFO"),
+        Interval: 30 * time.Second,
+    }
+}
+
+func ScheduleLocation() *time.Location {
+    loc, err := time.LoadLocation(rBotTimezone)
+    if err != nil {
+        return time.Local
+    }
+
+    return loc
+}
+
+/*
+ * Accepts the formats operators actually type:
+ *
+ *   +30m, +2h, +1d          relative to now
+ *   18:30                   next occurrence of that time of day
+ *   2025-06-01 18:30        absolute, in the configured timezone
+ *   2025-06-01T18:30:00Z    RFC 3339
+ */
+func ParseScheduleTime(value string, now time.Time) (time.Time, error) {
+    value = strings.TrimSpace(value)
+    loc := ScheduleLocation()
+    now = now.In(loc)
+
+    if strings.HasPrefix(value, "+") {
+        spec := value[1:]
+        if strings.HasSuffix(spec, "d") {
+            var days int
+            if _, err := fmt.Sscanf(spec, "%dd", &days); err != nil {
+                return time.Time{}, fmt.Errorf("invalid relative time %q", value)
+            }
+
+            return now.AddDate(0, 0, days), nil
+        }
+
+        dur, err := time.ParseDuration(spec)
+        if err != nil {
+            return time.Time{}, fmt.Errorf("invalid relative time %q", value)
+        }
+
+        return now.Add(dur), nil
+    }
+
+    if t, err := time.ParseInLocation("15:04", value, loc); err == nil {
+        next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+        if !next.After(now) {
+            next = next.AddDate(0, 0, 1)
+        }
+
+        return next, nil
+    }
+
+    if t, err := time.ParseInLocation("2006-01-02 15:04", value, loc); err == nil {
+        return t, nil
+    }
+
+    if t, err := time.Parse(time.RFC3339, value); err == nil {
+        return t, nil
+    }
+
+    return time.Time{}, fmt.Errorf("unrecognised time %q", value)
+}
+
+func ValidateRecurrence(recurrence string) error {
+    switch {
+    case recurrence == RecurrenceNone, recurrence == RecurrenceDaily, recurrence == RecurrenceWeekly:
+        return nil
+    case strings.HasPrefix(recurrence, RecurrenceCron):
+        _, err := ParseCronSchedule(strings.TrimPrefix(recurrence, RecurrenceCron))
+        return err
+    }
+
+    return fmt.Errorf("unknown recurrence %q, expected daily, weekly or cron:<expr>", recurrence)
+}
+
+// Returns the first occurrence after now, or the zero time if the message
+// does not recur.
+func NextOccurrence(sm RIVAScheduledMessage, now time.Time) time.Time {
+    loc := ScheduleLocation()
+    next := sm.SendAt.In(loc)
+
+    switch {
+    case sm.Recurrence == RecurrenceDaily:
+        for !next.After(now) {
+            next = next.AddDate(0, 0, 1)
+        }
+    case sm.Recurrence == RecurrenceWeekly:
+        for !next.After(now) {
+            next = next.AddDate(0, 0, 7)
+        }
+    case strings.HasPrefix(sm.Recurrence, RecurrenceCron):
+        cron, err := ParseCronSchedule(strings.TrimPrefix(sm.Recurrence, RecurrenceCron))
+        if err != nil {
+            return time.Time{}
+        }
+
+        next = cron.Next(now.In(loc))
+    default:
+        return time.Time{}
+    }
+
+    return next
+}
+
+// Shared by the CLI, the admin API and the /later command.
+func NewScheduledMessage(recipient types.JID, sendAt time.Time, recurrence string, content string, mediaPath string, createdBy string) (RIVAScheduledMessage, error) {
+    if recipient.IsEmpty() {
+        return RIVAScheduledMessage{}, fmt.Errorf("recipient is required")
+    }
+
+    if content == "" && mediaPath == "" {
+        return RIVAScheduledMessage{}, fmt.Errorf("either content or media is required")
+    }
+
+    if mediaPath != "" {
+        if _, err := os.Stat(mediaPath); err != nil {
+            return RIVAScheduledMessage{}, fmt.Errorf("media file: %w", err)
+        }
+    }
+
+    if err := ValidateRecurrence(recurrence); err != nil {
+        return RIVAScheduledMessage{}, err
+    }
+
+    sm := RIVAScheduledMessage{
+        RecipientJID: recipient.ToNonAD(),
+        Content:      content,
+        MediaPath:    mediaPath,
+        SendAt:       sendAt,
+        Recurrence:   recurrence,
+        Status:       ScheduledPending,
+        CreatedBy:    createdBy,
+        CreatedAt:    time.Now(),
+    }
+
+    // A cron schedule decides its own first occurrence.
+    if strings.HasPrefix(recurrence, RecurrenceCron) && sendAt.IsZero() {
+        sm.SendAt = NextOccurrence(sm, time.Now())
+    }
+
+    if sm.SendAt.IsZero() {
+        return RIVAScheduledMessage{}, fmt.Errorf("send time is required")
+    }
+
+    return sm, nil
+}
+
+func (s *RIVAClientScheduler) Run(ctx context.Context) {
+    ticker := time.NewTicker(s.Interval)
+    defer ticker.Stop()
+
+    s.Log.Infof("Scheduler started, checking every %s.", s.Interval)
+    for {
+        select {
+        case <-ctx.Done():
+            s.Log.Infof("Scheduler stopped.")
+            return
+        case <-ticker.C:
+            s.tick()
+        }
+    }
+}
+
+/*
+ * Messages that came due while the bot was offline are sent late as long as
+ * they are within the catch-up window. Anything older is marked as missed
+ * instead, so a "see you tonight" reminder does not go out the next morning.
+ * The same applies to messages that came due while automation was paused.
+ */
+func (s *RIVAClientScheduler) tick() {
+    if !s.RClient.WMClient.IsConnected() || !s.RClient.WMClient.IsLoggedIn() || s.RClient.IsAutomationPaused() {
+        return
+    }
+
+    now := time.Now()
+    due, err := s.DB.ListDueScheduledMessages(now)
+    if err != nil {
+        return
+    }
+
+    catchUp := time.Duration(rBotScheduleCatchUpHours * float64(time.Hour))
+    for _, sm := range due {
+        status := ScheduledSent
+        lastError := ""
+        lastSentAt := sm.LastSentAt
+
+        if now.Sub(sm.SendAt) > catchUp {
+            s.Log.Warnf("Scheduled message %d was due at %s, outside the catch-up window. Marking as missed.", sm.ID, sm.SendAt.Format(time.RFC3339))
+            status = ScheduledMissed
+        } else if err := s.send(sm); err != nil {
+            s.Log.Errorf("Failed to send scheduled message %d to %s: %v", sm.ID, sm.RecipientJID, err)
+            status = ScheduledFailed
+            lastError = err.Error()
+        } else {
+            s.Log.Infof("Sent scheduled message %d to %s", sm.ID, sm.RecipientJID)
+            lastSentAt = now
+        }
+
+        nextSendAt := sm.SendAt
+        if next := NextOccurrence(sm, now); !next.IsZero() {
+            nextSendAt = next
+            status = ScheduledPending
+        }
+
+        if err := s.DB.UpdateScheduledMessageState(sm.ID, status, nextSendAt, lastSentAt, lastError); err != nil {
+            s.Log.Errorf("Failed to update state of scheduled message %d: %v", sm.ID, err)
+        }
+    }
+}
+
+func (s *RIVAClientScheduler) send(sm RIVAScheduledMessage) error {
+    if sm.MediaPath == "" {
+        _, err := s.RClient.SendAutomatedMessage(sm.RecipientJID, &waE2E.Message{
+            Conversation: proto.String(sm.Content),
+        }, SentScheduled)
+        return err
+    }
+
+    payload, err := s.RClient.BuildMediaMessage(sm.MediaPath, sm.Content)
+    if err != nil {
+        return err
+    }
+
+    _, err = s.RClient.SendAutomatedMessage(sm.RecipientJID, payload, SentScheduled)
+    return err
+}
+
+// Uploads a local file and wraps it in the message type matching its content.
+func (rc *RIVAClient) BuildMediaMessage(path string, caption string) (*waE2E.Message, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    mimeType := http.DetectContentType(data)
+    mediaType := whatsmeow.MediaDocument
+    switch {
+    case strings.HasPrefix(mimeType, "image/"):
+        mediaType = whatsmeow.MediaImage
+    case strings.HasPrefix(mimeType, "video/"):
+        mediaType = whatsmeow.MediaVideo
+    }
+
+    uploaded, err := rc.WMClient.Upload(context.Background(), data, mediaType)
+    if err != nil {
+        return nil, fmt.Errorf("failed to upload %s: %w", path, err)
+    }
+
+    switch mediaType {
+    case whatsmeow.MediaImage:
+        return &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+            Caption:       proto.String(caption),
+            Mimetype:      proto.String(mimeType),
+            URL:           proto.String(uploaded.URL),
+            DirectPath:    proto.String(uploaded.DirectPath),
+            MediaKey:      uploaded.MediaKey,
+            FileEncSHA256: uploaded.FileEncSHA256,
+            FileSHA256:    uploaded.FileSHA256,
+            FileLength:    proto.Uint64(uploaded.FileLength),
+        }}, nil
+    case whatsmeow.MediaVideo:
+        return &waE2E.Message{VideoMessage: &waE2E.VideoMessage{
+            Caption:       proto.String(caption),
+            Mimetype:      proto.String(mimeType),
+            URL:           proto.String(uploaded.URL),
+            DirectPath:    proto.String(uploaded.DirectPath),
+            MediaKey:      uploaded.MediaKey,
+            FileEncSHA256: uploaded.FileEncSHA256,
+            FileSHA256:    uploaded.FileSHA256,
+            FileLength:    proto.Uint64(uploaded.FileLength),
+        }}, nil
+    }
+
+    return &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{
+        Caption:       proto.String(caption),
+        Mimetype:      proto.String(mimeType),
+        FileName:      proto.String(filepath.Base(path)),
+        URL:           proto.String(uploaded.URL),
+        DirectPath:    proto.String(uploaded.DirectPath),
+        MediaKey:      uploaded.MediaKey,
+        FileEncSHA256: uploaded.FileEncSHA256,
+        FileSHA256:    uploaded.FileSHA256,
+        FileLength:    proto.Uint64(uploaded.FileLength),
+    }}, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+/*
+ * Version of the JSON representation of messages and lifecycle events used for
+ * exports, webhooks, replay files and logs. Bump it whenever a field is
+ * renamed, removed or changes meaning; adding an optional field does not
+ * require a bump.
+ */
+const rBotSchemaVersion = 1
+
+type RIVALifecycleKind string
+const (
+    LifecycleConnected    RIVALifecycleKind = "CONNECTED"
+    LifecycleDisconnected RIVALifecycleKind = "DISCONNECTED"
+    LifecycleLoggedOut    RIVALifecycleKind = "LOGGED_OUT"
+    LifecyclePaired       RIVALifecycleKind = "PAIRED"
+    LifecycleTemporaryBan RIVALifecycleKind = "TEMPORARY_BAN"
+    LifecycleCallRejected RIVALifecycleKind = "CALL_REJECTED"
+)
+
+type RIVALifecycleEvent struct {
+    Kind      RIVALifecycleKind `json:"kind"`             // What happened
+    Timestamp time.Time         `json:"timestamp"`        // When the bot observed it
+    JID       types.JID         `json:"jid,omitempty"`    // Account or contact involved, if any
+    Reason    string            `json:"reason,omitempty"` // Human readable reason, if any
+}
+
+// Same fields as RIVALifecycleEvent but without its methods, so embedding it
+// does not recurse back into MarshalJSON and UnmarshalJSON.
+type rivaLifecycleEventFields RIVALifecycleEvent
+
+type rivaLifecycleEventJSON struct {
+    SchemaVersion int `json:"schema_version"`
+    rivaLifecycleEventFields
+}
+
+// Wire format of RIVAClientMessage. RClient and RawMessage are deliberately
+// left out as neither is meaningful outside of the running process.
+type rivaClientMessageJSON struct {
+    SchemaVersion int                         `json:"schema_version"`
+    ID            string                      `json:"id"`
+    Type          RIVAClientMessageType       `json:"type"`
+    From          types.JID                   `json:"from"`
+    FromPN        string                      `json:"from_pn"`
+    FromNonAD     types.JID                   `json:"from_non_ad"`
+    PushName      string                      `json:"push_name,omitempty"`
+    To            types.JID                   `json:"to"`
+    ToPN          string                      `json:"to_pn"`
+    ToNonAD       types.JID                   `json:"to_non_ad"`
+    Chat          types.JID                   `json:"chat"`
+    Direction     RIVAClientMessageDirection  `json:"direction"`
+    IsGroup       bool                        `json:"is_group"`
+    Content       string                      `json:"content"`
+    Timestamp     time.Time                   `json:"timestamp"`
+    IsViewOnce    bool                        `json:"is_view_once,omitempty"`
+    IsEphemeral   bool                        `json:"is_ephemeral,omitempty"`
+    Media         *RIVAClientMedia            `json:"media,omitempty"`
+    Location      *RIVAClientLocation         `json:"location,omitempty"`
+    Contacts      []RIVAClientContactCard     `json:"contacts,omitempty"`
+    Poll          *RIVAClientPoll             `json:"poll,omitempty"`
+    PollVote      *RIVAClientPollVote         `json:"poll_vote,omitempty"`
+    Reaction      *RIVAClientReaction         `json:"reaction,omitempty"`
+    Reply         *RIVAClientInteractiveReply `json:"reply,omitempty"`
+    Target        *RIVAClientMessageTarget    `json:"target,omitempty"`
+    Context       *RIVAClientMessageContext   `json:"context,omitempty"`
+}
+
+func (msg RIVAClientMessage) MarshalJSON() ([]byte, error) {
+    return json.Marshal(rivaClientMessageJSON{
+        SchemaVersion: rBotSchemaVersion,
+        ID:            msg.ID,
+        Type:          msg.Type,
+        From:          msg.From,
+        FromPN:        msg.FromPN,
+        FromNonAD:     msg.FromNonAD,
+        PushName:      msg.PushName,
+        To:            msg.To,
+        ToPN:          msg.ToPN,
+        ToNonAD:       msg.ToNonAD,
+        Chat:          msg.Chat,
+        Direction:     msg.Direction,
+        IsGroup:       msg.IsGroup,
+        Content:       msg.Content,
+        Timestamp:     msg.Timestamp.UTC(),
+        IsViewOnce:    msg.IsViewOnce,
+        IsEphemeral:   msg.IsEphemeral,
+        Media:         msg.Media,
+        Location:      msg.Location,
+        Contacts:      msg.Contacts,
+        Poll:          msg.Poll,
+        PollVote:      msg.PollVote,
+        Reaction:      msg.Reaction,
+        Reply:         msg.Reply,
+        Target:        msg.Target,
+        Context:       msg.Context,
+    })
+}
+
+func (msg *RIVAClientMessage) UnmarshalJSON(data []byte) error {
+    var wire rivaClientMessageJSON
+    if err := json.Unmarshal(data, &wire); err != nil {
+        return err
+    }
+
+    if wire.SchemaVersion > rBotSchemaVersion {
+        return fmt.Errorf("unsupported message schema version %d (max %d)", wire.SchemaVersion, rBotSchemaVersion)
+    }
+
+    *msg = RIVAClientMessage{
+        ID:          wire.ID,
+        Type:        wire.Type,
+        From:        wire.From,
+        FromPN:      wire.FromPN,
+        FromNonAD:   wire.FromNonAD,
+        PushName:    wire.PushName,
+        To:          wire.To,
+        ToPN:        wire.ToPN,
+        ToNonAD:     wire.ToNonAD,
+        Chat:        wire.Chat,
+        Direction:   wire.Direction,
+        IsGroup:     wire.IsGroup,
+        Content:     wire.Content,
+        Timestamp:   wire.Timestamp,
+        IsViewOnce:  wire.IsViewOnce,
+        IsEphemeral: wire.IsEphemeral,
+        Media:       wire.Media,
+        Location:    wire.Location,
+        Contacts:    wire.Contacts,
+        Poll:        wire.Poll,
+        PollVote:    wire.PollVote,
+        Reaction:    wire.Reaction,
+        Reply:       wire.Reply,
+        Target:      wire.Target,
+        Context:     wire.Context,
+    }
+
+    return nil
+}
+
+// Used by %v and %+v so that logged messages show the stable schema instead
+// of internal pointers.
+func (msg RIVAClientMessage) String() string {
+    data, err := json.Marshal(msg)
+    if err != nil {
+        return fmt.Sprintf("{\"id\":%q,\"error\":%q}", msg.ID, err.Error())
+    }
+
+    return string(data)
+}
+
+func (evt RIVALifecycleEvent) MarshalJSON() ([]byte, error) {
+    evt.Timestamp = evt.Timestamp.UTC()
+    return json.Marshal(rivaLifecycleEventJSON{
+        SchemaVersion:            rBotSchemaVersion,
+        rivaLifecycleEventFields: rivaLifecycleEventFields(evt),
+    })
+}
+
+func (evt *RIVALifecycleEvent) UnmarshalJSON(data []byte) error {
+    var wire rivaLifecycleEventJSON
+    if err := json.Unmarshal(data, &wire); err != nil {
+        return err
+    }
+
+    if wire.SchemaVersion > rBotSchemaVersion {
+        return fmt.Errorf("unsupported lifecycle schema version %d (max %d)", wire.SchemaVersion, rBotSchemaVersion)
+    }
+
+    *evt = RIVALifecycleEvent(wire.rivaLifecycleEventFields)
+    return nil
+}
+
+func (evt RIVALifecycleEvent) String() string {
+    data, err := json.Marshal(evt)
+    if err != nil {
+        return fmt.Sprintf("{\"kind\":%q,\"error\":%q}", evt.Kind, err.Error())
+    }
+
+    return string(data)
+}
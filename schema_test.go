@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRIVAClientMessageJSONRoundTrip(t *testing.T) {
+    rc := &RIVAClient{Log: NewRIVAClientLog("RIVABotTest", "INFO")}
+    msg := (*RIVAClientMessage).New(nil, nil, testMessageEvent("3EB0ROUNDTRIP", &waE2E.Message{
+        ImageMessage: &waE2E.ImageMessage{
+            Caption:  proto.String("Flyer for Saturday"),
+            Mimetype: proto.String("image/jpeg"),
+            ContextInfo: &waE2E.ContextInfo{
+                StanzaID:     proto.String("3EB0QUOTED"),
+                MentionedJID: []string{"15557654321@s.whatsapp.net"},
+            },
+        },
+    }))
+    msg.RClient = rc
+
+    data, err := json.Marshal(msg)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var fields map[string]any
+    if err := json.Unmarshal(data, &fields); err != nil {
+        t.Fatal(err)
+    }
+
+    if fields["schema_version"] != float64(rBotSchemaVersion) {
+        t.Errorf("schema_version is %v, want %d", fields["schema_version"], rBotSchemaVersion)
+    }
+
+    for key := range fields {
+        lower := strings.ToLower(key)
+        if strings.Contains(lower, "client") || strings.Contains(lower, "raw") {
+            t.Errorf("internal field %q leaked into the JSON", key)
+        }
+    }
+
+    var decoded RIVAClientMessage
+    if err := json.Unmarshal(data, &decoded); err != nil {
+        t.Fatal(err)
+    }
+
+    if decoded.RClient != nil || decoded.RawMessage != nil {
+        t.Errorf("decoded message carries process-local pointers")
+    }
+
+    msg.RClient, msg.RawMessage = nil, nil
+    msg.Timestamp = msg.Timestamp.UTC()
+    if !reflect.DeepEqual(decoded, msg) {
+        t.Errorf("round trip changed the message:\n got: %+v\nwant: %+v", decoded, msg)
+    }
+}
+
+func TestRIVAClientMessageRejectsNewerSchema(t *testing.T) {
+    var msg RIVAClientMessage
+    if err := json.Unmarshal([]byte(`{"schema_version": 99, "id": "3EB0FUTURE"}`), &msg); err == nil {
+        t.Errorf("accepted a message with a newer schema version")
+    }
+}
+
+func TestRIVALifecycleEventJSONRoundTrip(t *testing.T) {
+    evt := RIVALifecycleEvent{
+        Kind:      LifecycleTemporaryBan,
+        Timestamp: time.Date(2025, 6, 1, 17, 30, 0, 0, time.FixedZone("SGT", 8 * 60 * 60)),
+        JID:       types.NewJID("15551234567", types.DefaultUserServer),
+        Reason:    "sent too many messages",
+    }
+
+    data, err := json.Marshal(evt)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var fields map[string]any
+    if err := json.Unmarshal(data, &fields); err != nil {
+        t.Fatal(err)
+    }
+
+    if fields["schema_version"] != float64(rBotSchemaVersion) {
+        t.Errorf("schema_version is %v, want %d", fields["schema_version"], rBotSchemaVersion)
+    }
+
+    if fields["timestamp"] != "2025-06-01T09:30:00Z" {
+        t.Errorf("timestamp is %v, want it in UTC", fields["timestamp"])
+    }
+
+    var decoded RIVALifecycleEvent
+    if err := json.Unmarshal(data, &decoded); err != nil {
+        t.Fatal(err)
+    }
+
+    if !decoded.Timestamp.Equal(evt.Timestamp) || decoded.Kind != evt.Kind || decoded.JID != evt.JID || decoded.Reason != evt.Reason {
+        t.Errorf("round trip changed the event:\n got: %+v\nwant: %+v", decoded, evt)
+    }
+
+    if err := json.Unmarshal([]byte(`{"schema_version": 99, "kind": "CONNECTED"}`), &decoded); err == nil {
+        t.Errorf("accepted a lifecycle event with a newer schema version")
+    }
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+ * A conversation starts with an inbound message in a private chat that has
+ * no conversation yet, or whose last one was answered and has been quiet for
+ * longer than the greeting cooldown. It is answered by the first message a
+ * human sends from our number in that chat; the bot's own automated messages
+ * never count, as they do not come back to us as message events.
+ */
+type RIVAConversation struct {
+    ID              int64     `json:"id"`                         // Unique ID of the conversation
+    ChatJID         types.JID `json:"chat_jid"`                   // Chat the conversation is in
+    StartedAt       time.Time `json:"started_at"`                 // First inbound message
+    LastInboundAt   time.Time `json:"last_inbound_at"`            // Latest inbound message
+    InboundCount    int       `json:"inbound_count"`              // Inbound messages so far
+    FirstResponseAt time.Time `json:"first_response_at,omitzero"` // First human reply, zero if unanswered
+    RemindedAt      time.Time `json:"reminded_at,omitzero"`       // When staff were reminded, zero if not
+}
+
+// Returns how long the contact waited, or has been waiting so far.
+func (c RIVAConversation) ResponseTime(now time.Time) time.Duration {
+    if c.FirstResponseAt.IsZero() {
+        return now.Sub(c.StartedAt)
+    }
+
+    return c.FirstResponseAt.Sub(c.StartedAt)
+}
+
+type RIVASLAStats struct {
+    From                  time.Time `json:"from"`                    // Start of the period, inclusive
+    To                    time.Time `json:"to"`                      // End of the period, exclusive
+    Conversations         int       `json:"conversations"`           // Conversations started in the period
+    Answered              int       `json:"answered"`                // Conversations with a human reply
+    WithinSLA             int       `json:"within_sla"`              // Answered within sla_minutes
+    Breached              int       `json:"breached"`                // Answered late, or unanswered past sla_minutes
+    MedianResponseMinutes float64   `json:"median_response_minutes"` // Median time to first reply of answered conversations
+    MeanResponseMinutes   float64   `json:"mean_response_minutes"`   // Mean time to first reply of answered conversations
+}
+
+// Reminders list at most this many chats, so a long outage does not flood the group.
+const rBotSLAReminderMaxChats = 20
+
+func SLADuration() time.Duration {
+    return time.Duration(rBotSLAMinutes * float64(time.Minute))
+}
+
+func StaffGroupJID() (types.JID, bool) {
+    if rBotStaffGroup == "" {
+        return types.EmptyJID, false
+    }
+
+    jid, err := types.ParseJID(rBotStaffGroup)
+    if err != nil || jid.Server != types.GroupServer {
+        return types.EmptyJID, false
+    }
+
+    return jid, true
+}
+
+func (rc *RIVAClient) SendStaffMessage(text string) (whatsmeow.SendResponse, error) {
+    group, found := StaffGroupJID()
+    if !found {
+        return whatsmeow.SendResponse{}, errors.New("staff_group is not set to a valid group JID")
+    }
+
+    resp, err := rc.SendTrackedMessage(group, &waE2E.Message{Conversation: proto.String(text)}, SentStaff)
+    if err != nil {
+        rc.Log.Errorf("Failed to send message to staff group %s: %v", group, err)
+    }
+
+    return resp, err
+}
+
+func ComputeSLAStats(conversations []RIVAConversation, from time.Time, to time.Time, now time.Time) RIVASLAStats {
+    stats := RIVASLAStats{From: from, To: to}
+    sla := SLADuration()
+
+    responses := make([]time.Duration, 0, len(conversations))
+    var total time.Duration
+    for _, c := range conversations {
+        if c.StartedAt.Before(from) || !c.StartedAt.Before(to) {
+            continue
+        }
+
+        stats.Conversations++
+        waited := c.ResponseTime(now)
+        if c.FirstResponseAt.IsZero() {
+            if waited > sla {
+                stats.Breached++
+            }
+
+            continue
+        }
+
+        stats.Answered++
+        responses = append(responses, waited)
+        total += waited
+        if waited <= sla {
+            stats.WithinSLA++
+        } else {
+            stats.Breached++
+        }
+    }
+
+    if len(responses) > 0 {
+        slices.Sort(responses)
+        median := responses[len(responses) / 2]
+        if len(responses) % 2 == 0 {
+            median = (responses[len(responses) / 2 - 1] + median) / 2
+        }
+
+        stats.MedianResponseMinutes = median.Minutes()
+        stats.MeanResponseMinutes = (total / time.Duration(len(responses))).Minutes()
+    }
+
+    return stats
+}
+
+// Returns the start of the week (Monday 00:00) containing t, in the configured timezone.
+func WeekStart(t time.Time) time.Time {
+    t = t.In(ScheduleLocation())
+    offset := (int(t.Weekday()) + 6) % 7
+    return time.Date(t.Year(), t.Month(), t.Day() - offset, 0, 0, 0, 0, t.Location())
+}
+
+// Returns statistics for the current week and the weeks before it, oldest first.
+func WeeklySLAStats(db *RIVAClientDB, weeks int, now time.Time) ([]RIVASLAStats, error) {
+    if weeks < 1 {
+        weeks = 1
+    }
+
+    current := WeekStart(now)
+    first := current.AddDate(0, 0, -7 * (weeks - 1))
+    conversations, err := db.ListConversations(first, current.AddDate(0, 0, 7))
+    if err != nil {
+        return nil, err
+    }
+
+    stats := make([]RIVASLAStats, 0, weeks)
+    for start := first; !start.After(current); start = start.AddDate(0, 0, 7) {
+        stats = append(stats, ComputeSLAStats(conversations, start, start.AddDate(0, 0, 7), now))
+    }
+
+    return stats, nil
+}
+
+func (s RIVASLAStats) String() string {
+    rate := 0.0
+    if s.Conversations > 0 {
+        rate = 100 * float64(s.WithinSLA) / float64(s.Conversations)
+    }
+
+    return fmt.Sprintf("%d conversations, %d answered, %d within %.0f minutes (%.1f%%), %d breached, median reply %.0f min, mean %.0f min",
+                       s.Conversations, s.Answered, s.WithinSLA, rBotSLAMinutes, rate, s.Breached, s.MedianResponseMinutes, s.MeanResponseMinutes)
+}
+
+/*
+ * Watches for conversations waiting longer than sla_minutes and reminds the
+ * staff group about them, once per conversation. Also posts the previous
+ * week's statistics to the staff group on sla_report_cron.
+ */
+type RIVAClientSLA struct {
+    RClient  *RIVAClient
+    DB       *RIVAClientDB
+    Log      *RIVAClientLog
+    Interval time.Duration
+}
+
+func (*RIVAClientSLA) New(rClient *RIVAClient, db *RIVAClientDB) *RIVAClientSLA {
+    return &RIVAClientSLA{
+        RClient:  rClient,
+        DB:       db,
+        Log:      NewRIVAClientLog("RIVABotSLA", "INFO"),
+        Interval: time.Minute,
+    }
+}
+
+func (s *RIVAClientSLA) Run(ctx context.Context) {
+    if _, found := StaffGroupJID(); !found || rBotSLAMinutes <= 0 {
+        s.Log.Infof("SLA reminders disabled, staff_group or sla_minutes is not set.")
+        return
+    }
+
+    var report *RIVACronSchedule
+    var nextReport time.Time
+    if rBotSLAReportCron != "" {
+        schedule, err := ParseCronSchedule(rBotSLAReportCron)
+        if err != nil {
+            s.Log.Errorf("Invalid sla_report_cron %q, weekly reports disabled: %v", rBotSLAReportCron, err)
+        } else {
+            report = schedule
+            nextReport = report.Next(time.Now().In(ScheduleLocation()))
+        }
+    }
+
+    ticker := time.NewTicker(s.Interval)
+    defer ticker.Stop()
+
+    s.Log.Infof("SLA monitor started, reminding after %.0f minutes.", rBotSLAMinutes)
+    for {
+        select {
+        case <-ctx.Done():
+            s.Log.Infof("SLA monitor stopped.")
+            return
+        case now := <-ticker.C:
+            if !s.RClient.WMClient.IsConnected() || !s.RClient.WMClient.IsLoggedIn() {
+                continue
+            }
+
+            s.remindOverdue(now)
+            if report != nil && !nextReport.IsZero() && !now.Before(nextReport) {
+                s.postWeeklyReport(now)
+                nextReport = report.Next(now.In(ScheduleLocation()))
+            }
+        }
+    }
+}
+
+func (s *RIVAClientSLA) remindOverdue(now time.Time) {
+    overdue, err := s.DB.ListOverdueConversations(now.Add(-SLADuration()))
+    if err != nil || len(overdue) == 0 {
+        return
+    }
+
+    var sb strings.Builder
+    fmt.Fprintf(&sb, "*SLA reminder:* %d chat(s) waiting more than %.0f minutes for a reply\n", len(overdue), rBotSLAMinutes)
+    for i, c := range overdue {
+        if i == rBotSLAReminderMaxChats {
+            fmt.Fprintf(&sb, "\n…and %d more", len(overdue) - i)
+            break
+        }
+
+        // The staff group only sees redacted numbers, so a contact without
+        // a name is not shown by the number DisplayName falls back to.
+        name := "Unknown"
+        if contact, found, err := s.DB.GetContact(c.ChatJID); err == nil && found && contact.DisplayName() != contact.JID.User {
+            name = contact.DisplayName()
+        }
+
+        fmt.Fprintf(&sb, "\n• %s (%s), waiting %s", name, RedactNumber(c.ChatJID), c.ResponseTime(now).Round(time.Minute))
+    }
+
+    if _, err := s.RClient.SendStaffMessage(sb.String()); err != nil {
+        return
+    }
+
+    for _, c := range overdue {
+        s.DB.MarkConversationReminded(c.ID, now)
+    }
+
+    s.Log.Infof("Reminded staff about %d overdue conversations.", len(overdue))
+}
+
+func (s *RIVAClientSLA) postWeeklyReport(now time.Time) {
+    stats, err := WeeklySLAStats(s.DB, 2, now)
+    if err != nil {
+        return
+    }
+
+    last := stats[0]
+    text := fmt.Sprintf("*Weekly response report* (%s to %s)\n\n%s",
+                        last.From.Format("2 Jan"),
+                        last.To.AddDate(0, 0, -1).Format("2 Jan"),
+                        last)
+
+    if _, err := s.RClient.SendStaffMessage(text); err == nil {
+        s.Log.Infof("Posted weekly SLA report: %s", last)
+    }
+}
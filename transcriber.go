@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Transcriber interface {
+    Transcribe(ctx context.Context, audioPath string) (string, error)
+}
+
+/*
+ * Runs a local speech-to-text binary such as whisper.cpp's whisper-cli. The
+ * command is configured as a single string where {input} is replaced with the
+ * path of the audio file, e.g.
+ *
+ *   whisper-cli -m /models/ggml-base.bin -l auto -nt -np -f {input}
+ *
+ * Whatever the command prints on stdout is used as the transcript.
+ *
+ * Voice notes arrive as OGG/Opus, which whisper-cli does not read, so if a
+ * convert command is set it runs first with {input} and {output} replaced by
+ * the stored file and a temporary WAV file, e.g.
+ *
+ *   ffmpeg -nostdin -loglevel error -y -i {input} -ar 16000 -ac 1 -c:a pcm_s16le {output}
+ *
+ * and the transcriber is given the WAV file instead. Both share the timeout.
+ * Speech-to-text is CPU heavy, so at most transcriber_concurrency files are
+ * transcribed at once and the rest wait their turn.
+ */
+type CommandTranscriber struct {
+    Command        []string
+    ConvertCommand []string
+    Timeout        time.Duration
+    slots          chan struct{}
+}
+
+func (t *CommandTranscriber) Transcribe(ctx context.Context, audioPath string) (string, error) {
+    if len(t.Command) == 0 {
+        return "", fmt.Errorf("no transcriber command configured")
+    }
+
+    if t.slots != nil {
+        select {
+        case t.slots <- struct{}{}:
+            defer func() { <-t.slots }()
+        case <-ctx.Done():
+            return "", ctx.Err()
+        }
+    }
+
+    ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+    defer cancel()
+
+    if len(t.ConvertCommand) > 0 {
+        tmpDir, err := os.MkdirTemp("", "rivabot-transcribe-")
+        if err != nil {
+            return "", err
+        }
+        defer os.RemoveAll(tmpDir)
+
+        wavPath := filepath.Join(tmpDir, "audio.wav")
+        if _, err := runCommand(ctx, t.ConvertCommand, strings.NewReplacer("{input}", audioPath, "{output}", wavPath)); err != nil {
+            return "", err
+        }
+
+        audioPath = wavPath
+    }
+
+    return runCommand(ctx, t.Command, strings.NewReplacer("{input}", audioPath))
+}
+
+// Runs a configured command after filling in its placeholders, returning its
+// trimmed stdout.
+func runCommand(ctx context.Context, command []string, placeholders *strings.Replacer) (string, error) {
+    args := make([]string, len(command))
+    for i, arg := range command {
+        args[i] = placeholders.Replace(arg)
+    }
+
+    var stdout, stderr bytes.Buffer
+    cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+    cmd.Stdout = &stdout
+    cmd.Stderr = &stderr
+
+    if err := cmd.Run(); err != nil {
+        return "", fmt.Errorf("%s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+    }
+
+    return strings.TrimSpace(stdout.String()), nil
+}
+
+// Returns the same transcript for every file. Useful for exercising the
+// transcription flow locally without a speech-to-text model installed.
+type StaticTranscriber struct {
+    Transcript string
+}
+
+func (t *StaticTranscriber) Transcribe(ctx context.Context, audioPath string) (string, error) {
+    return t.Transcript, nil
+}
+
+func NewTranscriber() Transcriber {
+    switch rBotTranscriber {
+    case "command":
+        return &CommandTranscriber{
+            Command:        strings.Fields(rBotTranscriberCommand),
+            ConvertCommand: strings.Fields(rBotTranscriberConvertCommand),
+            Timeout:        time.Duration(rBotTranscriberTimeoutSecs * float64(time.Second)),
+            slots:          make(chan struct{}, max(rBotTranscriberConcurrency, 1)),
+        }
+    case "static":
+        return &StaticTranscriber{
+            Transcript: "[TRANSCRIPT]",
+        }
+    }
+
+    return nil
+}
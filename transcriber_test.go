@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTranscribeVoiceNoteArchivesTranscript(t *testing.T) {
+    rc := newTestClient(t, &fakeDownloader{})
+    rc.Transcriber = &StaticTranscriber{Transcript: "See you at the hall on Saturday"}
+
+    msg := (*RIVAClientMessage).New(nil, rc, testMessageEvent("3EB0VOICENOTE", &waE2E.Message{
+        AudioMessage: &waE2E.AudioMessage{
+            Mimetype: proto.String("audio/ogg; codecs=opus"),
+            Seconds:  proto.Uint32(4),
+            PTT:      proto.Bool(true),
+        },
+    }))
+
+    if err := rc.DB.ArchiveMessage(msg); err != nil {
+        t.Fatal(err)
+    }
+
+    if err := rc.TranscribeVoiceNote(msg, filepath.Join(t.TempDir(), "voice.ogg")); err != nil {
+        t.Fatal(err)
+    }
+
+    var content string
+    query := fmt.Sprintf(rBotSqlArchiveGetContentQuery, rBotSqlArchiveTableName)
+    if err := rc.DB.DB.QueryRow(query, msg.Chat.String(), msg.ID).Scan(&content); err != nil {
+        t.Fatal(err)
+    }
+
+    if content != "See you at the hall on Saturday" {
+        t.Errorf("archived content is %q, want the transcript", content)
+    }
+}
+
+func TestCommandTranscriberConvertsFirst(t *testing.T) {
+    input := filepath.Join(t.TempDir(), "voice.ogg")
+    if err := os.WriteFile(input, []byte("hello from the wav file"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+
+    transcriber := &CommandTranscriber{
+        Command:        []string{"cat", "{input}"},
+        ConvertCommand: []string{"cp", "{input}", "{output}"},
+        Timeout:        5 * time.Second,
+        slots:          make(chan struct{}, 1),
+    }
+
+    transcript, err := transcriber.Transcribe(context.Background(), input)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if transcript != "hello from the wav file" {
+        t.Errorf("transcript is %q, want the converted file's content", transcript)
+    }
+}